@@ -0,0 +1,70 @@
+// Command mailin ingests inbound email once and exits. It reads the same
+// sources as the server's background worker, e.g.
+//
+//	go run ./cmd/mailin -source dir:mailin/fixtures
+//
+// With -dry-run a directory of .eml files is only parsed and summarised,
+// without a database.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"supportdesk/config"
+	"supportdesk/mailin"
+)
+
+func main() {
+	spec := flag.String("source", os.Getenv("MAILIN_SOURCE"), "mail source, e.g. maildir:/var/mail/support, dir:./fixtures or imaps://user@host/INBOX")
+	dryRun := flag.Bool("dry-run", false, "parse a dir: source and print what was found, without touching the database")
+	flag.Parse()
+
+	if *spec == "" {
+		log.Fatal("No mail source given, set -source or MAILIN_SOURCE")
+	}
+	source, err := mailin.NewSource(*spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *dryRun {
+		if _, ok := source.(mailin.Directory); !ok {
+			log.Fatal("-dry-run only reads dir: sources, other sources would consume the mail")
+		}
+		if err := source.Fetch(printMessage); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	config.InitDB()
+	if err := source.Fetch(mailin.Process); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printMessage summarises a parsed email
+func printMessage(raw []byte) error {
+	msg, err := mailin.Parse(raw)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("From:        %s <%s>\n", msg.From.Name, msg.From.Address)
+	fmt.Printf("Subject:     %s\n", msg.Subject)
+	fmt.Printf("Message-ID:  %s\n", msg.MessageID)
+	if related := msg.Related(); len(related) > 0 {
+		fmt.Printf("Replies to:  %s\n", strings.Join(related, ", "))
+	}
+	if msg.AutoSubmitted {
+		fmt.Println("Automatic:   yes, would be skipped")
+	}
+	for _, attachment := range msg.Attachments {
+		fmt.Printf("Attachment:  %s (%s, %d bytes)\n", attachment.Filename, attachment.ContentType, len(attachment.Data))
+	}
+	fmt.Printf("\n%s\n\n", mailin.StripQuoted(msg.Text))
+	return nil
+}
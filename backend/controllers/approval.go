@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// approvalError maps approval errors to responses
+func approvalError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrApprovalChainNotFound), errors.Is(err, models.ErrApprovalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidApprover):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotApprover), errors.Is(err, models.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrRequestTypeTaken), errors.Is(err, models.ErrApprovalDecided):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Approval operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetApprovalChains handles listing the approval chains (Admin only)
+func GetApprovalChains(c *gin.Context) {
+	chains, err := models.GetApprovalChains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching approval chains"})
+		return
+	}
+
+	c.JSON(http.StatusOK, chains)
+}
+
+// CreateApprovalChain handles creating the approval chain of a request type (Admin only)
+func CreateApprovalChain(c *gin.Context) {
+	var req models.ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chain, err := models.CreateApprovalChain(req)
+	if err != nil {
+		approvalError(c, err, "Error creating approval chain")
+		return
+	}
+
+	c.JSON(http.StatusCreated, chain)
+}
+
+// UpdateApprovalChain handles replacing an approval chain (Admin only)
+func UpdateApprovalChain(c *gin.Context) {
+	id, ok := parseID(c, "approval chain")
+	if !ok {
+		return
+	}
+
+	var req models.ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chain, err := models.UpdateApprovalChain(id, req)
+	if err != nil {
+		approvalError(c, err, "Error updating approval chain")
+		return
+	}
+
+	c.JSON(http.StatusOK, chain)
+}
+
+// DeleteApprovalChain handles deleting an approval chain (Admin only)
+func DeleteApprovalChain(c *gin.Context) {
+	id, ok := parseID(c, "approval chain")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteApprovalChain(id); err != nil {
+		approvalError(c, err, "Error deleting approval chain")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Approval chain deleted successfully"})
+}
+
+// GetMyApprovals handles listing the approvals waiting for the current user
+func GetMyApprovals(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	approvals, err := models.GetMyApprovals(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching approvals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, approvals)
+}
+
+// ApproveApproval handles signing off a pending approval step
+func ApproveApproval(c *gin.Context) {
+	decideApproval(c, true)
+}
+
+// RejectApproval handles rejecting a pending approval step, which closes the request
+func RejectApproval(c *gin.Context) {
+	decideApproval(c, false)
+}
+
+// decideApproval records the current user's decision on an approval step
+func decideApproval(c *gin.Context, approve bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "approval")
+	if !ok {
+		return
+	}
+
+	var decision models.ApprovalDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	approval, err := models.DecideApproval(id, approve, decision, user)
+	if err != nil {
+		approvalError(c, err, "Error recording decision")
+		return
+	}
+
+	log.Printf("Approval %d of ticket %d %s by %s", approval.ID, approval.TicketID, approval.Status, user.Email)
+	c.JSON(http.StatusOK, approval)
+}
+
+// GetTicketApprovals handles listing the approval steps of a ticket
+func GetTicketApprovals(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	approvals, err := models.GetTicketApprovals(ticket.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching approvals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, approvals)
+}
@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAssetImportBytes caps the size of an inventory CSV
+const maxAssetImportBytes = 10 << 20
+
+// assetError maps asset registry errors to responses
+func assetError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrAssetNotFound), errors.Is(err, models.ErrAssetRelationNotFound),
+		errors.Is(err, models.ErrChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidAssetStatus), errors.Is(err, models.ErrInvalidAssetOwner),
+		errors.Is(err, models.ErrInvalidRelationType), errors.Is(err, models.ErrRelationToSelf),
+		errors.Is(err, models.ErrAssetImportHeader):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrDuplicateAssetTag):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ticketError(c, err, fallback)
+	}
+}
+
+// assetParam parses an asset ID route parameter other than :id
+func assetParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetAssets handles listing assets, filtered by type, status, owner and a
+// search text in q (Agent only)
+func GetAssets(c *gin.Context) {
+	filter := models.AssetFilter{
+		Type:   c.Query("type"),
+		Status: c.Query("status"),
+		Search: c.Query("q"),
+	}
+	if value := c.Query("owner_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid owner ID"})
+			return
+		}
+		filter.OwnerID = uint(id)
+	}
+
+	assets, err := models.GetAssets(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching assets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// GetMyAssets handles listing the assets of the current user, to pick from
+// when raising a ticket
+func GetMyAssets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	assets, err := models.GetAssets(models.AssetFilter{OwnerID: user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching assets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// GetAsset handles fetching an asset with its relations (Agent only)
+func GetAsset(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	asset, err := models.GetAssetByID(id)
+	if err != nil {
+		assetError(c, err, "Error fetching asset")
+		return
+	}
+
+	c.JSON(http.StatusOK, asset)
+}
+
+// CreateAsset handles registering an asset (Agent only)
+func CreateAsset(c *gin.Context) {
+	var req models.AssetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := models.CreateAsset(req)
+	if err != nil {
+		assetError(c, err, "Error creating asset")
+		return
+	}
+
+	c.JSON(http.StatusCreated, asset)
+}
+
+// UpdateAsset handles updating an asset (Agent only)
+func UpdateAsset(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	var req models.AssetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := models.UpdateAsset(id, req)
+	if err != nil {
+		assetError(c, err, "Error updating asset")
+		return
+	}
+
+	c.JSON(http.StatusOK, asset)
+}
+
+// DeleteAsset handles removing an asset (Admin only)
+func DeleteAsset(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteAsset(id); err != nil {
+		assetError(c, err, "Error deleting asset")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted successfully"})
+}
+
+// AddAssetRelation handles relating an asset to another one (Agent only)
+func AddAssetRelation(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	var req models.AssetRelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := models.AddAssetRelation(id, req)
+	if err != nil {
+		assetError(c, err, "Error relating assets")
+		return
+	}
+
+	c.JSON(http.StatusOK, asset)
+}
+
+// RemoveAssetRelation handles removing a relation of an asset (Agent only)
+func RemoveAssetRelation(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+	relationID, err := strconv.ParseUint(c.Param("relation_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid relation ID"})
+		return
+	}
+
+	if err := models.RemoveAssetRelation(id, uint(relationID)); err != nil {
+		assetError(c, err, "Error removing relation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Relation removed successfully"})
+}
+
+// GetAssetTickets handles listing the ticket history of an asset (Agent only)
+func GetAssetTickets(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	tickets, err := models.GetAssetTickets(id)
+	if err != nil {
+		assetError(c, err, "Error fetching asset tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// GetAssetChanges handles listing the change requests touching an asset (Agent only)
+func GetAssetChanges(c *gin.Context) {
+	id, ok := parseID(c, "asset")
+	if !ok {
+		return
+	}
+
+	changes, err := models.GetAssetChanges(id)
+	if err != nil {
+		assetError(c, err, "Error fetching asset changes")
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// LinkTicketAssets handles linking assets to a ticket (Agent only)
+func LinkTicketAssets(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.AssetLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assets, err := models.LinkTicketAssets(id, req)
+	if err != nil {
+		assetError(c, err, "Error linking assets")
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// UnlinkTicketAsset handles removing an asset from a ticket (Agent only)
+func UnlinkTicketAsset(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	assetID, ok := assetParam(c, "asset_id")
+	if !ok {
+		return
+	}
+
+	if err := models.UnlinkTicketAsset(id, assetID); err != nil {
+		assetError(c, err, "Error unlinking asset")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset unlinked successfully"})
+}
+
+// LinkChangeAssets handles linking assets to a change request (Agent only)
+func LinkChangeAssets(c *gin.Context) {
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	var req models.AssetLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assets, err := models.LinkChangeAssets(id, req)
+	if err != nil {
+		assetError(c, err, "Error linking assets")
+		return
+	}
+
+	c.JSON(http.StatusOK, assets)
+}
+
+// UnlinkChangeAsset handles removing an asset from a change request (Agent only)
+func UnlinkChangeAsset(c *gin.Context) {
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+	assetID, ok := assetParam(c, "asset_id")
+	if !ok {
+		return
+	}
+
+	if err := models.UnlinkChangeAsset(id, assetID); err != nil {
+		assetError(c, err, "Error unlinking asset")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset unlinked successfully"})
+}
+
+// ImportAssets handles importing an inventory CSV, uploaded as the "file"
+// form field or sent as the request body. dry_run=true only validates it
+// (Admin only).
+func ImportAssets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAssetImportBytes)
+
+	var source io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the file field"})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read the uploaded file"})
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	result, err := models.ImportAssets(source, c.Query("dry_run") == "true")
+	if err != nil {
+		assetError(c, err, "Error importing assets")
+		return
+	}
+
+	log.Printf("Asset import by %s: %d created, %d updated, %d failed (dry run: %t)",
+		user.Email, result.Created, result.Updated, len(result.Errors), result.DryRun)
+	c.JSON(http.StatusOK, result)
+}
@@ -3,13 +3,11 @@ package controllers
 import (
 	"log"
 	"net/http"
-	"os"
-	"time"
 
+	"supportdesk/middleware"
 	"supportdesk/models" // Assuming models.User and database functions are here
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // Login handles user authentication
@@ -30,29 +28,27 @@ func Login(c *gin.Context) {
 	user, err := models.GetUserByEmail(input.Email)
 	if err != nil {
 		log.Printf("Login: User not found: %s, error: %v", input.Email, err)
+		recordSecurityEvent(c, nil, input.Email, models.SecurityEventLoginFailed, "unknown email")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
 	if err := user.CheckPassword(input.Password); err != nil {
 		log.Printf("Login: Invalid password for user: %s", input.Email)
+		recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventLoginFailed, "invalid password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
-	})
-
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-256-bit-secret" // Change this in production
+	if !user.Active {
+		log.Printf("Login: Deactivated user attempted to log in: %s", input.Email)
+		recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventLoginFailed, "account deactivated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+		return
 	}
 
-	tokenString, err := token.SignedString([]byte(secret))
+	// Generate JWT token (expires in 24 hours, carries the user's security stamp)
+	tokenString, err := middleware.GenerateToken(*user)
 	if err != nil {
 		log.Printf("Login: Failed to generate token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
@@ -60,6 +56,7 @@ func Login(c *gin.Context) {
 	}
 
 	log.Printf("Login successful for user: %s with role: %s", user.Email, user.Role) // Good for backend debugging
+	recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventLoginSucceeded, "")
 
 	c.JSON(http.StatusOK, gin.H{
 		 "token": tokenString,
@@ -130,9 +127,137 @@ func GetCurrentUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"user_id":    user.ID,
 		"email": user.Email,
 		"role":  user.Role,
+	}
+
+	// Make it obvious to the frontend that an admin is acting as this user
+	if impersonatorID, impersonating := c.Get("impersonator_id"); impersonating {
+		if impersonator, err := models.GetUserByID(impersonatorID.(uint)); err == nil {
+			response["impersonated_by"] = gin.H{
+				"user_id": impersonator.ID,
+				"email":   impersonator.Email,
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword handles changing the current user's password
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	user, err := models.GetUserByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get user details"})
+		return
+	}
+
+	if err := user.CheckPassword(input.CurrentPassword); err != nil {
+		log.Printf("ChangePassword: Invalid current password for user: %s", user.Email)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := models.SetUserPassword(user.ID, input.NewPassword); err != nil {
+		log.Printf("ChangePassword: Failed to update password for user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventPasswordChanged, "")
+
+	// Changing the password revokes every existing token, including this one
+	respondWithFreshToken(c, user.ID, "Password changed successfully")
+}
+
+// RevokeMyTokens handles signing the current user out of every session
+func RevokeMyTokens(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	user, err := models.GetUserByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get user details"})
+		return
+	}
+
+	if err := models.RevokeUserTokens(user.ID); err != nil {
+		log.Printf("RevokeMyTokens: Failed to revoke tokens for user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventTokenRevoked, "revoked by user")
+
+	respondWithFreshToken(c, user.ID, "All other sessions have been signed out")
+}
+
+// respondWithFreshToken issues a new token after the user's security stamp changed
+func respondWithFreshToken(c *gin.Context, userID uint, message string) {
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get user details"})
+		return
+	}
+
+	tokenString, err := middleware.GenerateToken(*user)
+	if err != nil {
+		log.Printf("Failed to generate token for user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"token":   tokenString,
 	})
 }
+
+// IntrospectToken lets other services check a token against the current user state.
+// AuthMiddleware has already rejected stale, revoked and deactivated tokens.
+func IntrospectToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"active": false})
+		return
+	}
+
+	user, err := models.GetUserByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"active": false})
+		return
+	}
+
+	response := gin.H{
+		"active":  true,
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+		"ver":     user.TokenVersion,
+	}
+	if impersonatorID, impersonating := c.Get("impersonator_id"); impersonating {
+		response["impersonator_id"] = impersonatorID
+	}
+
+	c.JSON(http.StatusOK, response)
+}
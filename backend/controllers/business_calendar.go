@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calendarID parses the :id route parameter
+func calendarID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// calendarError maps model errors to HTTP responses
+func calendarError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrCalendarNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business calendar not found"})
+	case errors.Is(err, models.ErrCalendarExists), errors.Is(err, models.ErrCalendarInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidTimezone), errors.Is(err, models.ErrInvalidBusinessHours),
+		errors.Is(err, models.ErrInvalidHoliday), errors.Is(err, models.ErrOverlappingHours):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Business calendar operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetBusinessCalendars handles listing business-hours calendars (Admin only)
+func GetBusinessCalendars(c *gin.Context) {
+	calendars, err := models.GetBusinessCalendars()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching business calendars"})
+		return
+	}
+
+	c.JSON(http.StatusOK, calendars)
+}
+
+// GetBusinessCalendar handles fetching a single calendar (Admin only)
+func GetBusinessCalendar(c *gin.Context) {
+	id, ok := calendarID(c)
+	if !ok {
+		return
+	}
+
+	calendar, err := models.GetBusinessCalendarByID(id)
+	if err != nil {
+		calendarError(c, err, "Error fetching business calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// CreateBusinessCalendar handles creating a calendar (Admin only)
+func CreateBusinessCalendar(c *gin.Context) {
+	var req models.BusinessCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar, err := models.CreateBusinessCalendar(req)
+	if err != nil {
+		calendarError(c, err, "Error creating business calendar")
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendar)
+}
+
+// UpdateBusinessCalendar handles replacing a calendar's hours and holidays (Admin only)
+func UpdateBusinessCalendar(c *gin.Context) {
+	id, ok := calendarID(c)
+	if !ok {
+		return
+	}
+
+	var req models.BusinessCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar, err := models.UpdateBusinessCalendar(id, req)
+	if err != nil {
+		calendarError(c, err, "Error updating business calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// DeleteBusinessCalendar handles deleting a calendar no SLA policy or escalation rule uses (Admin only)
+func DeleteBusinessCalendar(c *gin.Context) {
+	id, ok := calendarID(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteBusinessCalendar(id); err != nil {
+		calendarError(c, err, "Error deleting business calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Business calendar deleted"})
+}
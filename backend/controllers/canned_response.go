@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cannedError maps canned response and macro errors to HTTP responses
+func cannedError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrCannedResponseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canned response not found"})
+	case errors.Is(err, models.ErrMacroNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Macro not found"})
+	case errors.Is(err, models.ErrSharingNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrUnknownPlaceholder), errors.Is(err, models.ErrArticlePlaceholder),
+		errors.Is(err, models.ErrArticleNotFound), errors.Is(err, models.ErrQueueNotFound),
+		errors.Is(err, models.ErrMacroEmpty), errors.Is(err, models.ErrInvalidVisibility),
+		errors.Is(err, models.ErrInvalidTicketStatus), errors.Is(err, models.ErrInvalidPriority),
+		errors.Is(err, models.ErrInvalidAssignee):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTicketNotFound), errors.Is(err, models.ErrInvalidTransition),
+		errors.Is(err, models.ErrTicketClosed):
+		ticketError(c, err, fallback)
+	default:
+		log.Printf("Canned response operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// queueFilter parses the optional queue_id query parameter
+func queueFilter(c *gin.Context) (uint, bool) {
+	value := c.Query("queue_id")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCannedResponses handles listing the canned responses the agent may use (Agent only)
+func GetCannedResponses(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	queueID, ok := queueFilter(c)
+	if !ok {
+		return
+	}
+
+	responses, err := models.GetCannedResponses(user, queueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching canned responses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"canned_responses": responses, "placeholders": models.Placeholders})
+}
+
+// CreateCannedResponse handles creating a personal or shared canned response (Agent only)
+func CreateCannedResponse(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.CannedResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := models.CreateCannedResponse(req, user)
+	if err != nil {
+		cannedError(c, err, "Error creating canned response")
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateCannedResponse handles updating a canned response (Agent only)
+func UpdateCannedResponse(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "canned response")
+	if !ok {
+		return
+	}
+
+	var req models.CannedResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := models.UpdateCannedResponse(id, req, user)
+	if err != nil {
+		cannedError(c, err, "Error updating canned response")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteCannedResponse handles deleting a canned response (Agent only)
+func DeleteCannedResponse(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "canned response")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteCannedResponse(id, user); err != nil {
+		cannedError(c, err, "Error deleting canned response")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Canned response deleted"})
+}
+
+// RenderCannedResponse handles filling in a canned response for a ticket,
+// given as ?ticket_id= (Agent only)
+func RenderCannedResponse(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "canned response")
+	if !ok {
+		return
+	}
+	ticketID, err := strconv.ParseUint(c.Query("ticket_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	rendered, err := models.RenderCannedResponse(id, uint(ticketID), user)
+	if err != nil {
+		cannedError(c, err, "Error rendering canned response")
+		return
+	}
+
+	c.JSON(http.StatusOK, rendered)
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// catalogError maps service catalog errors to responses
+func catalogError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrCatalogItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidCategory), errors.Is(err, models.ErrInvalidPriority),
+		errors.Is(err, models.ErrQueueNotFound), errors.Is(err, models.ErrArticleNotFound),
+		errors.Is(err, models.ErrApprovalChainNotFound), errors.Is(err, models.ErrDuplicateFormKey),
+		errors.Is(err, models.ErrInvalidFieldKey), errors.Is(err, models.ErrInvalidFieldType),
+		errors.Is(err, models.ErrFieldOptionsRequired), errors.Is(err, models.ErrInvalidFieldValue):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Catalog operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetCatalog handles listing the orderable catalog items
+func GetCatalog(c *gin.Context) {
+	items, err := models.GetCatalogItems(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching catalog"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// GetCatalogItem handles fetching an orderable catalog item with its form
+func GetCatalogItem(c *gin.Context) {
+	id, ok := parseID(c, "catalog item")
+	if !ok {
+		return
+	}
+
+	item, err := models.GetCatalogItemByID(id, false)
+	if err != nil {
+		catalogError(c, err, "Error fetching catalog item")
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// OrderCatalogItem handles submitting the request form of a catalog item,
+// which raises its fulfilment ticket
+func OrderCatalogItem(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "catalog item")
+	if !ok {
+		return
+	}
+
+	var order models.CatalogOrder
+	if err := c.ShouldBindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requesterID, ok := ticketRequester(c, user, order.RequesterID)
+	if !ok {
+		return
+	}
+
+	ticket, err := models.OrderCatalogItem(id, order, requesterID)
+	if err != nil {
+		catalogError(c, err, "Error ordering catalog item")
+		return
+	}
+
+	log.Printf("Ticket %s ordered from catalog item %d by %s", ticket.Reference(), id, user.Email)
+	c.JSON(http.StatusCreated, ticket)
+}
+
+// GetCatalogItems handles listing every catalog item, inactive ones included (Admin only)
+func GetCatalogItems(c *gin.Context) {
+	items, err := models.GetCatalogItems(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching catalog"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// CreateCatalogItem handles adding an item to the service catalog (Admin only)
+func CreateCatalogItem(c *gin.Context) {
+	var req models.CatalogItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := models.CreateCatalogItem(req)
+	if err != nil {
+		catalogError(c, err, "Error creating catalog item")
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateCatalogItem handles updating a catalog item (Admin only)
+func UpdateCatalogItem(c *gin.Context) {
+	id, ok := parseID(c, "catalog item")
+	if !ok {
+		return
+	}
+
+	var req models.CatalogItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := models.UpdateCatalogItem(id, req)
+	if err != nil {
+		catalogError(c, err, "Error updating catalog item")
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteCatalogItem handles removing a catalog item (Admin only)
+func DeleteCatalogItem(c *gin.Context) {
+	id, ok := parseID(c, "catalog item")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteCatalogItem(id); err != nil {
+		catalogError(c, err, "Error deleting catalog item")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Catalog item deleted successfully"})
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// changeError maps change management errors to responses
+func changeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrChangeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidChangeStatus), errors.Is(err, models.ErrInvalidChangeLevel),
+		errors.Is(err, models.ErrInvalidChangeWindow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotCABMember), errors.Is(err, models.ErrChangeForbidden),
+		errors.Is(err, models.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrChangeLocked), errors.Is(err, models.ErrChangeNotSubmitted),
+		errors.Is(err, models.ErrChangeConflict), errors.Is(err, models.ErrInvalidTransition),
+		errors.Is(err, models.ErrChangeModified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// changeCalendarRange reads the from/to period of the change calendar,
+// defaulting to the past 30 and the next 90 days
+func changeCalendarRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	from, to := now.AddDate(0, 0, -30), now.AddDate(0, 0, 90)
+	if value, err := parseEventTime(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time, use RFC 3339 or YYYY-MM-DD"})
+		return from, to, false
+	} else if value != nil {
+		from = *value
+	}
+	if value, err := parseEventTime(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time, use RFC 3339 or YYYY-MM-DD"})
+		return from, to, false
+	} else if value != nil {
+		to = *value
+	}
+	return from, to, true
+}
+
+// GetChangeRequests handles listing change requests, filtered by status
+// and service (Agent only)
+func GetChangeRequests(c *gin.Context) {
+	changes, err := models.GetChangeRequests(c.Query("status"), c.Query("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching change requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// GetChangeRequest handles fetching a change request with its conflicts (Agent only)
+func GetChangeRequest(c *gin.Context) {
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	change, err := models.GetChangeRequestByID(id)
+	if err != nil {
+		changeError(c, err, "Error fetching change request")
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// CreateChangeRequest handles recording a draft change (Agent only)
+func CreateChangeRequest(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ChangeRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := models.CreateChangeRequest(req, user)
+	if err != nil {
+		changeError(c, err, "Error creating change request")
+		return
+	}
+
+	c.JSON(http.StatusCreated, change)
+}
+
+// UpdateChangeRequest handles editing a draft or rejected change (Agent only)
+func UpdateChangeRequest(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	var req models.ChangeRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := models.UpdateChangeRequest(id, req, user)
+	if err != nil {
+		changeError(c, err, "Error updating change request")
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// UpdateChangeStatus handles submitting, withdrawing, cancelling and
+// closing a change request (Agent only)
+func UpdateChangeStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	var req models.ChangeStatusChange
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := models.ChangeChangeStatus(id, req, user)
+	if err != nil {
+		changeError(c, err, "Error updating change status")
+		return
+	}
+
+	log.Printf("Change %s moved to %s by %s", change.Reference(), change.Status, user.Email)
+	c.JSON(http.StatusOK, change)
+}
+
+// decideChangeRequest records a CAB decision on a change request
+func decideChangeRequest(c *gin.Context, approve bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	var req models.CABDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	change, err := models.DecideChangeRequest(id, approve, req, user)
+	if err != nil {
+		changeError(c, err, "Error recording CAB decision")
+		return
+	}
+
+	log.Printf("Change %s %s by %s", change.Reference(), change.Status, user.Email)
+	c.JSON(http.StatusOK, change)
+}
+
+// ApproveChangeRequest handles the CAB approving a change (CAB members only)
+func ApproveChangeRequest(c *gin.Context) {
+	decideChangeRequest(c, true)
+}
+
+// RejectChangeRequest handles the CAB rejecting a change (CAB members only)
+func RejectChangeRequest(c *gin.Context) {
+	decideChangeRequest(c, false)
+}
+
+// DeleteChangeRequest handles removing a change request (Admin only)
+func DeleteChangeRequest(c *gin.Context) {
+	id, ok := parseID(c, "change request")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteChangeRequest(id); err != nil {
+		changeError(c, err, "Error deleting change request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Change request deleted successfully"})
+}
+
+// CheckChangeConflicts handles listing the scheduled changes to a service
+// that overlap a proposed window (Agent only)
+func CheckChangeConflicts(c *gin.Context) {
+	service := c.Query("service")
+	if service == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "service is required"})
+		return
+	}
+	start, startErr := parseEventTime(c.Query("window_start"))
+	end, endErr := parseEventTime(c.Query("window_end"))
+	if startErr != nil || endErr != nil || start == nil || end == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window_start and window_end are required, use RFC 3339 or YYYY-MM-DD"})
+		return
+	}
+	if !end.After(*start) {
+		changeError(c, models.ErrInvalidChangeWindow, "")
+		return
+	}
+
+	conflicts, err := models.FindChangeConflicts(service, *start, *end, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking conflicts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conflicts)
+}
+
+// GetChangeCalendar handles listing the scheduled changes of a period,
+// optionally for one service (Agent only)
+func GetChangeCalendar(c *gin.Context) {
+	from, to, ok := changeCalendarRange(c)
+	if !ok {
+		return
+	}
+
+	changes, err := models.GetChangeCalendar(from, to, c.Query("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching change calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// GetChangeCalendarFeed handles the iCalendar feed of the change calendar
+// (Public, authenticated with the feed token)
+func GetChangeCalendarFeed(c *gin.Context) {
+	from, to, ok := changeCalendarRange(c)
+	if !ok {
+		return
+	}
+
+	changes, err := models.GetChangeCalendar(from, to, c.Query("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching change calendar"})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="changes.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(models.ChangeCalendarICS(changes)))
+}
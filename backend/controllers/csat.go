@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// surveyError maps CSAT survey errors to responses
+func surveyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrSurveyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Survey not found"})
+	case errors.Is(err, models.ErrSurveyExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrSurveyAnswered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidCSATGroup), errors.Is(err, models.ErrInvalidCSATInterval):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetSurvey handles showing the survey behind a survey link (public)
+func GetSurvey(c *gin.Context) {
+	survey, err := models.GetCSATSurveyByToken(c.Param("token"))
+	if err != nil {
+		surveyError(c, err, "Error fetching survey")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":       survey.Ticket.Reference(),
+		"subject":      survey.Ticket.Subject,
+		"expires_at":   survey.ExpiresAt,
+		"expired":      time.Now().After(survey.ExpiresAt),
+		"score":        survey.Score,
+		"comment":      survey.Comment,
+		"responded_at": survey.RespondedAt,
+	})
+}
+
+// AnswerSurvey handles recording the score and comment of a survey (public)
+func AnswerSurvey(c *gin.Context) {
+	var response models.CSATResponse
+	if err := c.ShouldBindJSON(&response); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := models.SubmitCSATResponse(c.Param("token"), response); err != nil {
+		surveyError(c, err, "Error recording survey response")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thank you for your feedback"})
+}
+
+// GetTicketSurvey handles showing the satisfaction survey of a ticket (Agent only)
+func GetTicketSurvey(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	survey, err := models.GetTicketCSATSurvey(id)
+	if err != nil {
+		surveyError(c, err, "Error fetching survey")
+		return
+	}
+
+	c.JSON(http.StatusOK, survey)
+}
+
+// GetCSATReport handles aggregating satisfaction scores per agent, queue or
+// category and per day, week or month (Admin only)
+func GetCSATReport(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+
+	stats, err := models.GetCSATReport(
+		c.DefaultQuery("group_by", models.CSATGroupAgent),
+		c.DefaultQuery("interval", "week"),
+		time.Now().AddDate(0, 0, -days),
+	)
+	if err != nil {
+		surveyError(c, err, "Error building CSAT report")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customFieldError maps custom field errors to responses
+func customFieldError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrCustomFieldNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidFieldEntity), errors.Is(err, models.ErrInvalidCategory),
+		errors.Is(err, models.ErrInvalidFieldKey), errors.Is(err, models.ErrInvalidFieldType),
+		errors.Is(err, models.ErrFieldOptionsRequired), errors.Is(err, models.ErrFieldImmutable),
+		errors.Is(err, models.ErrInvalidFieldValue):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrFieldKeyTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// customFieldQuery collects custom field filters given as cf.<key>=value
+// query parameters
+func customFieldQuery(c *gin.Context) map[string]string {
+	filters := map[string]string{}
+	for name, values := range c.Request.URL.Query() {
+		if key, ok := strings.CutPrefix(name, "cf."); ok && key != "" && len(values) > 0 && values[0] != "" {
+			filters[key] = values[0]
+		}
+	}
+	return filters
+}
+
+// GetCustomFields handles listing the custom fields of tickets or articles,
+// optionally of one category
+func GetCustomFields(c *gin.Context) {
+	fields, err := models.GetCustomFields(c.Query("entity"), c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching custom fields"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fields)
+}
+
+// CreateCustomField handles adding a custom field to a category (Admin only)
+func CreateCustomField(c *gin.Context) {
+	var req models.CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	field, err := models.CreateCustomField(req)
+	if err != nil {
+		customFieldError(c, err, "Error creating custom field")
+		return
+	}
+
+	c.JSON(http.StatusCreated, field)
+}
+
+// UpdateCustomField handles changing a custom field (Admin only)
+func UpdateCustomField(c *gin.Context) {
+	id, ok := parseID(c, "custom field")
+	if !ok {
+		return
+	}
+
+	var req models.CustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	field, err := models.UpdateCustomField(id, req)
+	if err != nil {
+		customFieldError(c, err, "Error updating custom field")
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
+}
+
+// DeleteCustomField handles removing a custom field and its values (Admin only)
+func DeleteCustomField(c *gin.Context) {
+	id, ok := parseID(c, "custom field")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteCustomField(id); err != nil {
+		customFieldError(c, err, "Error deleting custom field")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field deleted successfully"})
+}
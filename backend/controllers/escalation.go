@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// escalationError maps escalation rule errors to HTTP responses
+func escalationError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrEscalationRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Escalation rule not found"})
+	case errors.Is(err, models.ErrInvalidTrigger), errors.Is(err, models.ErrNoEscalationAction),
+		errors.Is(err, models.ErrInvalidPriority), errors.Is(err, models.ErrInvalidCategory),
+		errors.Is(err, models.ErrCalendarNotFound), errors.Is(err, models.ErrQueueNotFound),
+		errors.Is(err, models.ErrInvalidAssignee), errors.Is(err, models.ErrUserNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Escalation rule operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetEscalationRules handles listing escalation rules (Admin only)
+func GetEscalationRules(c *gin.Context) {
+	rules, err := models.GetEscalationRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching escalation rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateEscalationRule handles creating an escalation rule (Admin only)
+func CreateEscalationRule(c *gin.Context) {
+	var req models.EscalationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := models.CreateEscalationRule(req)
+	if err != nil {
+		escalationError(c, err, "Error creating escalation rule")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateEscalationRule handles updating an escalation rule (Admin only)
+func UpdateEscalationRule(c *gin.Context) {
+	id, ok := parseID(c, "escalation rule")
+	if !ok {
+		return
+	}
+
+	var req models.EscalationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := models.UpdateEscalationRule(id, req)
+	if err != nil {
+		escalationError(c, err, "Error updating escalation rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteEscalationRule handles deleting an escalation rule (Admin only)
+func DeleteEscalationRule(c *gin.Context) {
+	id, ok := parseID(c, "escalation rule")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteEscalationRule(id); err != nil {
+		escalationError(c, err, "Error deleting escalation rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Escalation rule deleted"})
+}
+
+// GetTicketEscalations handles listing the escalation log of a ticket (Agent only)
+func GetTicketEscalations(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := models.GetTicketByID(id); err != nil {
+		ticketError(c, err, "Error fetching escalations")
+		return
+	}
+
+	logs, err := models.GetTicketEscalations(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching escalations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// AddTicketWatcher handles making a user follow a ticket (Agent only).
+// Without a user_id the current agent starts watching.
+func AddTicketWatcher(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.UserID == 0 {
+		input.UserID = user.ID
+	}
+
+	if _, err := models.GetTicketByID(id); err != nil {
+		ticketError(c, err, "Error adding watcher")
+		return
+	}
+	if err := models.AddTicketWatcher(id, input.UserID); err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding watcher"})
+		return
+	}
+
+	ticket, err := models.GetTicketByID(id)
+	if err != nil {
+		ticketError(c, err, "Error fetching ticket")
+		return
+	}
+	c.JSON(http.StatusOK, ticket)
+}
+
+// RemoveTicketWatcher handles removing a watcher from a ticket (Agent only)
+func RemoveTicketWatcher(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if _, err := models.GetTicketByID(id); err != nil {
+		ticketError(c, err, "Error removing watcher")
+		return
+	}
+	if err := models.RemoveTicketWatcher(id, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing watcher"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watcher removed"})
+}
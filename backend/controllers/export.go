@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeCSV sends records as a CSV download
+func writeCSV(c *gin.Context, name string, records [][]string) {
+	filename := fmt.Sprintf("%s-%s.csv", name, time.Now().Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.WriteAll(records); err != nil {
+		log.Printf("Warning: Could not write %s: %v", filename, err)
+	}
+}
+
+// ExportTickets handles downloading the tickets matching the list filters
+// as CSV, custom fields included (Agent only)
+func ExportTickets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	filter, ok := ticketFilter(c, user)
+	if !ok {
+		return
+	}
+
+	records, err := models.ExportTickets(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting tickets"})
+		return
+	}
+
+	writeCSV(c, "tickets", records)
+}
+
+// ExportArticles handles downloading knowledge articles as CSV, custom
+// fields included (Admin only)
+func ExportArticles(c *gin.Context) {
+	records, err := models.ExportArticles(c.Query("category"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting articles"})
+		return
+	}
+
+	writeCSV(c, "articles", records)
+}
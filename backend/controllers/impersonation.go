@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/middleware"
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartImpersonation handles issuing a time-boxed token to act as another user (Admin only)
+func StartImpersonation(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason for impersonating is required"})
+		return
+	}
+
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := models.StartImpersonation(adminID.(uint), uint(targetID), input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, models.ErrImpersonationNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			log.Printf("StartImpersonation: Failed to start session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting impersonation"})
+		}
+		return
+	}
+
+	token, err := middleware.GenerateImpersonationToken(*session)
+	if err != nil {
+		log.Printf("StartImpersonation: Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	log.Printf("Impersonation started: %s acting as %s (session %d): %s",
+		session.Admin.Email, session.TargetUser.Email, session.ID, session.Reason)
+	recordSecurityEvent(c, &session.TargetUserID, session.TargetUser.Email, models.SecurityEventImpersonationStarted,
+		fmt.Sprintf("by %s (session %d): %s", session.Admin.Email, session.ID, session.Reason))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":   token,
+		"session": session,
+		"user": gin.H{
+			"user_id": session.TargetUser.ID,
+			"email":   session.TargetUser.Email,
+			"role":    session.TargetUser.Role,
+		},
+	})
+}
+
+// EndImpersonation handles ending the impersonation session of the current token
+func EndImpersonation(c *gin.Context) {
+	sessionID, exists := c.Get("impersonation_session_id")
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating a user"})
+		return
+	}
+
+	session, err := models.GetImpersonationSession(sessionID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation session not found"})
+		return
+	}
+
+	if err := models.EndImpersonation(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error ending impersonation"})
+		return
+	}
+
+	log.Printf("Impersonation ended: %s stopped acting as %s (session %d)",
+		session.Admin.Email, session.TargetUser.Email, session.ID)
+	recordSecurityEvent(c, &session.TargetUserID, session.TargetUser.Email, models.SecurityEventImpersonationEnded,
+		fmt.Sprintf("by %s (session %d)", session.Admin.Email, session.ID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+// GetImpersonationSessions handles listing impersonation sessions (Admin only)
+func GetImpersonationSessions(c *gin.Context) {
+	adminID, _ := strconv.ParseUint(c.Query("admin_id"), 10, 64)
+	targetID, _ := strconv.ParseUint(c.Query("user_id"), 10, 64)
+
+	sessions, err := models.GetImpersonationSessions(uint(adminID), uint(targetID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching impersonation sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetImpersonationSession handles fetching a session with its full request log (Admin only)
+func GetImpersonationSession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := models.GetImpersonationSessionWithActions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/mailer"
+	"supportdesk/middleware"
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendInvitationEmail emails the invite link to the invitee
+func sendInvitationEmail(invitation *models.Invitation, token string) {
+	link := mailer.Link("/invite/" + token)
+	body := fmt.Sprintf(
+		"You have been invited to the Support Desk as %s.\n\nSet your password here: %s\n\nThis link expires on %s.",
+		invitation.Role, link, invitation.ExpiresAt.Format("2006-01-02 15:04 MST"),
+	)
+	if err := mailer.Send(invitation.Email, "You're invited to the Support Desk", body); err != nil {
+		log.Printf("Warning: Could not send invitation email to %s: %v", invitation.Email, err)
+	}
+}
+
+// CreateInvitation handles inviting a new user by email (Admin only)
+func CreateInvitation(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = "user"
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invitation, token, err := models.CreateInvitation(input.Email, input.Role, userID.(uint))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, models.ErrEmailRegistered), errors.Is(err, models.ErrInvitationExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("CreateInvitation: Failed to create invitation for %s: %v", input.Email, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invitation"})
+		}
+		return
+	}
+
+	sendInvitationEmail(invitation, token)
+	log.Printf("Invitation created for %s with role %s", invitation.Email, invitation.Role)
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// GetInvitations handles listing invitations (Admin only)
+func GetInvitations(c *gin.Context) {
+	invitations, err := models.GetInvitations(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// ResendInvitation handles sending a fresh invite link (Admin only)
+func ResendInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, token, err := models.ResendInvitation(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvitationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		case errors.Is(err, models.ErrInvitationInvalid):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invitation has already been accepted or revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resending invitation"})
+		}
+		return
+	}
+
+	sendInvitationEmail(invitation, token)
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// RevokeInvitation handles revoking a pending invitation (Admin only)
+func RevokeInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, err := models.RevokeInvitation(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvitationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		case errors.Is(err, models.ErrInvitationInvalid):
+			c.JSON(http.StatusConflict, gin.H{"error": "Invitation has already been accepted or revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking invitation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+// GetInvitation handles looking up an invitation by its token (public)
+func GetInvitation(c *gin.Context) {
+	invitation, err := models.GetPendingInvitationByToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation handles setting a password for an invitation and logging the user in (public)
+func AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := models.AcceptInvitation(c.Param("token"), input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvitationNotFound), errors.Is(err, models.ErrInvitationInvalid):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or expired"})
+		case errors.Is(err, models.ErrEmailRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("AcceptInvitation: Failed to accept invitation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error accepting invitation"})
+		}
+		return
+	}
+
+	tokenString, err := middleware.GenerateToken(*user)
+	if err != nil {
+		log.Printf("AcceptInvitation: Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	log.Printf("Invitation accepted, new user: %s with role: %s", user.Email, user.Role)
+	recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventLoginSucceeded, "invitation accepted")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token": tokenString,
+		"user": gin.H{
+			"user_id": user.ID,
+			"email":   user.Email,
+			"role":    user.Role,
+		},
+	})
+}
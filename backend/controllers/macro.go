@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMacros handles listing the macros the agent may use (Agent only)
+func GetMacros(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	queueID, ok := queueFilter(c)
+	if !ok {
+		return
+	}
+
+	macros, err := models.GetMacros(user, queueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching macros"})
+		return
+	}
+
+	c.JSON(http.StatusOK, macros)
+}
+
+// CreateMacro handles creating a personal or shared macro (Agent only)
+func CreateMacro(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.MacroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	macro, err := models.CreateMacro(req, user)
+	if err != nil {
+		cannedError(c, err, "Error creating macro")
+		return
+	}
+
+	c.JSON(http.StatusCreated, macro)
+}
+
+// UpdateMacro handles updating a macro (Agent only)
+func UpdateMacro(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "macro")
+	if !ok {
+		return
+	}
+
+	var req models.MacroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	macro, err := models.UpdateMacro(id, req, user)
+	if err != nil {
+		cannedError(c, err, "Error updating macro")
+		return
+	}
+
+	c.JSON(http.StatusOK, macro)
+}
+
+// DeleteMacro handles deleting a macro (Agent only)
+func DeleteMacro(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "macro")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteMacro(id, user); err != nil {
+		cannedError(c, err, "Error deleting macro")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Macro deleted"})
+}
+
+// ApplyMacro handles applying a macro to a ticket (Agent only)
+func ApplyMacro(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	macroID, err := strconv.ParseUint(c.Param("macro_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid macro ID"})
+		return
+	}
+
+	ticket, err := models.ApplyMacro(id, uint(macroID), user)
+	if err != nil {
+		cannedError(c, err, "Error applying macro")
+		return
+	}
+
+	log.Printf("Macro %d applied to %s by %s", macroID, ticket.Reference(), user.Email)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// GetMacroUsage handles reporting how often macros were applied (Admin only).
+// Query: days (default 30).
+func GetMacroUsage(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+
+	stats, err := models.GetMacroUsage(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building macro usage report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
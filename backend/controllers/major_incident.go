@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// incidentError maps major incident errors to responses
+func incidentError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrLinkToSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotMajorIncident), errors.Is(err, models.ErrAlreadyMajorIncident),
+		errors.Is(err, models.ErrIncidentChild), errors.Is(err, models.ErrNotIncidentChild):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ticketError(c, err, fallback)
+	}
+}
+
+// GetMajorIncidents handles listing the open major incidents (Agent only)
+func GetMajorIncidents(c *gin.Context) {
+	tickets, err := models.GetMajorIncidents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching major incidents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// DeclareMajorIncident handles declaring a ticket a major incident (Agent only)
+func DeclareMajorIncident(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.MajorIncidentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ticket, err := models.DeclareMajorIncident(id, req, user)
+	if err != nil {
+		incidentError(c, err, "Error declaring major incident")
+		return
+	}
+
+	log.Printf("Major incident %s declared by %s", ticket.Reference(), user.Email)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// GetIncidentChildren handles listing the tickets linked to a major incident (Agent only)
+func GetIncidentChildren(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	children, err := models.GetIncidentChildren(id)
+	if err != nil {
+		incidentError(c, err, "Error fetching child tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, children)
+}
+
+// LinkIncidentChildren handles linking tickets to a major incident (Agent only)
+func LinkIncidentChildren(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.IncidentLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	children, err := models.LinkIncidentChildren(id, req, user)
+	if err != nil {
+		incidentError(c, err, "Error linking child tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, children)
+}
+
+// UnlinkIncidentChild handles detaching a ticket from a major incident (Agent only)
+func UnlinkIncidentChild(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	childID, err := strconv.ParseUint(c.Param("child_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid child ticket ID"})
+		return
+	}
+
+	if err := models.UnlinkIncidentChild(id, uint(childID), user); err != nil {
+		incidentError(c, err, "Error unlinking child ticket")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Child ticket unlinked successfully"})
+}
+
+// GetIncidentTimeline handles listing the timeline of a major incident (Agent only)
+func GetIncidentTimeline(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	updates, err := models.GetIncidentTimeline(id)
+	if err != nil {
+		incidentError(c, err, "Error fetching timeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, updates)
+}
+
+// PostIncidentUpdate handles adding an update to the timeline of a major
+// incident, optionally broadcast to the child requesters (Agent only)
+func PostIncidentUpdate(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.IncidentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update, err := models.PostIncidentUpdate(id, req, user)
+	if err != nil {
+		incidentError(c, err, "Error posting update")
+		return
+	}
+
+	c.JSON(http.StatusCreated, update)
+}
+
+// ResolveMajorIncident handles resolving a major incident together with its
+// child tickets (Agent only)
+func ResolveMajorIncident(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.IncidentResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.ResolveMajorIncident(id, req, user)
+	if err != nil {
+		incidentError(c, err, "Error resolving major incident")
+		return
+	}
+
+	log.Printf("Major incident %s resolved by %s", ticket.Reference(), user.Email)
+	c.JSON(http.StatusOK, ticket)
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemError maps problem management errors to responses
+func problemError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrProblemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidProblemStatus), errors.Is(err, models.ErrArticleNotIssue),
+		errors.Is(err, models.ErrInvalidOwner), errors.Is(err, models.ErrWorkaroundRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrNotKnownError):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ticketError(c, err, fallback)
+	}
+}
+
+// GetProblems handles listing problem records, filtered by status,
+// category and a search text in q (Agent only)
+func GetProblems(c *gin.Context) {
+	problems, err := models.GetProblems(c.Query("status"), c.Query("category"), c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching problems"})
+		return
+	}
+
+	c.JSON(http.StatusOK, problems)
+}
+
+// GetKnownErrors handles searching the known-error database (Agent only)
+func GetKnownErrors(c *gin.Context) {
+	problems, err := models.GetProblems(models.ProblemStatusKnownError, c.Query("category"), c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching known errors"})
+		return
+	}
+
+	c.JSON(http.StatusOK, problems)
+}
+
+// GetProblem handles fetching a problem record (Agent only)
+func GetProblem(c *gin.Context) {
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	problem, err := models.GetProblemByID(id)
+	if err != nil {
+		problemError(c, err, "Error fetching problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, problem)
+}
+
+// CreateProblem handles recording a problem (Agent only)
+func CreateProblem(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ProblemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problem, err := models.CreateProblem(req, user)
+	if err != nil {
+		problemError(c, err, "Error creating problem")
+		return
+	}
+
+	c.JSON(http.StatusCreated, problem)
+}
+
+// UpdateProblem handles updating a problem's details, root cause and
+// workaround (Agent only)
+func UpdateProblem(c *gin.Context) {
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	var req models.ProblemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problem, err := models.UpdateProblem(id, req)
+	if err != nil {
+		problemError(c, err, "Error updating problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, problem)
+}
+
+// UpdateProblemStatus handles moving a problem to investigation, known
+// error or resolved (Agent only)
+func UpdateProblemStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	var change models.ProblemStatusChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	problem, err := models.ChangeProblemStatus(id, change)
+	if err != nil {
+		problemError(c, err, "Error updating problem status")
+		return
+	}
+
+	log.Printf("Problem %d moved to %s by %s", problem.ID, problem.Status, user.Email)
+	c.JSON(http.StatusOK, problem)
+}
+
+// DeleteProblem handles removing a problem record (Admin only)
+func DeleteProblem(c *gin.Context) {
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteProblem(id); err != nil {
+		problemError(c, err, "Error deleting problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Problem deleted successfully"})
+}
+
+// GetProblemTickets handles listing the incidents attributed to a problem (Agent only)
+func GetProblemTickets(c *gin.Context) {
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	tickets, err := models.GetProblemTickets(id)
+	if err != nil {
+		problemError(c, err, "Error fetching problem tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// LinkProblemTickets handles attributing tickets to a problem (Agent only)
+func LinkProblemTickets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+
+	var req models.ProblemLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tickets, err := models.LinkProblemTickets(id, req, user)
+	if err != nil {
+		problemError(c, err, "Error linking tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// UnlinkProblemTicket handles no longer attributing a ticket to a problem (Agent only)
+func UnlinkProblemTicket(c *gin.Context) {
+	id, ok := parseID(c, "problem")
+	if !ok {
+		return
+	}
+	ticketID, err := strconv.ParseUint(c.Param("ticket_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	if err := models.UnlinkProblemTicket(id, uint(ticketID)); err != nil {
+		problemError(c, err, "Error unlinking ticket")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ticket unlinked successfully"})
+}
+
+// GetTicketKnownErrors handles suggesting known errors for a ticket (Agent only)
+func GetTicketKnownErrors(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	problems, err := models.FindKnownErrors(ticket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching known errors"})
+		return
+	}
+
+	c.JSON(http.StatusOK, problems)
+}
+
+// ApplyWorkaround handles posting the workaround of a known error on a
+// ticket (Agent only)
+func ApplyWorkaround(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	problemID, err := strconv.ParseUint(c.Param("problem_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+		return
+	}
+
+	var req models.WorkaroundRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	message, err := models.ApplyWorkaround(id, uint(problemID), req, user)
+	if err != nil {
+		problemError(c, err, "Error applying workaround")
+		return
+	}
+
+	c.JSON(http.StatusCreated, message)
+}
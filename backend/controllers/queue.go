@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queueError maps queue and routing rule errors to HTTP responses
+func queueError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrQueueNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Queue not found"})
+	case errors.Is(err, models.ErrRoutingRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Routing rule not found"})
+	case errors.Is(err, models.ErrQueueExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidStrategy), errors.Is(err, models.ErrInvalidQueueMember),
+		errors.Is(err, models.ErrInvalidCategory), errors.Is(err, models.ErrInvalidPriority):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Queue operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// parseID parses the :id route parameter, reporting what kind of ID was invalid
+func parseID(c *gin.Context, kind string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + kind + " ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetQueues handles listing queues with their members (Agent only)
+func GetQueues(c *gin.Context) {
+	queues, err := models.GetQueues()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching queues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, queues)
+}
+
+// CreateQueue handles creating a queue (Admin only)
+func CreateQueue(c *gin.Context) {
+	var req models.QueueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queue, err := models.CreateQueue(req)
+	if err != nil {
+		queueError(c, err, "Error creating queue")
+		return
+	}
+
+	c.JSON(http.StatusCreated, queue)
+}
+
+// UpdateQueue handles replacing a queue's settings and members (Admin only)
+func UpdateQueue(c *gin.Context) {
+	id, ok := parseID(c, "queue")
+	if !ok {
+		return
+	}
+
+	var req models.QueueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queue, err := models.UpdateQueue(id, req)
+	if err != nil {
+		queueError(c, err, "Error updating queue")
+		return
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// DeleteQueue handles deleting a queue (Admin only)
+func DeleteQueue(c *gin.Context) {
+	id, ok := parseID(c, "queue")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteQueue(id); err != nil {
+		queueError(c, err, "Error deleting queue")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Queue deleted"})
+}
+
+// GetQueueDepths handles reporting open tickets per queue (Admin only)
+func GetQueueDepths(c *gin.Context) {
+	depths, err := models.GetQueueDepths()
+	if err != nil {
+		log.Printf("GetQueueDepths: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching queue depth"})
+		return
+	}
+
+	c.JSON(http.StatusOK, depths)
+}
+
+// GetRoutingRules handles listing routing rules in evaluation order (Admin only)
+func GetRoutingRules(c *gin.Context) {
+	rules, err := models.GetRoutingRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching routing rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRoutingRule handles creating a routing rule (Admin only)
+func CreateRoutingRule(c *gin.Context) {
+	var req models.RoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := models.CreateRoutingRule(req)
+	if err != nil {
+		queueError(c, err, "Error creating routing rule")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRoutingRule handles updating a routing rule (Admin only)
+func UpdateRoutingRule(c *gin.Context) {
+	id, ok := parseID(c, "routing rule")
+	if !ok {
+		return
+	}
+
+	var req models.RoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := models.UpdateRoutingRule(id, req)
+	if err != nil {
+		queueError(c, err, "Error updating routing rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRoutingRule handles deleting a routing rule (Admin only)
+func DeleteRoutingRule(c *gin.Context) {
+	id, ok := parseID(c, "routing rule")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteRoutingRule(id); err != nil {
+		queueError(c, err, "Error deleting routing rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Routing rule deleted"})
+}
@@ -0,0 +1,1058 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	scimUserSchema       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimEnterpriseSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	scimGroupSchema      = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema       = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema      = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// scimEnterpriseUser holds the enterprise extension attributes we map
+type scimEnterpriseUser struct {
+	Department string `json:"department,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type scimUser struct {
+	Schemas     []string            `json:"schemas"`
+	ID          string              `json:"id,omitempty"`
+	ExternalID  string              `json:"externalId,omitempty"`
+	UserName    string              `json:"userName"`
+	Name        *scimName           `json:"name,omitempty"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Emails      []scimMultiValue    `json:"emails,omitempty"`
+	Active      *bool               `json:"active,omitempty"`
+	Password    string              `json:"password,omitempty"` // Write-only, never returned
+	Roles       []scimMultiValue    `json:"roles,omitempty"`
+	Groups      []scimMultiValue    `json:"groups,omitempty"`
+	Enterprise  *scimEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *scimMeta           `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []scimMultiValue `json:"members"`
+	Meta        *scimMeta        `json:"meta,omitempty"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string `json:"schemas"`
+	Operations []struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	} `json:"Operations"`
+}
+
+// scimFilter is a single "attribute operator value" comparison
+type scimFilter struct {
+	Attribute string
+	Operator  string
+	Value     string
+}
+
+var (
+	scimFilterPattern = regexp.MustCompile(`(?i)^\s*([\w.$\[\]" ]+?)\s+(eq|ne|co|sw|ew|pr)(?:\s+(?:"((?:[^"\\]|\\.)*)"|(\S+)))?\s*$`)
+	scimValuePath     = regexp.MustCompile(`\[[^\]]*\]`)
+	scimQuoted        = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|\[[^\]]*\]`)
+	scimUnsupported   = regexp.MustCompile(`(?i)(^|\s)(or|not)(\s|$)|\(`)
+	scimAnd           = regexp.MustCompile(`(?i)\s+and\s+`)
+	scimMemberPath    = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]+)"\s*\]$`)
+
+	// Filterable attributes mapped to their columns
+	scimUserColumns = map[string]string{
+		"id":              "id",
+		"username":        "email",
+		"emails":          "email",
+		"emails.value":    "email",
+		"externalid":      "external_id",
+		"displayname":     "name",
+		"name.givenname":  "given_name",
+		"name.familyname": "family_name",
+		"active":          "active",
+		"department":      "department",
+	}
+	scimGroupColumns = map[string]string{
+		"id":          "id",
+		"displayname": "display_name",
+		"externalid":  "external_id",
+	}
+)
+
+// scimJSON writes a response with the SCIM media type
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+// scimError writes a SCIM error response
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+// scimLocation builds the absolute URL of a SCIM resource
+func scimLocation(c *gin.Context, resource string, id uint) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%d", scheme, c.Request.Host, resource, id)
+}
+
+func toSCIMUser(c *gin.Context, user *models.User) scimUser {
+	active := user.Active
+	resource := scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          strconv.FormatUint(uint64(user.ID), 10),
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		DisplayName: user.Name,
+		Emails:      []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []scimMultiValue{{Value: user.Role, Primary: true}},
+		Groups:      []scimMultiValue{},
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimLocation(c, "Users", user.ID),
+		},
+	}
+	if user.Department != "" {
+		resource.Schemas = append(resource.Schemas, scimEnterpriseSchema)
+		resource.Enterprise = &scimEnterpriseUser{Department: user.Department}
+	}
+	if user.GivenName != "" || user.FamilyName != "" {
+		resource.Name = &scimName{
+			Formatted:  strings.TrimSpace(user.GivenName + " " + user.FamilyName),
+			GivenName:  user.GivenName,
+			FamilyName: user.FamilyName,
+		}
+	}
+	for _, group := range user.Groups {
+		resource.Groups = append(resource.Groups, scimMultiValue{
+			Value:   strconv.FormatUint(uint64(group.ID), 10),
+			Display: group.DisplayName,
+			Ref:     scimLocation(c, "Groups", group.ID),
+		})
+	}
+	return resource
+}
+
+func toSCIMGroup(c *gin.Context, group *models.Group) scimGroup {
+	resource := scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          strconv.FormatUint(uint64(group.ID), 10),
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     []scimMultiValue{},
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     scimLocation(c, "Groups", group.ID),
+		},
+	}
+	for _, member := range group.Members {
+		resource.Members = append(resource.Members, scimMultiValue{
+			Value:   strconv.FormatUint(uint64(member.ID), 10),
+			Display: member.Email,
+			Ref:     scimLocation(c, "Users", member.ID),
+		})
+	}
+	return resource
+}
+
+// parseSCIMFilter parses filters of the form `attr op "value" [and ...]`
+func parseSCIMFilter(filter string) ([]scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	// Blank out quoted values and value paths so keywords inside them are ignored
+	masked := scimQuoted.ReplaceAllStringFunc(filter, func(match string) string {
+		return strings.Repeat("x", len(match))
+	})
+	if scimUnsupported.MatchString(masked) {
+		return nil, errors.New("only 'and' combinations of simple comparisons are supported")
+	}
+
+	var parts []string
+	start := 0
+	for _, loc := range scimAnd.FindAllStringIndex(masked, -1) {
+		parts = append(parts, filter[start:loc[0]])
+		start = loc[1]
+	}
+	parts = append(parts, filter[start:])
+
+	var filters []scimFilter
+	for _, part := range parts {
+		match := scimFilterPattern.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("invalid filter expression: %s", part)
+		}
+		value := match[3]
+		if value == "" {
+			value = match[4]
+		}
+		if strings.ToLower(match[2]) != "pr" && match[3] == "" && match[4] == "" {
+			return nil, fmt.Errorf("missing comparison value: %s", part)
+		}
+		filters = append(filters, scimFilter{
+			Attribute: strings.ToLower(scimValuePath.ReplaceAllString(strings.TrimSpace(match[1]), "")),
+			Operator:  strings.ToLower(match[2]),
+			Value:     strings.ReplaceAll(value, `\"`, `"`),
+		})
+	}
+	return filters, nil
+}
+
+// applySCIMFilters adds the filter comparisons to a query
+func applySCIMFilters(query *gorm.DB, filters []scimFilter, columns map[string]string) (*gorm.DB, error) {
+	for _, filter := range filters {
+		attribute := strings.TrimPrefix(filter.Attribute, strings.ToLower(scimUserSchema)+":")
+		attribute = strings.TrimPrefix(attribute, strings.ToLower(scimEnterpriseSchema)+":")
+		column, ok := columns[attribute]
+		if !ok {
+			return nil, fmt.Errorf("filtering on %q is not supported", filter.Attribute)
+		}
+
+		if column == "active" {
+			active, err := strconv.ParseBool(filter.Value)
+			if err != nil && filter.Operator != "pr" {
+				return nil, fmt.Errorf("invalid boolean value: %s", filter.Value)
+			}
+			switch filter.Operator {
+			case "eq":
+				query = query.Where("active = ?", active)
+			case "ne":
+				query = query.Where("active <> ?", active)
+			case "pr":
+			default:
+				return nil, fmt.Errorf("operator %q is not supported for active", filter.Operator)
+			}
+			continue
+		}
+
+		if column == "id" {
+			id, err := strconv.ParseUint(filter.Value, 10, 64)
+			if err != nil || filter.Operator != "eq" {
+				return nil, errors.New("id only supports eq with a numeric value")
+			}
+			query = query.Where("id = ?", id)
+			continue
+		}
+
+		// String attributes in SCIM core schemas compare case-insensitively
+		lowered := fmt.Sprintf("LOWER(%s)", column)
+		value := strings.ToLower(filter.Value)
+		switch filter.Operator {
+		case "eq":
+			query = query.Where(lowered+" = ?", value)
+		case "ne":
+			query = query.Where(lowered+" <> ?", value)
+		case "co":
+			query = query.Where(lowered+" LIKE ?", "%"+escapeLike(value)+"%")
+		case "sw":
+			query = query.Where(lowered+" LIKE ?", escapeLike(value)+"%")
+		case "ew":
+			query = query.Where(lowered+" LIKE ?", "%"+escapeLike(value))
+		case "pr":
+			query = query.Where(column + " IS NOT NULL AND " + column + " <> ''")
+		}
+	}
+	return query, nil
+}
+
+// escapeLike escapes LIKE wildcards in a user-supplied value
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// scimPagination reads the 1-based startIndex and count parameters
+func scimPagination(c *gin.Context) (int, int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func scimListResponse(total int64, startIndex int, resources interface{}, itemsPerPage int) gin.H {
+	return gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": itemsPerPage,
+		"Resources":    resources,
+	}
+}
+
+func scimID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "Resource not found")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// randomPassword is used for provisioned users that did not receive a password
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// primaryEmail picks the login email from userName or the primary email
+func (u *scimUser) primaryEmail() string {
+	if u.UserName != "" {
+		return strings.ToLower(strings.TrimSpace(u.UserName))
+	}
+	for _, email := range u.Emails {
+		if email.Primary {
+			return strings.ToLower(strings.TrimSpace(email.Value))
+		}
+	}
+	if len(u.Emails) > 0 {
+		return strings.ToLower(strings.TrimSpace(u.Emails[0].Value))
+	}
+	return ""
+}
+
+// primaryValue returns the value marked primary in a multi-valued
+// attribute, or else the first one; empty when there are none
+func primaryValue(values []scimMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// profile converts the SCIM representation into the model's profile
+func (u *scimUser) profile() models.UserProfile {
+	profile := models.UserProfile{
+		Email:      u.primaryEmail(),
+		Role:       primaryValue(u.Roles),
+		Name:       u.DisplayName,
+		ExternalID: u.ExternalID,
+		Active:     u.Active == nil || *u.Active,
+	}
+	if u.Name != nil {
+		profile.GivenName = u.Name.GivenName
+		profile.FamilyName = u.Name.FamilyName
+		if profile.Name == "" {
+			profile.Name = u.Name.Formatted
+		}
+	}
+	if u.Enterprise != nil {
+		profile.Department = strings.TrimSpace(u.Enterprise.Department)
+	}
+	return profile
+}
+
+func scimUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		scimError(c, http.StatusNotFound, "", "User not found")
+	case errors.Is(err, models.ErrEmailRegistered):
+		scimError(c, http.StatusConflict, "uniqueness", "userName is already in use")
+	case errors.Is(err, models.ErrInvalidRole):
+		scimError(c, http.StatusBadRequest, "invalidValue", "Unknown role")
+	default:
+		log.Printf("SCIM: User operation failed: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Internal server error")
+	}
+}
+
+func scimGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrGroupNotFound):
+		scimError(c, http.StatusNotFound, "", "Group not found")
+	case errors.Is(err, models.ErrGroupExists):
+		scimError(c, http.StatusConflict, "uniqueness", "displayName is already in use")
+	case errors.Is(err, models.ErrUserNotFound):
+		scimError(c, http.StatusBadRequest, "invalidValue", "Unknown member")
+	default:
+		log.Printf("SCIM: Group operation failed: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Internal server error")
+	}
+}
+
+// SCIMServiceProviderConfig describes the supported SCIM features
+func SCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": true},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with the dedicated SCIM bearer token",
+			"primary":     true,
+		}},
+	})
+}
+
+// SCIMListUsers handles listing users with filtering and pagination
+func SCIMListUsers(c *gin.Context) {
+	filters, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	query, err := applySCIMFilters(models.DB.Model(&models.User{}), filters, scimUserColumns)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Error counting users")
+		return
+	}
+
+	startIndex, count := scimPagination(c)
+	var users []models.User
+	if count > 0 {
+		if err := query.Preload("Groups").Order("id").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching users")
+			return
+		}
+	}
+
+	resources := make([]scimUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, toSCIMUser(c, &users[i]))
+	}
+	scimJSON(c, http.StatusOK, scimListResponse(total, startIndex, resources, len(resources)))
+}
+
+// SCIMGetUser handles fetching a single user
+func SCIMGetUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var user models.User
+	if err := models.DB.Preload("Groups").First(&user, id).Error; err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(c, &user))
+}
+
+// SCIMCreateUser handles provisioning a new user
+func SCIMCreateUser(c *gin.Context) {
+	var input scimUser
+	if err := c.ShouldBindJSON(&input); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	profile := input.profile()
+	if profile.Email == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	password := input.Password
+	if password == "" {
+		generated, err := randomPassword()
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error generating password")
+			return
+		}
+		password = generated
+	}
+
+	user, err := models.ProvisionUser(profile, password)
+	if err != nil {
+		scimUserError(c, err)
+		return
+	}
+
+	log.Printf("SCIM: Provisioned user %s with role %s", user.Email, user.Role)
+	scimJSON(c, http.StatusCreated, toSCIMUser(c, user))
+}
+
+// SCIMReplaceUser handles a full replacement of a user (PUT)
+func SCIMReplaceUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var input scimUser
+	if err := c.ShouldBindJSON(&input); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	profile := input.profile()
+	if profile.Email == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	user, err := models.UpdateUserProfile(id, profile)
+	if err != nil {
+		scimUserError(c, err)
+		return
+	}
+	if input.Password != "" {
+		if err := models.SetUserPassword(user.ID, input.Password); err != nil {
+			scimUserError(c, err)
+			return
+		}
+		recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventPasswordChanged, "set by SCIM provisioning")
+	}
+
+	respondSCIMUser(c, user.ID)
+}
+
+// SCIMPatchUser handles partial updates of a user
+func SCIMPatchUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var patch scimPatchRequest
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user, err := models.GetUserByID(id)
+	if err != nil {
+		scimUserError(c, err)
+		return
+	}
+
+	profile := models.ProfileOf(user)
+	password := ""
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "Unsupported patch operation: "+operation.Op)
+			return
+		}
+
+		values := map[string]interface{}{}
+		if operation.Path == "" {
+			attributes, ok := operation.Value.(map[string]interface{})
+			if !ok {
+				scimError(c, http.StatusBadRequest, "invalidValue", "Patch without a path needs an object value")
+				return
+			}
+			for key, value := range attributes {
+				if key == "name" || strings.EqualFold(key, scimEnterpriseSchema) {
+					if parts, ok := value.(map[string]interface{}); ok {
+						for part, partValue := range parts {
+							values[key+"."+part] = partValue
+						}
+						continue
+					}
+				}
+				values[key] = value
+			}
+		} else {
+			values[operation.Path] = operation.Value
+		}
+
+		for path, value := range values {
+			if err := applyUserPatch(&profile, &password, op, path, value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidPath", err.Error())
+				return
+			}
+		}
+	}
+
+	if profile.Email == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if _, err := models.UpdateUserProfile(id, profile); err != nil {
+		scimUserError(c, err)
+		return
+	}
+	if password != "" {
+		if err := models.SetUserPassword(id, password); err != nil {
+			scimUserError(c, err)
+			return
+		}
+		recordSecurityEvent(c, &id, profile.Email, models.SecurityEventPasswordChanged, "set by SCIM provisioning")
+	}
+
+	respondSCIMUser(c, id)
+}
+
+// applyUserPatch applies one patch operation to a user profile
+func applyUserPatch(profile *models.UserProfile, password *string, op, path string, value interface{}) error {
+	attribute := strings.ToLower(scimValuePath.ReplaceAllString(path, ""))
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(scimUserSchema)+":")
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(scimEnterpriseSchema)+":")
+	attribute = strings.TrimPrefix(attribute, strings.ToLower(scimEnterpriseSchema)+".")
+	remove := op == "remove"
+
+	switch attribute {
+	case "active":
+		if remove {
+			return errors.New("active cannot be removed")
+		}
+		active, ok := scimBool(value)
+		if !ok {
+			return errors.New("active must be a boolean")
+		}
+		profile.Active = active
+	case "username", "emails.value":
+		if remove {
+			return errors.New("userName cannot be removed")
+		}
+		profile.Email = strings.ToLower(strings.TrimSpace(scimString(value)))
+	case "emails":
+		if remove {
+			return errors.New("emails cannot be removed")
+		}
+		if email := scimMultiValues(value); primaryValue(email) != "" {
+			profile.Email = strings.ToLower(strings.TrimSpace(primaryValue(email)))
+		}
+	case "displayname":
+		profile.Name = patchString(remove, value)
+	case "name.givenname":
+		profile.GivenName = patchString(remove, value)
+	case "name.familyname":
+		profile.FamilyName = patchString(remove, value)
+	case "name.formatted":
+		if profile.Name == "" || remove {
+			profile.Name = patchString(remove, value)
+		}
+	case "externalid":
+		profile.ExternalID = patchString(remove, value)
+	case "department":
+		profile.Department = strings.TrimSpace(patchString(remove, value))
+	case "roles", "roles.value":
+		if remove {
+			profile.Role = "user"
+		} else if roles := scimMultiValues(value); len(roles) > 0 {
+			profile.Role = primaryValue(roles)
+		} else {
+			profile.Role = scimString(value)
+		}
+	case "password":
+		if remove {
+			return errors.New("password cannot be removed")
+		}
+		*password = scimString(value)
+	default:
+		return fmt.Errorf("unsupported attribute: %s", path)
+	}
+	return nil
+}
+
+func patchString(remove bool, value interface{}) string {
+	if remove {
+		return ""
+	}
+	return scimString(value)
+}
+
+func scimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case []interface{}:
+		if len(v) > 0 {
+			return scimString(v[0])
+		}
+		return ""
+	case map[string]interface{}:
+		return scimString(v["value"])
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// scimBool accepts real booleans as well as "True"/"False" strings some providers send
+func scimBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseBool(strings.ToLower(v))
+		return parsed, err == nil
+	}
+	return false, false
+}
+
+// scimMultiValues reads a list (or single object) of {"value": ...} entries
+func scimMultiValues(value interface{}) []scimMultiValue {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = []interface{}{v}
+	default:
+		return nil
+	}
+
+	values := make([]scimMultiValue, 0, len(items))
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := scimMultiValue{Value: scimString(object["value"])}
+		if primary, ok := scimBool(object["primary"]); ok {
+			entry.Primary = primary
+		}
+		values = append(values, entry)
+	}
+	return values
+}
+
+func respondSCIMUser(c *gin.Context, id uint) {
+	var user models.User
+	if err := models.DB.Preload("Groups").First(&user, id).Error; err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(c, &user))
+}
+
+// SCIMDeleteUser handles deprovisioning a user. The account is deactivated
+// rather than removed so that the articles it authored are kept.
+func SCIMDeleteUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	if err := models.DeprovisionUser(id); err != nil {
+		scimUserError(c, err)
+		return
+	}
+	log.Printf("SCIM: Deprovisioned user %d", id)
+	c.Status(http.StatusNoContent)
+}
+
+// SCIMListGroups handles listing groups with filtering and pagination
+func SCIMListGroups(c *gin.Context) {
+	filters, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+	query, err := applySCIMFilters(models.DB.Model(&models.Group{}), filters, scimGroupColumns)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Error counting groups")
+		return
+	}
+
+	startIndex, count := scimPagination(c)
+	var groups []models.Group
+	if count > 0 {
+		if c.Query("excludedAttributes") != "members" {
+			query = query.Preload("Members")
+		}
+		if err := query.Order("id").Offset(startIndex - 1).Limit(count).Find(&groups).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching groups")
+			return
+		}
+	}
+
+	resources := make([]scimGroup, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, toSCIMGroup(c, &groups[i]))
+	}
+	scimJSON(c, http.StatusOK, scimListResponse(total, startIndex, resources, len(resources)))
+}
+
+// SCIMGetGroup handles fetching a single group
+func SCIMGetGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	group, err := models.GetGroupByID(id)
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMGroup(c, group))
+}
+
+// memberIDs converts SCIM member references into user IDs
+func memberIDs(members []scimMultiValue) ([]uint, error) {
+	ids := make([]uint, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseUint(member.Value, 10, 64)
+		if err != nil {
+			return nil, models.ErrUserNotFound
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// SCIMCreateGroup handles creating a group
+func SCIMCreateGroup(c *gin.Context) {
+	var input scimGroup
+	if err := c.ShouldBindJSON(&input); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if strings.TrimSpace(input.DisplayName) == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	ids, err := memberIDs(input.Members)
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+
+	group, err := models.CreateGroup(strings.TrimSpace(input.DisplayName), input.ExternalID, ids)
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+
+	log.Printf("SCIM: Created group %s", group.DisplayName)
+	scimJSON(c, http.StatusCreated, toSCIMGroup(c, group))
+}
+
+// SCIMReplaceGroup handles a full replacement of a group (PUT)
+func SCIMReplaceGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var input scimGroup
+	if err := c.ShouldBindJSON(&input); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	if strings.TrimSpace(input.DisplayName) == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	ids, err := memberIDs(input.Members)
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+
+	group, err := models.ReplaceGroup(id, strings.TrimSpace(input.DisplayName), input.ExternalID, ids)
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMGroup(c, group))
+}
+
+// scimPatchError is a malformed operation found while applying a PATCH
+type scimPatchError struct {
+	scimType string
+	detail   string
+}
+
+func (e *scimPatchError) Error() string {
+	return e.detail
+}
+
+// SCIMPatchGroup handles partial updates of a group, including membership
+// changes. The operations are applied all together or not at all.
+func SCIMPatchGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var patch scimPatchRequest
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	group, err := models.EditGroup(id, func(edit *models.GroupEdit) error {
+		for _, operation := range patch.Operations {
+			group := edit.Group()
+			op := strings.ToLower(operation.Op)
+			path := strings.TrimSpace(operation.Path)
+
+			// A member filter path removes a single member: members[value eq "12"]
+			if match := scimMemberPath.FindStringSubmatch(path); match != nil {
+				if op != "remove" {
+					return &scimPatchError{"invalidPath", "Member filters are only supported for remove"}
+				}
+				ids, err := memberIDs([]scimMultiValue{{Value: match[1]}})
+				if err != nil {
+					return err
+				}
+				if err := edit.RemoveMembers(ids); err != nil {
+					return err
+				}
+				continue
+			}
+
+			attributes := map[string]interface{}{}
+			if path == "" {
+				object, ok := operation.Value.(map[string]interface{})
+				if !ok {
+					return &scimPatchError{"invalidValue", "Patch without a path needs an object value"}
+				}
+				attributes = object
+			} else {
+				attributes[path] = operation.Value
+			}
+
+			displayName, externalID := group.DisplayName, group.ExternalID
+			for attribute, value := range attributes {
+				switch strings.ToLower(attribute) {
+				case "members":
+					ids, err := memberIDs(scimMultiValues(value))
+					if err != nil {
+						return err
+					}
+					switch op {
+					case "add":
+						err = edit.AddMembers(ids)
+					case "remove":
+						if value == nil {
+							err = edit.ReplaceMembers(nil)
+						} else {
+							err = edit.RemoveMembers(ids)
+						}
+					case "replace":
+						err = edit.ReplaceMembers(ids)
+					default:
+						return &scimPatchError{"invalidSyntax", "Unsupported patch operation: " + operation.Op}
+					}
+					if err != nil {
+						return err
+					}
+				case "displayname":
+					if op == "remove" || strings.TrimSpace(scimString(value)) == "" {
+						return &scimPatchError{"invalidValue", "displayName is required"}
+					}
+					displayName = strings.TrimSpace(scimString(value))
+				case "externalid":
+					externalID = patchString(op == "remove", value)
+				default:
+					return &scimPatchError{"invalidPath", "Unsupported attribute: " + attribute}
+				}
+			}
+
+			if displayName != group.DisplayName || externalID != group.ExternalID {
+				if err := edit.SetAttributes(displayName, externalID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	var patchErr *scimPatchError
+	if errors.As(err, &patchErr) {
+		scimError(c, http.StatusBadRequest, patchErr.scimType, patchErr.detail)
+		return
+	}
+	if err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMGroup(c, group))
+}
+
+// SCIMDeleteGroup handles deleting a group
+func SCIMDeleteGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteGroup(id); err != nil {
+		scimGroupError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordSecurityEvent stores a security event with the request's IP and user agent
+func recordSecurityEvent(c *gin.Context, userID *uint, email, eventType, details string) {
+	models.RecordSecurityEvent(models.SecurityEvent{
+		UserID:    userID,
+		Email:     email,
+		Type:      eventType,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
+
+// parseEventTime accepts RFC 3339 timestamps or plain dates
+func parseEventTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// securityEventFilter builds a filter from the shared query parameters
+func securityEventFilter(c *gin.Context) (models.SecurityEventFilter, bool) {
+	var filter models.SecurityEventFilter
+
+	from, err := parseEventTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time, use RFC 3339 or YYYY-MM-DD"})
+		return filter, false
+	}
+	to, err := parseEventTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time, use RFC 3339 or YYYY-MM-DD"})
+		return filter, false
+	}
+	// A plain date as upper bound includes the whole day
+	if to != nil && len(c.Query("to")) == len("2006-01-02") {
+		end := to.Add(24*time.Hour - time.Nanosecond)
+		to = &end
+	}
+
+	eventType := c.Query("type")
+	if eventType != "" && !containsValue(models.ValidSecurityEventTypes, eventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type"})
+		return filter, false
+	}
+
+	filter.Type = eventType
+	filter.From = from
+	filter.To = to
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+	filter.Offset, _ = strconv.Atoi(c.Query("offset"))
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return filter, true
+}
+
+// containsValue reports whether list contains value
+func containsValue(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMySecurityEvents handles fetching the current user's login and security history
+func GetMySecurityEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	filter, ok := securityEventFilter(c)
+	if !ok {
+		return
+	}
+	id := userID.(uint)
+	filter.UserID = &id
+
+	events, total, err := models.GetSecurityEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching security events"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, events)
+}
+
+// GetSecurityEvents handles querying all security events (Admin only)
+func GetSecurityEvents(c *gin.Context) {
+	filter, ok := securityEventFilter(c)
+	if !ok {
+		return
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID := uint(id)
+		filter.UserID = &userID
+	}
+
+	events, total, err := models.GetSecurityEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching security events"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slaPolicyID parses the :id route parameter
+func slaPolicyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid SLA policy ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// slaPolicyError maps model errors to HTTP responses
+func slaPolicyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrSLAPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "SLA policy not found"})
+	case errors.Is(err, models.ErrInvalidPriority), errors.Is(err, models.ErrInvalidCategory),
+		errors.Is(err, models.ErrCalendarNotFound), errors.Is(err, models.ErrInvalidPauseStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("SLA policy operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetSLAPolicies handles listing SLA policies (Admin only)
+func GetSLAPolicies(c *gin.Context) {
+	policies, err := models.GetSLAPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching SLA policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// CreateSLAPolicy handles creating an SLA policy (Admin only)
+func CreateSLAPolicy(c *gin.Context) {
+	var req models.SLAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := models.CreateSLAPolicy(req)
+	if err != nil {
+		slaPolicyError(c, err, "Error creating SLA policy")
+		return
+	}
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// UpdateSLAPolicy handles updating an SLA policy (Admin only)
+func UpdateSLAPolicy(c *gin.Context) {
+	id, ok := slaPolicyID(c)
+	if !ok {
+		return
+	}
+
+	var req models.SLAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := models.UpdateSLAPolicy(id, req)
+	if err != nil {
+		slaPolicyError(c, err, "Error updating SLA policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteSLAPolicy handles deleting an SLA policy (Admin only)
+func DeleteSLAPolicy(c *gin.Context) {
+	id, ok := slaPolicyID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := models.GetSLAPolicyByID(id); err != nil {
+		slaPolicyError(c, err, "Error deleting SLA policy")
+		return
+	}
+	if err := models.DeleteSLAPolicy(id); err != nil {
+		slaPolicyError(c, err, "Error deleting SLA policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SLA policy deleted"})
+}
+
+// GetTicketSLAEvents handles listing the SLA timeline of a ticket: every clock
+// start, pause, resume and stop with the time counted so far (Agent only)
+func GetTicketSLAEvents(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := models.GetTicketByID(id); err != nil {
+		ticketError(c, err, "Error fetching SLA events")
+		return
+	}
+
+	events, err := models.GetSLAEvents(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching SLA events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
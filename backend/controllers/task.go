@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -20,6 +21,7 @@ func GetTasks(c *gin.Context) {
 	userRole, roleExists := c.Get("role")
 	
 	var query = models.DB.Where("category = ?", category)
+	query = models.FilterCustomFields(query, customFieldQuery(c))
 	
 	// If user is not admin, only show approved tasks
 	if !roleExists || userRole != "admin" {
@@ -87,6 +89,13 @@ func CreateTask(c *gin.Context) {
 	task.UserID = userID.(uint)
 	task.Category = category
 
+	customFields, err := models.ValidateCustomFields(models.CustomFieldEntityArticle, category, task.CustomFields, true)
+	if err != nil {
+		customFieldError(c, err, "Error creating task")
+		return
+	}
+	task.CustomFields = customFields
+
 	// Set status based on user role
 	if userRole == "admin" {
 		task.Status = "approved" // Admin posts are auto-approved
@@ -144,6 +153,10 @@ func UpdateTask(c *gin.Context) {
 
 	// Update the task using the model's UpdateTask function
 	updatedTask, err := models.UpdateTask(task.ID, updateReq)
+	if errors.Is(err, models.ErrInvalidFieldValue) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ticketError maps model errors to HTTP responses
+func ticketError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrTicketNotFound), errors.Is(err, models.ErrTicketAccessForbidden):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+	case errors.Is(err, models.ErrInvalidPriority), errors.Is(err, models.ErrInvalidCategory),
+		errors.Is(err, models.ErrInvalidTicketStatus), errors.Is(err, models.ErrInvalidAssignee),
+		errors.Is(err, models.ErrQueueNotFound), errors.Is(err, models.ErrArticleNotFound),
+		errors.Is(err, models.ErrInvalidCloseReason), errors.Is(err, models.ErrArticleRequired),
+		errors.Is(err, models.ErrCloseReasonNotAllowed), errors.Is(err, models.ErrTicketMessageEmpty),
+		errors.Is(err, models.ErrInvalidVisibility), errors.Is(err, models.ErrAttachmentTooLarge),
+		errors.Is(err, models.ErrMergeIntoSelf), errors.Is(err, models.ErrInvalidFieldValue),
+		errors.Is(err, models.ErrAssetNotFound), errors.Is(err, models.ErrAssetNotOwned):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInternalNote):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrTicketClosed),
+		errors.Is(err, models.ErrTicketMerged), errors.Is(err, models.ErrMergeCollision),
+		errors.Is(err, models.ErrAwaitingApproval):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Ticket operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// ticketID parses the :id route parameter
+func ticketID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// visibleTicket loads a ticket the current user is allowed to see.
+// Tickets of other requesters are reported as not found.
+func visibleTicket(c *gin.Context, user *models.User) (*models.Ticket, bool) {
+	id, ok := ticketID(c)
+	if !ok {
+		return nil, false
+	}
+
+	ticket, err := models.GetTicketByID(id)
+	if err == nil && !ticket.CanView(user) {
+		err = models.ErrTicketAccessForbidden
+	}
+	if err != nil {
+		ticketError(c, err, "Error fetching ticket")
+		return nil, false
+	}
+	return ticket, true
+}
+
+// ticketFilter reads the ticket list filters from the query. Requesters
+// only see their own tickets and those they are copied on.
+func ticketFilter(c *gin.Context, user *models.User) (models.TicketFilter, bool) {
+	filter := models.TicketFilter{
+		Status:         c.Query("status"),
+		Priority:       c.Query("priority"),
+		Category:       c.Query("category"),
+		Tag:            c.Query("tag"),
+		CustomFields:   customFieldQuery(c),
+		RequestType:    c.Query("request_type"),
+		ApprovalStatus: c.Query("approval_status"),
+		MajorIncident:  c.Query("major_incident") == "true",
+	}
+
+	if !user.IsAgent() {
+		filter.Participant = user.ID
+	} else {
+		if value := c.Query("requester_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid requester ID"})
+				return filter, false
+			}
+			filter.RequesterID = uint(id)
+		}
+		if value := c.Query("queue_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue ID"})
+				return filter, false
+			}
+			filter.QueueID = uint(id)
+		}
+		if value := c.Query("parent_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent ID"})
+				return filter, false
+			}
+			filter.ParentID = uint(id)
+		}
+		if value := c.Query("problem_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+				return filter, false
+			}
+			filter.ProblemID = uint(id)
+		}
+		if value := c.Query("asset_id"); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+				return filter, false
+			}
+			filter.AssetID = uint(id)
+		}
+		switch value := c.Query("assignee_id"); value {
+		case "":
+		case "me":
+			filter.AssigneeID = user.ID
+		case "none":
+			filter.Unassigned = true
+		default:
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee ID"})
+				return filter, false
+			}
+			filter.AssigneeID = uint(id)
+		}
+	}
+
+	return filter, true
+}
+
+// GetTickets handles listing tickets
+func GetTickets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	filter, ok := ticketFilter(c, user)
+	if !ok {
+		return
+	}
+
+	tickets, err := models.GetTickets(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tickets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tickets)
+}
+
+// GetTicket handles fetching a single ticket
+func GetTicket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// CreateTicket handles raising a new ticket. Agents may raise one on behalf of a requester.
+func CreateTicket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.TicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	requesterID, ok := ticketRequester(c, user, req.RequesterID)
+	if !ok {
+		return
+	}
+
+	ticket, err := models.CreateTicket(req, requesterID)
+	if err != nil {
+		ticketError(c, err, "Error creating ticket")
+		return
+	}
+
+	log.Printf("Ticket %s created by %s", ticket.Reference(), user.Email)
+	c.JSON(http.StatusCreated, ticket)
+}
+
+// ticketRequester resolves who a new ticket is raised for, the current
+// user unless an agent raises it on someone's behalf
+func ticketRequester(c *gin.Context, user *models.User, requesterID uint) (uint, bool) {
+	if requesterID == 0 || requesterID == user.ID {
+		return user.ID, true
+	}
+	if !user.IsAgent() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only agents can raise tickets for other users"})
+		return 0, false
+	}
+	if _, err := models.GetUserByID(requesterID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Requester not found"})
+		return 0, false
+	}
+	return requesterID, true
+}
+
+// UpdateTicket handles editing ticket details (Agent only)
+func UpdateTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TicketUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.UpdateTicket(id, req)
+	if err != nil {
+		ticketError(c, err, "Error updating ticket")
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// UpdateTicketStatus handles moving a ticket through its lifecycle.
+// Requesters may only close or reopen their own resolved tickets.
+func UpdateTicketStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	var input models.TicketStatusChange
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !user.IsAgent() {
+		allowed := ticket.Status == models.TicketStatusResolved &&
+			(input.Status == models.TicketStatusClosed || input.Status == models.TicketStatusOpen)
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Requesters can only close or reopen resolved tickets"})
+			return
+		}
+	}
+
+	if !user.IsAgent() && (input.CloseReason != "" || input.TaskID != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only agents can set a close reason"})
+		return
+	}
+
+	updated, err := models.ChangeTicketStatus(ticket.ID, input, user)
+	if err != nil {
+		ticketError(c, err, "Error updating ticket status")
+		return
+	}
+
+	log.Printf("Ticket %s moved from %s to %s by %s", updated.Reference(), ticket.Status, updated.Status, user.Email)
+	c.JSON(http.StatusOK, updated)
+}
+
+// AssignTicket handles assigning a ticket to an agent (Agent only)
+func AssignTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		AssigneeID *uint `json:"assignee_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.AssignTicket(id, input.AssigneeID)
+	if err != nil {
+		ticketError(c, err, "Error assigning ticket")
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// UpdateTicketTags handles replacing the tags of a ticket (Agent only)
+func UpdateTicketTags(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.SetTicketTags(id, input.Tags)
+	if err != nil {
+		ticketError(c, err, "Error updating tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// MoveTicketToQueue handles moving a ticket between queues (Agent only).
+// Unassigned tickets are auto-assigned by the new queue.
+func MoveTicketToQueue(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		QueueID *uint `json:"queue_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.MoveTicketToQueue(id, input.QueueID)
+	if err != nil {
+		ticketError(c, err, "Error moving ticket")
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
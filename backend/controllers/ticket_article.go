@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTicketArticles handles listing the articles linked to a ticket
+func GetTicketArticles(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	links, err := models.GetTicketArticles(ticket.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching linked articles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// LinkTicketArticle handles linking a knowledge article to a ticket (Agent only)
+func LinkTicketArticle(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TaskID uint `json:"task_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.LinkTicketArticle(id, input.TaskID, user.ID); err != nil {
+		ticketError(c, err, "Error linking article")
+		return
+	}
+
+	links, err := models.GetTicketArticles(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching linked articles"})
+		return
+	}
+	c.JSON(http.StatusCreated, links)
+}
+
+// UnlinkTicketArticle handles removing an article from a ticket (Agent only)
+func UnlinkTicketArticle(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+	taskID, err := strconv.ParseUint(c.Param("task_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	if _, err := models.GetTicketByID(id); err != nil {
+		ticketError(c, err, "Error unlinking article")
+		return
+	}
+	if err := models.UnlinkTicketArticle(id, uint(taskID)); err != nil {
+		ticketError(c, err, "Error unlinking article")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Article unlinked"})
+}
+
+// GetKnowledgeGaps handles reporting ticket categories without linked
+// articles (Admin only). Query: days (default 90), min_tickets (default 5).
+func GetKnowledgeGaps(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+		return
+	}
+	minTickets, err := strconv.ParseInt(c.DefaultQuery("min_tickets", "5"), 10, 64)
+	if err != nil || minTickets < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_tickets"})
+		return
+	}
+
+	gaps, err := models.GetKnowledgeGaps(time.Now().AddDate(0, 0, -days), minTickets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building knowledge gap report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gaps)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergeTickets handles merging other tickets into the ticket (Agent only)
+func MergeTickets(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TicketMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticket, err := models.MergeTickets(id, req, user)
+	if err != nil {
+		ticketError(c, err, "Error merging tickets")
+		return
+	}
+
+	log.Printf("Tickets %v merged into %s by %s", req.TicketIDs, ticket.Reference(), user.Email)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// GetTicketDuplicates handles listing open tickets that look like the same issue (Agent only)
+func GetTicketDuplicates(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	ticket, err := models.GetTicketByID(id)
+	if err != nil {
+		ticketError(c, err, "Error fetching ticket")
+		return
+	}
+
+	candidates, err := models.FindDuplicateTickets(ticket)
+	if err != nil {
+		ticketError(c, err, "Error finding duplicate tickets")
+		return
+	}
+
+	c.JSON(http.StatusOK, candidates)
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTicketMessages handles listing the conversation of a ticket.
+// Requesters only see public messages.
+func GetTicketMessages(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	messages, err := models.GetTicketMessages(ticket.ID, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// AddTicketMessage handles posting a reply or, for agents, an internal note
+func AddTicketMessage(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+
+	var req models.TicketMessageRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uploads, err := formAttachments(c)
+	if errors.Is(err, models.ErrAttachmentTooLarge) {
+		ticketError(c, err, "Error reading attachments")
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachments"})
+		return
+	}
+
+	message, err := models.AddTicketMessage(ticket.ID, user, models.TicketMessageInput{
+		Body:        req.Body,
+		Visibility:  req.Visibility,
+		Source:      models.SourceWeb,
+		Attachments: uploads,
+	})
+	if err != nil {
+		ticketError(c, err, "Error adding message")
+		return
+	}
+
+	log.Printf("Ticket %s got a %s message from %s", ticket.Reference(), message.Visibility, user.Email)
+	c.JSON(http.StatusCreated, message)
+}
+
+// formAttachments reads the files posted as "attachments" in a multipart form
+func formAttachments(c *gin.Context) ([]models.AttachmentUpload, error) {
+	if c.ContentType() != "multipart/form-data" {
+		return nil, nil
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := models.MaxAttachmentSize()
+	var uploads []models.AttachmentUpload
+	for _, header := range form.File["attachments"] {
+		if header.Size > limit {
+			return nil, models.ErrAttachmentTooLarge
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, models.AttachmentUpload{
+			Filename:    header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Data:        data,
+		})
+	}
+	return uploads, nil
+}
+
+// DownloadTicketAttachment handles downloading a file attached to a ticket
+// or one of its messages. Requesters cannot download from internal notes.
+func DownloadTicketAttachment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ticket, ok := visibleTicket(c, user)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	attachment, err := models.GetTicketAttachment(ticket.ID, uint(attachmentID), user)
+	if err != nil {
+		if errors.Is(err, models.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching attachment"})
+		return
+	}
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.FileAttachment(attachment.StoragePath, attachment.Filename)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeEntryError maps time tracking errors to responses
+func timeEntryError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrTicketNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+	case errors.Is(err, models.ErrTimeEntryNotFound), errors.Is(err, models.ErrTimerNotRunning):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTimeEntryForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrTimerRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidTimeGroup), errors.Is(err, models.ErrInvalidTimeInterval):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Time tracking operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetTicketTime handles listing the time logged on a ticket (Agent only)
+func GetTicketTime(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	entries, err := models.GetTicketTime(id)
+	if err != nil {
+		timeEntryError(c, err, "Error fetching time entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// LogTicketTime handles logging time spent on a ticket (Agent only)
+func LogTicketTime(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := models.LogTime(id, req, user)
+	if err != nil {
+		timeEntryError(c, err, "Error logging time")
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// StartTicketTimer handles starting a timer on a ticket (Agent only)
+func StartTicketTimer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req models.TimerRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	entry, err := models.StartTimer(id, req, user)
+	if err != nil {
+		timeEntryError(c, err, "Error starting timer")
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetMyTimer handles fetching the current agent's running timer (Agent only)
+func GetMyTimer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	entry, err := models.GetRunningTimer(user)
+	if err != nil {
+		timeEntryError(c, err, "Error fetching timer")
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// StopMyTimer handles stopping the current agent's timer, which logs the
+// time (Agent only)
+func StopMyTimer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	entry, err := models.StopTimer(user)
+	if err != nil {
+		timeEntryError(c, err, "Error stopping timer")
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// UpdateTimeEntry handles correcting a time entry (Agent only)
+func UpdateTimeEntry(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "time entry")
+	if !ok {
+		return
+	}
+
+	var req models.TimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := models.UpdateTimeEntry(id, req, user)
+	if err != nil {
+		timeEntryError(c, err, "Error updating time entry")
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// DeleteTimeEntry handles removing a time entry (Agent only)
+func DeleteTimeEntry(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	id, ok := parseID(c, "time entry")
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteTimeEntry(id, user); err != nil {
+		timeEntryError(c, err, "Error deleting time entry")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time entry deleted successfully"})
+}
+
+// GetTimeReport handles totalling logged time per agent, category or
+// requester department and per period, as JSON or with format=csv as a
+// CSV download. from and to are dates, both included (Admin only)
+func GetTimeReport(c *gin.Context) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		from = date
+	}
+	if value := c.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+
+	group := c.DefaultQuery("group_by", models.TimeGroupAgent)
+	stats, err := models.GetTimeReport(group, c.DefaultQuery("interval", "month"), from, to, c.Query("billable") == "true")
+	if err != nil {
+		timeEntryError(c, err, "Error building time report")
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		writeCSV(c, "time-"+group, models.ExportTimeReport(group, stats))
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
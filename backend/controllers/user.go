@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supportdesk/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUsers handles listing users, optionally filtered by role (Admin only)
+func GetUsers(c *gin.Context) {
+	users, err := models.GetUsers(c.Query("role"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// targetUser loads the user referenced by the :id route parameter
+func targetUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// UpdateUserRole handles changing a user's role (Admin only)
+func UpdateUserRole(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserRole(user.ID, input.Role); err != nil {
+		if errors.Is(err, models.ErrInvalidRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role"})
+		return
+	}
+
+	if input.Role != user.Role {
+		log.Printf("Role of user %s changed from %s to %s", user.Email, user.Role, input.Role)
+		recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventTokenRevoked,
+			fmt.Sprintf("role changed from %s to %s", user.Role, input.Role))
+	}
+
+	updated, err := models.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// UpdateUserActive handles activating or deactivating a user (Admin only)
+func UpdateUserActive(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Active *bool `json:"active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserActive(user.ID, *input.Active); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	if user.Active && !*input.Active {
+		log.Printf("User %s deactivated", user.Email)
+		recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventTokenRevoked, "account deactivated")
+	}
+
+	updated, err := models.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// RevokeUserTokens handles signing a user out of every session (Admin only)
+func RevokeUserTokens(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RevokeUserTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	recordSecurityEvent(c, &user.ID, user.Email, models.SecurityEventTokenRevoked, "revoked by an admin")
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions of the user have been signed out"})
+}
+
+// UpdateUserSkills handles replacing an agent's skills (Admin only)
+func UpdateUserSkills(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Skills []string `json:"skills" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserSkills(user.ID, input.Skills); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	updated, err := models.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// UpdateUserDepartment handles setting the department of a user (Admin only)
+func UpdateUserDepartment(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Department string `json:"department"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserDepartment(user.ID, input.Department); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	updated, err := models.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// UpdateUserManager handles setting or clearing a user's manager, who
+// signs off their requests in manager approval steps (Admin only)
+func UpdateUserManager(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ManagerID *uint `json:"manager_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserManager(user.ID, input.ManagerID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrUserNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Manager not found"})
+		case errors.Is(err, models.ErrManagerCycle):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		}
+		return
+	}
+
+	updated, err := models.GetUserByID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// UpdateMyAway handles agents marking themselves away from auto-assignment (Agent only)
+func UpdateMyAway(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Away *bool `json:"away" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserAway(user.ID, *input.Away); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"away": *input.Away})
+}
+
+// currentUser loads the authenticated user from the database
+func currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
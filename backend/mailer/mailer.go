@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Send delivers a plain-text email. When SMTP_HOST is not set the message is
+// written to the log instead, so local setups work without a mail server.
+func Send(to, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Printf("Mailer: SMTP_HOST not set, logging email instead\nTo: %s\nSubject: %s\n\n%s", to, subject, body)
+		return nil
+	}
+
+	port := getEnv("SMTP_PORT", "587")
+	from := getEnv("SMTP_FROM", "support@supportdesk.com")
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", sanitizeHeader(to)))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", sanitizeHeader(subject)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := smtp.SendMail(host+":"+port, auth, from, []string{to}, []byte(msg.String())); err != nil {
+		log.Printf("Mailer: Failed to send email to %s: %v", to, err)
+		return err
+	}
+	return nil
+}
+
+// Link builds an absolute URL into the frontend application
+func Link(path string) string {
+	base := strings.TrimRight(getEnv("FRONTEND_URL", "http://localhost:5173"), "/")
+	return base + "/" + strings.TrimLeft(path, "/")
+}
+
+// sanitizeHeader strips line breaks so values cannot inject extra headers
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
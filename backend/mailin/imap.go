@@ -0,0 +1,165 @@
+package mailin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IMAP reads unseen messages from an IMAP mailbox and flags each handled
+// one as seen. Only the handful of IMAP4rev1 commands needed for that are
+// implemented.
+type IMAP struct {
+	Addr     string
+	TLS      bool
+	User     string
+	Password string
+	Mailbox  string
+}
+
+// maxMessageSize bounds a message read from a mail server
+const maxMessageSize = 64 << 20
+
+// Fetch hands every unseen message of the mailbox to the handler
+func (m *IMAP) Fetch(handle Handler) error {
+	conn, err := dial(m.Addr, m.TLS)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := &imapConn{r: bufio.NewReader(conn), w: conn}
+
+	greeting, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		return fmt.Errorf("unexpected IMAP greeting %q", greeting.text)
+	}
+	if _, err := c.command("LOGIN %s %s", imapQuote(m.User), imapQuote(m.Password)); err != nil {
+		return fmt.Errorf("IMAP login failed: %w", err)
+	}
+	if _, err := c.command("SELECT %s", imapQuote(m.Mailbox)); err != nil {
+		return err
+	}
+
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+	var uids []string
+	for _, resp := range responses {
+		if fields := strings.Fields(resp.text); len(fields) > 2 && fields[1] == "SEARCH" {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+
+	for _, uid := range uids {
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			return fmt.Errorf("unexpected IMAP UID %q", uid)
+		}
+		responses, err := c.command("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		for _, resp := range responses {
+			if strings.Contains(resp.text, "FETCH") && len(resp.literals) > 0 {
+				raw = resp.literals[0]
+				break
+			}
+		}
+		if raw == nil {
+			// Expunged by another client in the meantime
+			continue
+		}
+
+		if err := handle(raw); err != nil {
+			log.Printf("Mail ingestion: IMAP message %s failed: %v", uid, err)
+			continue
+		}
+		if _, err := c.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid); err != nil {
+			return err
+		}
+	}
+
+	_, err = c.command("LOGOUT")
+	return err
+}
+
+// imapConn is an IMAP session
+type imapConn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	tag int
+}
+
+// imapResponse is a response line with the literals it carried
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+// literalSuffix matches the announcement of a literal at the end of a line
+var literalSuffix = regexp.MustCompile(`\{(\d+)\+?\}$`)
+
+// command sends a tagged command and returns the untagged responses that
+// came before its completion. A NO or BAD completion is an error.
+func (c *imapConn) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%03d", c.tag)
+	if _, err := fmt.Fprintf(c.w, tag+" "+format+"\r\n", args...); err != nil {
+		return nil, err
+	}
+
+	var untagged []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(resp.text, tag+" "); ok {
+			if strings.HasPrefix(status, "OK") {
+				return untagged, nil
+			}
+			return nil, fmt.Errorf("IMAP server: %s", status)
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+// readResponse reads one response, following the literals embedded in it
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		resp.text += line
+
+		match := literalSuffix.FindStringSubmatch(line)
+		if match == nil {
+			return resp, nil
+		}
+		size, err := strconv.Atoi(match[1])
+		if err != nil || size > maxMessageSize {
+			return resp, fmt.Errorf("IMAP literal of %s bytes is too large", match[1])
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+// imapQuote quotes a string argument
+func imapQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
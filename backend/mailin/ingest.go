@@ -0,0 +1,200 @@
+package mailin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+
+	"supportdesk/models"
+)
+
+// Ingestion outcomes
+const (
+	ActionCreated   = "created"
+	ActionReplied   = "replied"
+	ActionDuplicate = "duplicate"
+	ActionSkipped   = "skipped"
+)
+
+// Result describes what became of an inbound email
+type Result struct {
+	Action   string
+	TicketID uint
+	Reason   string // Why the email was skipped
+	From     string
+	Subject  string
+}
+
+func (r *Result) String() string {
+	switch r.Action {
+	case ActionCreated:
+		return fmt.Sprintf("email from %s created TCK-%d", r.From, r.TicketID)
+	case ActionReplied:
+		return fmt.Sprintf("email from %s added a reply to TCK-%d", r.From, r.TicketID)
+	case ActionDuplicate:
+		return fmt.Sprintf("email from %s was already ingested", r.From)
+	default:
+		return fmt.Sprintf("email from %s %q skipped: %s", r.From, r.Subject, r.Reason)
+	}
+}
+
+// Process ingests a raw email and logs the outcome. It is the handler the
+// sources are fetched with.
+func Process(raw []byte) error {
+	result, err := Ingest(raw)
+	if err != nil {
+		return err
+	}
+	log.Printf("Mail ingestion: %s", result)
+	return nil
+}
+
+// Ingest turns a raw email into a ticket, or into a message on the ticket it
+// replies to. Emails that can never be ingested, such as auto-replies or
+// mail from unknown senders, are skipped without an error so the source
+// does not retry them.
+func Ingest(raw []byte) (*Result, error) {
+	msg, err := Parse(raw)
+	if err != nil {
+		return &Result{Action: ActionSkipped, Reason: "unreadable message: " + err.Error()}, nil
+	}
+	result := &Result{From: msg.From.Address, Subject: msg.Subject}
+
+	if msg.AutoSubmitted {
+		return result.skip("automatic reply or bulk mail"), nil
+	}
+	if msg.MessageID != "" {
+		ingested, err := models.EmailIngested(msg.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if ingested {
+			result.Action = ActionDuplicate
+			return result, nil
+		}
+	}
+
+	sender, reason, err := senderOf(msg.From)
+	if err != nil {
+		return nil, err
+	}
+	if sender == nil {
+		return result.skip(reason), nil
+	}
+
+	ticket, err := models.FindTicketForEmail(msg.Related(), msg.Subject)
+	if err != nil && !errors.Is(err, models.ErrTicketNotFound) {
+		return nil, err
+	}
+	// Replies to closed tickets and from people outside the ticket start a new one
+	accepted := false
+	if ticket != nil && ticket.Status != models.TicketStatusClosed {
+		if accepted, err = ticket.AcceptsEmailFrom(sender); err != nil {
+			return nil, err
+		}
+	}
+	if accepted {
+		if _, err := models.AddTicketMessage(ticket.ID, sender, models.TicketMessageInput{
+			Body:           StripQuoted(msg.Text),
+			Source:         models.SourceEmail,
+			EmailMessageID: msg.MessageID,
+			Attachments:    uploads(msg),
+		}); errors.Is(err, models.ErrTicketMessageEmpty) {
+			return result.skip("empty reply"), nil
+		} else if err != nil {
+			return nil, err
+		}
+		result.Action, result.TicketID = ActionReplied, ticket.ID
+		return result, nil
+	}
+
+	subject := models.StripTicketReferences(msg.Subject)
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	created, err := models.CreateTicket(models.TicketRequest{
+		Subject:        subject,
+		Description:    msg.Text,
+		Category:       getEnv("MAILIN_CATEGORY", "request-solving"),
+		Source:         models.SourceEmail,
+		EmailMessageID: msg.MessageID,
+		Attachments:    uploads(msg),
+	}, sender.ID)
+	if err != nil {
+		return nil, err
+	}
+	result.Action, result.TicketID = ActionCreated, created.ID
+	return result, nil
+}
+
+// skip marks the email as skipped for the given reason
+func (r *Result) skip(reason string) *Result {
+	r.Action, r.Reason = ActionSkipped, reason
+	return r
+}
+
+// senderOf maps the sender address to a user. Unknown senders get a
+// requester account when MAILIN_CREATE_USERS is "true"; otherwise, like
+// deactivated users, they are refused with a reason.
+func senderOf(from *mail.Address) (*models.User, string, error) {
+	user, err := models.GetUserByEmail(from.Address)
+	if err == nil {
+		if !user.Active {
+			return nil, "sender account is deactivated", nil
+		}
+		return user, "", nil
+	}
+	if !errors.Is(err, models.ErrUserNotFound) {
+		return nil, "", err
+	}
+	if os.Getenv("MAILIN_CREATE_USERS") != "true" {
+		return nil, "unknown sender", nil
+	}
+
+	// The account gets an unusable password; the user signs in after a reset
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	user, err = models.ProvisionUser(models.UserProfile{
+		Email:  from.Address,
+		Role:   "user",
+		Name:   from.Name,
+		Active: true,
+	}, hex.EncodeToString(buf))
+	if err != nil {
+		return nil, "", err
+	}
+	log.Printf("Mail ingestion: Created user %s for an inbound email", user.Email)
+	return user, "", nil
+}
+
+// uploads converts the attachments of an email, dropping files above the size limit
+func uploads(msg *Message) []models.AttachmentUpload {
+	limit := models.MaxAttachmentSize()
+	var files []models.AttachmentUpload
+	for _, attachment := range msg.Attachments {
+		if int64(len(attachment.Data)) > limit {
+			log.Printf("Mail ingestion: Dropped attachment %s of %d bytes from %s", attachment.Filename, len(attachment.Data), msg.From.Address)
+			continue
+		}
+		files = append(files, models.AttachmentUpload{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+		})
+	}
+	return files
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return defaultValue
+}
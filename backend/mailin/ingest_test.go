@@ -0,0 +1,70 @@
+package mailin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"supportdesk/models"
+)
+
+// replyEmail builds a plain-text email from the user with the subject
+func replyEmail(from *models.User, subject, body string) []byte {
+	return []byte(strings.Join([]string{
+		"From: " + from.Email,
+		"To: help.desk@company.com",
+		"Subject: " + subject,
+		fmt.Sprintf("Message-ID: <reply-%d@test.example>", time.Now().UnixNano()),
+		"Date: Mon, 19 Oct 2026 09:30:00 +0200",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+		"",
+	}, "\r\n"))
+}
+
+func TestIngestReplyToMergedTicket(t *testing.T) {
+	useTestDB(t)
+	agent := createTestUser(t, "agent")
+	primaryRequester := createTestUser(t, "user")
+	secondaryRequester := createTestUser(t, "user")
+	stranger := createTestUser(t, "user")
+	primary := createTestTicket(t, primaryRequester, "VPN drops every few minutes")
+	secondary := createTestTicket(t, secondaryRequester, "VPN keeps disconnecting")
+
+	if _, err := models.MergeTickets(primary.ID, models.TicketMergeRequest{TicketIDs: []uint{secondary.ID}}, agent); err != nil {
+		t.Fatalf("MergeTickets() error = %v", err)
+	}
+
+	// The requester of the merged ticket answers the merge notice
+	subject := fmt.Sprintf("Re: [%s] VPN keeps disconnecting", secondary.Reference())
+	result, err := Ingest(replyEmail(secondaryRequester, subject, "It happens on the office wifi too."))
+	if err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	if result.Action != ActionReplied || result.TicketID != primary.ID {
+		t.Fatalf("Ingest() = %s, want a reply to %s", result, primary.Reference())
+	}
+
+	messages, err := models.GetTicketMessages(primary.ID, agent)
+	if err != nil {
+		t.Fatalf("GetTicketMessages() error = %v", err)
+	}
+	last := messages[len(messages)-1]
+	if last.AuthorID != secondaryRequester.ID || last.Body != "It happens on the office wifi too." {
+		t.Errorf("last message = %q by %d, want the reply by %d", last.Body, last.AuthorID, secondaryRequester.ID)
+	}
+	if !last.IsInternal() {
+		t.Error("reply of the merged ticket's requester is visible to the primary's requester")
+	}
+
+	// Someone outside both tickets still starts a new ticket
+	result, err = Ingest(replyEmail(stranger, subject, "Same problem here."))
+	if err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	if result.Action != ActionCreated || result.TicketID == primary.ID {
+		t.Errorf("Ingest() = %s, want a new ticket", result)
+	}
+}
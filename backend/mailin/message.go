@@ -0,0 +1,340 @@
+// Package mailin turns inbound email into tickets and ticket messages. It
+// reads RFC 5322 messages from a maildir, a directory of .eml files, or a
+// POP3 or IMAP mailbox.
+package mailin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Message is a parsed inbound email
+type Message struct {
+	MessageID     string
+	InReplyTo     []string
+	References    []string
+	From          *mail.Address
+	Subject       string
+	Date          time.Time
+	Text          string
+	Attachments   []Attachment
+	AutoSubmitted bool // Auto-replies, bounces and bulk mail, which must never start a mail loop
+}
+
+// Attachment is a file carried by an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var ErrNoSender = errors.New("email has no sender address")
+
+// maxPartDepth bounds the nesting of multipart bodies
+const maxPartDepth = 10
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Parse reads an RFC 5322 message
+func Parse(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := parseAddress(m.Header.Get("From"))
+	if err != nil {
+		return nil, ErrNoSender
+	}
+
+	msg := &Message{
+		MessageID:     firstMessageID(m.Header.Get("Message-ID")),
+		InReplyTo:     messageIDs(m.Header.Get("In-Reply-To")),
+		References:    messageIDs(m.Header.Get("References")),
+		From:          from,
+		Subject:       decodeHeader(m.Header.Get("Subject")),
+		AutoSubmitted: autoSubmitted(m.Header, from),
+	}
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = date
+	}
+
+	var htmlBody string
+	if err := msg.walk(m.Header, m.Body, 0, &htmlBody); err != nil {
+		return nil, err
+	}
+	if msg.Text == "" && htmlBody != "" {
+		msg.Text = htmlToText(htmlBody)
+	}
+	msg.Text = strings.TrimSpace(strings.ReplaceAll(msg.Text, "\r\n", "\n"))
+	return msg, nil
+}
+
+// Related lists the Message-IDs the email replies to, most specific first
+func (m *Message) Related() []string {
+	var related []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			related = append(related, id)
+		}
+	}
+	for _, id := range m.InReplyTo {
+		add(id)
+	}
+	for i := len(m.References) - 1; i >= 0; i-- {
+		add(m.References[i])
+	}
+	return related
+}
+
+// header is implemented by both message and MIME part headers
+type header interface {
+	Get(key string) string
+}
+
+// walk collects the text body and attachments of a MIME entity. The first
+// text/plain part becomes the body; an HTML part is only used without one.
+func (m *Message) walk(h header, body io.Reader, depth int, htmlBody *string) error {
+	if depth > maxPartDepth {
+		return fmt.Errorf("MIME nesting deeper than %d levels", maxPartDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.walk(part.Header, part, depth+1, htmlBody); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if disposition == "attachment" || filename != "" || (!isText && mediaType != "message/delivery-status") {
+		if filename == "" {
+			filename = "attachment"
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				filename += exts[0]
+			}
+		}
+		m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+		return nil
+	}
+
+	text := decodeCharset(params["charset"], data)
+	if mediaType == "text/html" {
+		if *htmlBody == "" {
+			*htmlBody = text
+		}
+	} else if m.Text == "" {
+		m.Text = text
+	}
+	return nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a body
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &skipWhitespace{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// skipWhitespace drops the line breaks base64 bodies are wrapped with
+type skipWhitespace struct {
+	r io.Reader
+}
+
+func (s *skipWhitespace) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// charsetReader converts the charsets email commonly uses to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(charset, data)), nil
+}
+
+// decodeCharset converts text in the given charset to UTF-8. Single-byte
+// Latin charsets are mapped directly; anything else is kept if it is valid
+// UTF-8 and otherwise read as Latin-1.
+func decodeCharset(charset string, data []byte) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "latin1", "iso-8859-15", "windows-1252", "cp1252":
+		return latin1(data)
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return latin1(data)
+}
+
+// latin1 maps each byte to the Unicode code point of the same value
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// decodeHeader decodes RFC 2047 encoded words
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// parseAddress reads a single mailbox, decoding an encoded display name
+func parseAddress(value string) (*mail.Address, error) {
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	address, err := parser.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	address.Address = strings.ToLower(address.Address)
+	return address, nil
+}
+
+var messageIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// messageIDs extracts the Message-IDs of a header, without angle brackets
+func messageIDs(value string) []string {
+	var ids []string
+	for _, match := range messageIDPattern.FindAllStringSubmatch(value, -1) {
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+// firstMessageID extracts a Message-ID, accepting one without angle brackets
+func firstMessageID(value string) string {
+	if ids := messageIDs(value); len(ids) > 0 {
+		return ids[0]
+	}
+	return strings.TrimSpace(value)
+}
+
+// autoSubmitted recognises machine-generated mail following RFC 3834 and
+// the headers common mailers use instead
+func autoSubmitted(h mail.Header, from *mail.Address) bool {
+	if value := strings.ToLower(h.Get("Auto-Submitted")); value != "" && value != "no" {
+		return true
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list", "auto_reply":
+		return true
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return true
+	}
+	local := strings.SplitN(from.Address, "@", 2)[0]
+	return local == "mailer-daemon" || local == "postmaster"
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/tr|/h[1-6])[^>]*>`)
+	htmlHidden = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText reduces an HTML body to readable plain text
+func htmlToText(body string) string {
+	body = htmlHidden.ReplaceAllString(body, "")
+	body = htmlBreaks.ReplaceAllString(body, "\n")
+	body = htmlTags.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+var replyHeader = regexp.MustCompile(`^(On .+ wrote:|-+\s*Original Message\s*-+)$`)
+
+// StripQuoted removes the quoted earlier conversation from a reply, keeping
+// only what the sender wrote above it
+func StripQuoted(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if replyHeader.MatchString(trimmed) {
+			lines = lines[:i]
+			break
+		}
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			kept = append(kept, line)
+		}
+	}
+
+	stripped := strings.TrimSpace(strings.Join(kept, "\n"))
+	if stripped == "" {
+		// Nothing but quotes: keep the whole text rather than lose it
+		return strings.TrimSpace(text)
+	}
+	return stripped
+}
@@ -0,0 +1,205 @@
+package mailin
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseFixture parses one of the sample emails in fixtures/
+func parseFixture(t *testing.T, name string) *Message {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("fixtures", name))
+	if err != nil {
+		t.Fatalf("reading %s: %v", name, err)
+	}
+	msg, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+	return msg
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		fixture       string
+		messageID     string
+		related       []string
+		from          string
+		name          string
+		subject       string
+		text          string // Body after StripQuoted
+		attachments   []string
+		autoSubmitted bool
+	}{
+		{
+			fixture:   "01-new-ticket.eml",
+			messageID: "CAF3k2x9-vpn-1@mail.company.com",
+			from:      "john.doe@company.com",
+			name:      "John Doe",
+			subject:   "VPN drops every few minutes",
+			text:      "Hi,\n\nsince this morning my VPN connection drops every few minutes and I have\nto log in again each time. I am working from home today.\n\nThanks,\nJohn",
+		},
+		{
+			fixture:   "02-reply-by-references.eml",
+			messageID: "CAF3k2x9-vpn-2@mail.company.com",
+			related:   []string{"CAF3k2x9-vpn-1@mail.company.com"},
+			from:      "john.doe@company.com",
+			subject:   "Re: VPN drops every few minutes",
+			text:      "It also happens on the office wifi, so it is not my home network.",
+		},
+		{
+			fixture:     "03-reply-with-attachment.eml",
+			messageID:   "CAF3k2x9-vpn-3@mail.company.com",
+			from:        "john.doe@company.com",
+			name:        "Doe, John",
+			subject:     "Re: [TCK-1] VPN drops every few minutes",
+			text:        "Here is the client log you asked for. The disconnects always come right after a keepalive timeout – hope that helps.",
+			attachments: []string{"vpn-client.log"},
+		},
+		{
+			fixture:   "04-html-only-latin1.eml",
+			messageID: "20261013084512.5521@outlook.company.com",
+			from:      "sarah.smith@company.com",
+			name:      "Sarah Smíth",
+			subject:   "New laptop for onboarding – Marketing",
+			text:      "Hello,\nwe have a new colleague starting in Marketing on Monday. Could you prepare a laptop with the standard software?\n\nKind regards,\nSarah Smíth",
+		},
+		{
+			fixture:       "05-auto-reply.eml",
+			messageID:     "auto-20261014070000@outlook.company.com",
+			from:          "sarah.smith@company.com",
+			subject:       "Automatic reply: [TCK-2] New laptop for onboarding",
+			text:          "I am out of the office until 19 October with limited access to email.",
+			autoSubmitted: true,
+		},
+		{
+			fixture:   "06-unknown-sender.eml",
+			messageID: "offer-8812@example.net",
+			from:      "sales@example.net",
+			name:      "Vendor Sales",
+			subject:   "Special offer on printer toner",
+			text:      "Order this week and save 20% on all toner cartridges.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			msg := parseFixture(t, tt.fixture)
+
+			if msg.MessageID != tt.messageID {
+				t.Errorf("MessageID = %q, want %q", msg.MessageID, tt.messageID)
+			}
+			if related := msg.Related(); !reflect.DeepEqual(related, tt.related) {
+				t.Errorf("Related() = %q, want %q", related, tt.related)
+			}
+			if msg.From.Address != tt.from || msg.From.Name != tt.name {
+				t.Errorf("From = %q <%s>, want %q <%s>", msg.From.Name, msg.From.Address, tt.name, tt.from)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.subject)
+			}
+			if text := StripQuoted(msg.Text); text != tt.text {
+				t.Errorf("StripQuoted(Text) = %q, want %q", text, tt.text)
+			}
+			var names []string
+			for _, attachment := range msg.Attachments {
+				names = append(names, attachment.Filename)
+			}
+			if !reflect.DeepEqual(names, tt.attachments) {
+				t.Errorf("attachments = %q, want %q", names, tt.attachments)
+			}
+			if msg.AutoSubmitted != tt.autoSubmitted {
+				t.Errorf("AutoSubmitted = %v, want %v", msg.AutoSubmitted, tt.autoSubmitted)
+			}
+			if msg.Date.IsZero() {
+				t.Error("Date was not parsed")
+			}
+		})
+	}
+}
+
+func TestParseAttachmentContent(t *testing.T) {
+	msg := parseFixture(t, "03-reply-with-attachment.eml")
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+	}
+	attachment := msg.Attachments[0]
+	if attachment.ContentType != "text/plain" {
+		t.Errorf("ContentType = %q, want text/plain", attachment.ContentType)
+	}
+	want := "VPN client log\n09:20:11 tunnel up\n09:23:40 keepalive timeout\n09:23:41 tunnel down\n"
+	if string(attachment.Data) != want {
+		t.Errorf("Data = %q, want %q", attachment.Data, want)
+	}
+}
+
+func TestRelatedOrder(t *testing.T) {
+	msg := &Message{
+		InReplyTo:  []string{"c@x"},
+		References: []string{"a@x", "b@x", "c@x"},
+	}
+	want := []string{"c@x", "b@x", "a@x"}
+	if related := msg.Related(); !reflect.DeepEqual(related, want) {
+		t.Errorf("Related() = %q, want %q", related, want)
+	}
+}
+
+func TestAutoSubmitted(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers mail.Header
+		from    string
+		want    bool
+	}{
+		{"plain mail", mail.Header{}, "john.doe@company.com", false},
+		{"auto-submitted no", mail.Header{"Auto-Submitted": {"no"}}, "john.doe@company.com", false},
+		{"auto-replied", mail.Header{"Auto-Submitted": {"auto-replied"}}, "john.doe@company.com", true},
+		{"bulk precedence", mail.Header{"Precedence": {"bulk"}}, "news@company.com", true},
+		{"x-autorespond", mail.Header{"X-Autorespond": {"yes"}}, "john.doe@company.com", true},
+		{"bounce", mail.Header{}, "mailer-daemon@company.com", true},
+		{"postmaster", mail.Header{}, "postmaster@company.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := autoSubmitted(tt.headers, &mail.Address{Address: tt.from}); got != tt.want {
+				t.Errorf("autoSubmitted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no quote", "Thanks, that fixed it.", "Thanks, that fixed it."},
+		{"quoted lines", "Still broken.\n> Did a restart help?\n>", "Still broken."},
+		{"outlook header", "Works now.\n\n-----Original Message-----\nFrom: Help Desk", "Works now."},
+		{"only quotes", "> earlier text", "> earlier text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuoted(tt.text); got != tt.want {
+				t.Errorf("StripQuoted(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsMissingSender(t *testing.T) {
+	raw := "To: help.desk@company.com\r\nSubject: No sender\r\n\r\nBody\r\n"
+	if _, err := Parse([]byte(raw)); err != ErrNoSender {
+		t.Errorf("Parse() error = %v, want ErrNoSender", err)
+	}
+	if !strings.Contains(ErrNoSender.Error(), "sender") {
+		t.Errorf("unexpected error text %q", ErrNoSender)
+	}
+}
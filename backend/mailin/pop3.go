@@ -0,0 +1,87 @@
+package mailin
+
+import (
+	"fmt"
+	"log"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// POP3 reads messages from a POP3 mailbox and deletes each handled one
+type POP3 struct {
+	Addr     string
+	TLS      bool
+	User     string
+	Password string
+}
+
+// Fetch hands every message in the mailbox to the handler. Deletions only
+// take effect when the session ends cleanly with QUIT.
+func (p *POP3) Fetch(handle Handler) error {
+	conn, err := dial(p.Addr, p.TLS)
+	if err != nil {
+		return err
+	}
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+
+	if _, err := pop3Reply(tp); err != nil {
+		return err
+	}
+	if _, err := pop3Command(tp, "USER %s", p.User); err != nil {
+		return err
+	}
+	if _, err := pop3Command(tp, "PASS %s", p.Password); err != nil {
+		return fmt.Errorf("POP3 login failed: %w", err)
+	}
+
+	status, err := pop3Command(tp, "STAT")
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(strings.Fields(status + " 0")[0])
+	if err != nil {
+		return fmt.Errorf("unexpected POP3 STAT reply %q", status)
+	}
+
+	for i := 1; i <= count; i++ {
+		if _, err := pop3Command(tp, "RETR %d", i); err != nil {
+			return err
+		}
+		raw, err := tp.ReadDotBytes()
+		if err != nil {
+			return err
+		}
+		if err := handle(raw); err != nil {
+			log.Printf("Mail ingestion: POP3 message %d failed: %v", i, err)
+			continue
+		}
+		if _, err := pop3Command(tp, "DELE %d", i); err != nil {
+			return err
+		}
+	}
+
+	_, err = pop3Command(tp, "QUIT")
+	return err
+}
+
+// pop3Command sends a command and returns the text of its +OK reply
+func pop3Command(tp *textproto.Conn, format string, args ...interface{}) (string, error) {
+	if err := tp.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return pop3Reply(tp)
+}
+
+// pop3Reply reads a status line, turning -ERR into an error
+func pop3Reply(tp *textproto.Conn) (string, error) {
+	line, err := tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if status, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(status), nil
+	}
+	return "", fmt.Errorf("POP3 server: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+}
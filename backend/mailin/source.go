@@ -0,0 +1,167 @@
+package mailin
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Handler processes one raw message. Returning nil marks the message as
+// done, so the source moves, flags or deletes it; on an error it is left in
+// place to be retried.
+type Handler func(raw []byte) error
+
+// Source is a mailbox inbound email is read from
+type Source interface {
+	Fetch(handle Handler) error
+}
+
+var ErrUnknownSource = errors.New("unknown mail source, expected maildir:, dir:, pop3(s):// or imap(s)://")
+
+// fetchTimeout bounds a whole POP3 or IMAP session
+const fetchTimeout = 5 * time.Minute
+
+// NewSource builds a source from a spec such as "maildir:/var/mail/support",
+// "dir:./fixtures", "pop3s://user@host" or "imaps://user@host/INBOX". The
+// password may be given in the URL or with MAILIN_PASSWORD.
+func NewSource(spec string) (Source, error) {
+	scheme, rest, found := strings.Cut(spec, ":")
+	if !found {
+		return nil, ErrUnknownSource
+	}
+
+	switch scheme {
+	case "maildir":
+		return Maildir(rest), nil
+	case "dir":
+		return Directory(rest), nil
+	case "pop3", "pop3s", "imap", "imaps":
+	default:
+		return nil, ErrUnknownSource
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("mail source %s needs a user name", u.Redacted())
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		password = os.Getenv("MAILIN_PASSWORD")
+	}
+	secure := strings.HasSuffix(scheme, "s")
+
+	if strings.HasPrefix(scheme, "pop3") {
+		return &POP3{Addr: address(u, secure, "110", "995"), TLS: secure, User: u.User.Username(), Password: password}, nil
+	}
+	mailbox := strings.Trim(u.Path, "/")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	return &IMAP{Addr: address(u, secure, "143", "993"), TLS: secure, User: u.User.Username(), Password: password, Mailbox: mailbox}, nil
+}
+
+// address returns the host and port of a mail server URL, using the
+// protocol's default port when the URL has none
+func address(u *url.URL, secure bool, plainPort, tlsPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = plainPort
+		if secure {
+			port = tlsPort
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Directory reads every .eml file of a directory without changing it. It
+// is meant for fixtures and one-off imports; messages that were already
+// ingested are recognised by their Message-ID.
+type Directory string
+
+// Fetch hands every .eml file of the directory to the handler, in name order
+func (d Directory) Fetch(handle Handler) error {
+	paths, err := filepath.Glob(filepath.Join(string(d), "*.eml"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := handle(raw); err != nil {
+			log.Printf("Mail ingestion: %s failed: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Maildir reads new messages from a maildir and moves each handled one to
+// cur/ marked as seen
+type Maildir string
+
+// Fetch hands the messages in new/ to the handler, oldest first
+func (m Maildir) Fetch(handle Handler) error {
+	entries, err := os.ReadDir(filepath.Join(string(m), "new"))
+	if err != nil {
+		return err
+	}
+	// Maildir file names start with the delivery time
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(string(m), "new", entry.Name())
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := handle(raw); err != nil {
+			log.Printf("Mail ingestion: %s failed: %v", path, err)
+			continue
+		}
+
+		name, _, _ := strings.Cut(entry.Name(), ":")
+		if err := os.Rename(path, filepath.Join(string(m), "cur", name+":2,S")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dial connects to a mail server, with TLS from the start when asked, and
+// bounds the session with fetchTimeout
+func dial(addr string, useTLS bool) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(fetchTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
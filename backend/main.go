@@ -12,12 +12,18 @@ import (
 	"supportdesk/config"
 	"supportdesk/controllers"
 	"supportdesk/middleware"
+	"supportdesk/workers"
 )
 
 func main() {
 	// Initialize database
 	config.InitDB()
 
+	// Start background workers
+	go workers.StartSLAMonitor()
+	go workers.StartEscalationMonitor()
+	go workers.StartMailIngestion()
+
 	// Create Gin router
 	r := gin.Default()
 
@@ -26,11 +32,40 @@ func main() {
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		ExposeHeaders:    []string{"X-Impersonated-By", "X-Total-Count"},
 		AllowCredentials: true,
 	}))
 
 	// Public routes
 	r.POST("/api/auth/login", controllers.Login)
+	r.GET("/api/invitations/:token", controllers.GetInvitation)
+	r.POST("/api/invitations/:token/accept", controllers.AcceptInvitation)
+	r.GET("/api/surveys/:token", controllers.GetSurvey)
+	r.POST("/api/surveys/:token", controllers.AnswerSurvey)
+
+	// Change calendar feed - calendar clients authenticate with the feed token
+	r.GET("/api/changes.ics", middleware.CalendarFeedAuth(), controllers.GetChangeCalendarFeed)
+
+	// SCIM 2.0 provisioning - authenticated with the dedicated SCIM token
+	scim := r.Group("/scim/v2")
+	scim.Use(middleware.SCIMAuth())
+	{
+		scim.GET("/ServiceProviderConfig", controllers.SCIMServiceProviderConfig)
+
+		scim.GET("/Users", controllers.SCIMListUsers)
+		scim.POST("/Users", controllers.SCIMCreateUser)
+		scim.GET("/Users/:id", controllers.SCIMGetUser)
+		scim.PUT("/Users/:id", controllers.SCIMReplaceUser)
+		scim.PATCH("/Users/:id", controllers.SCIMPatchUser)
+		scim.DELETE("/Users/:id", controllers.SCIMDeleteUser)
+
+		scim.GET("/Groups", controllers.SCIMListGroups)
+		scim.POST("/Groups", controllers.SCIMCreateGroup)
+		scim.GET("/Groups/:id", controllers.SCIMGetGroup)
+		scim.PUT("/Groups/:id", controllers.SCIMReplaceGroup)
+		scim.PATCH("/Groups/:id", controllers.SCIMPatchGroup)
+		scim.DELETE("/Groups/:id", controllers.SCIMDeleteGroup)
+	}
 
 	// Protected routes - all require authentication
 	api := r.Group("/api")
@@ -38,6 +73,203 @@ func main() {
 	{
 		// User routes
 		api.GET("/user", controllers.GetCurrentUser)
+		api.PUT("/user/password", middleware.BlockImpersonation(), controllers.ChangePassword)
+		api.GET("/user/security-events", controllers.GetMySecurityEvents)
+		api.POST("/user/revoke-tokens", middleware.BlockImpersonation(), controllers.RevokeMyTokens)
+		api.GET("/auth/introspect", controllers.IntrospectToken)
+		api.POST("/impersonation/end", controllers.EndImpersonation)
+		api.GET("/custom-fields", controllers.GetCustomFields)
+
+		// Approvals - whoever a step names decides it, agent or not, never while impersonated
+		api.GET("/approvals", controllers.GetMyApprovals)
+		api.POST("/approvals/:id/approve", middleware.BlockImpersonation(), controllers.ApproveApproval)
+		api.POST("/approvals/:id/reject", middleware.BlockImpersonation(), controllers.RejectApproval)
+
+		// Service catalog - ordering an item raises its fulfilment ticket
+		api.GET("/catalog", controllers.GetCatalog)
+		api.GET("/catalog/:id", controllers.GetCatalogItem)
+		api.POST("/catalog/:id/order", controllers.OrderCatalogItem)
+
+		// Assets of the current user, to point tickets at
+		api.GET("/assets/mine", controllers.GetMyAssets)
+
+		// Admin user management routes
+		adminAPI := api.Group("/admin")
+		adminAPI.Use(middleware.AdminOnly())
+		{
+			adminAPI.GET("/invitations", controllers.GetInvitations)
+			adminAPI.POST("/invitations", controllers.CreateInvitation)
+			adminAPI.POST("/invitations/:id/resend", controllers.ResendInvitation)
+			adminAPI.DELETE("/invitations/:id", controllers.RevokeInvitation)
+
+			adminAPI.GET("/security-events", controllers.GetSecurityEvents)
+
+			adminAPI.GET("/users", controllers.GetUsers)
+			adminAPI.PUT("/users/:id/role", controllers.UpdateUserRole)
+			adminAPI.PUT("/users/:id/active", controllers.UpdateUserActive)
+			adminAPI.POST("/users/:id/revoke-tokens", controllers.RevokeUserTokens)
+			adminAPI.PUT("/users/:id/skills", controllers.UpdateUserSkills)
+			adminAPI.PUT("/users/:id/manager", controllers.UpdateUserManager)
+			adminAPI.PUT("/users/:id/department", controllers.UpdateUserDepartment)
+			adminAPI.POST("/users/:id/impersonate", middleware.BlockImpersonation(), controllers.StartImpersonation)
+			adminAPI.GET("/impersonations", controllers.GetImpersonationSessions)
+			adminAPI.GET("/impersonations/:id", controllers.GetImpersonationSession)
+
+			adminAPI.GET("/sla-policies", controllers.GetSLAPolicies)
+			adminAPI.POST("/sla-policies", controllers.CreateSLAPolicy)
+			adminAPI.PUT("/sla-policies/:id", controllers.UpdateSLAPolicy)
+			adminAPI.DELETE("/sla-policies/:id", controllers.DeleteSLAPolicy)
+
+			adminAPI.GET("/business-calendars", controllers.GetBusinessCalendars)
+			adminAPI.POST("/business-calendars", controllers.CreateBusinessCalendar)
+			adminAPI.GET("/business-calendars/:id", controllers.GetBusinessCalendar)
+			adminAPI.PUT("/business-calendars/:id", controllers.UpdateBusinessCalendar)
+			adminAPI.DELETE("/business-calendars/:id", controllers.DeleteBusinessCalendar)
+
+			adminAPI.POST("/queues", controllers.CreateQueue)
+			adminAPI.PUT("/queues/:id", controllers.UpdateQueue)
+			adminAPI.DELETE("/queues/:id", controllers.DeleteQueue)
+			adminAPI.GET("/queue-depth", controllers.GetQueueDepths)
+			adminAPI.GET("/routing-rules", controllers.GetRoutingRules)
+			adminAPI.POST("/routing-rules", controllers.CreateRoutingRule)
+			adminAPI.PUT("/routing-rules/:id", controllers.UpdateRoutingRule)
+			adminAPI.DELETE("/routing-rules/:id", controllers.DeleteRoutingRule)
+
+			adminAPI.GET("/escalation-rules", controllers.GetEscalationRules)
+			adminAPI.POST("/escalation-rules", controllers.CreateEscalationRule)
+			adminAPI.PUT("/escalation-rules/:id", controllers.UpdateEscalationRule)
+			adminAPI.DELETE("/escalation-rules/:id", controllers.DeleteEscalationRule)
+
+			adminAPI.GET("/reports/knowledge-gaps", controllers.GetKnowledgeGaps)
+			adminAPI.GET("/reports/macro-usage", controllers.GetMacroUsage)
+			adminAPI.GET("/reports/csat", controllers.GetCSATReport)
+			adminAPI.GET("/reports/time", controllers.GetTimeReport)
+
+			adminAPI.POST("/custom-fields", controllers.CreateCustomField)
+			adminAPI.PUT("/custom-fields/:id", controllers.UpdateCustomField)
+			adminAPI.DELETE("/custom-fields/:id", controllers.DeleteCustomField)
+			adminAPI.GET("/exports/articles", controllers.ExportArticles)
+
+			adminAPI.GET("/approval-chains", controllers.GetApprovalChains)
+			adminAPI.POST("/approval-chains", controllers.CreateApprovalChain)
+			adminAPI.PUT("/approval-chains/:id", controllers.UpdateApprovalChain)
+			adminAPI.DELETE("/approval-chains/:id", controllers.DeleteApprovalChain)
+
+			adminAPI.GET("/catalog", controllers.GetCatalogItems)
+			adminAPI.POST("/catalog", controllers.CreateCatalogItem)
+			adminAPI.PUT("/catalog/:id", controllers.UpdateCatalogItem)
+			adminAPI.DELETE("/catalog/:id", controllers.DeleteCatalogItem)
+
+			adminAPI.DELETE("/problems/:id", controllers.DeleteProblem)
+			adminAPI.DELETE("/changes/:id", controllers.DeleteChangeRequest)
+			adminAPI.DELETE("/assets/:id", controllers.DeleteAsset)
+			adminAPI.POST("/assets/import", controllers.ImportAssets)
+		}
+
+		// Ticket routes - requesters see their own tickets, agents work all tickets
+		tickets := api.Group("/tickets")
+		{
+			tickets.GET("", controllers.GetTickets)
+			tickets.POST("", controllers.CreateTicket)
+			tickets.GET("/:id", controllers.GetTicket)
+			tickets.PUT("/:id/status", controllers.UpdateTicketStatus)
+			tickets.GET("/:id/articles", controllers.GetTicketArticles)
+			tickets.GET("/:id/messages", controllers.GetTicketMessages)
+			tickets.POST("/:id/messages", controllers.AddTicketMessage)
+			tickets.GET("/:id/attachments/:attachment_id", controllers.DownloadTicketAttachment)
+			tickets.GET("/:id/approvals", controllers.GetTicketApprovals)
+
+			agent := tickets.Group("")
+			agent.Use(middleware.AgentOnly())
+			{
+				agent.PUT("/:id", controllers.UpdateTicket)
+				agent.PUT("/:id/assign", controllers.AssignTicket)
+				agent.GET("/:id/sla-events", controllers.GetTicketSLAEvents)
+				agent.PUT("/:id/queue", controllers.MoveTicketToQueue)
+				agent.GET("/:id/escalations", controllers.GetTicketEscalations)
+				agent.POST("/:id/watchers", controllers.AddTicketWatcher)
+				agent.DELETE("/:id/watchers/:user_id", controllers.RemoveTicketWatcher)
+				agent.POST("/:id/articles", controllers.LinkTicketArticle)
+				agent.DELETE("/:id/articles/:task_id", controllers.UnlinkTicketArticle)
+				agent.PUT("/:id/tags", controllers.UpdateTicketTags)
+				agent.POST("/:id/macros/:macro_id", controllers.ApplyMacro)
+				agent.GET("/:id/survey", controllers.GetTicketSurvey)
+				agent.GET("/:id/duplicates", controllers.GetTicketDuplicates)
+				agent.POST("/:id/merge", controllers.MergeTickets)
+				agent.GET("/:id/time-entries", controllers.GetTicketTime)
+				agent.POST("/:id/time-entries", controllers.LogTicketTime)
+				agent.POST("/:id/timer", controllers.StartTicketTimer)
+				agent.POST("/:id/major-incident", controllers.DeclareMajorIncident)
+				agent.POST("/:id/major-incident/resolve", controllers.ResolveMajorIncident)
+				agent.GET("/:id/children", controllers.GetIncidentChildren)
+				agent.POST("/:id/children", controllers.LinkIncidentChildren)
+				agent.DELETE("/:id/children/:child_id", controllers.UnlinkIncidentChild)
+				agent.GET("/:id/timeline", controllers.GetIncidentTimeline)
+				agent.POST("/:id/timeline", controllers.PostIncidentUpdate)
+				agent.GET("/:id/known-errors", controllers.GetTicketKnownErrors)
+				agent.POST("/:id/known-errors/:problem_id/apply", controllers.ApplyWorkaround)
+				agent.POST("/:id/assets", controllers.LinkTicketAssets)
+				agent.DELETE("/:id/assets/:asset_id", controllers.UnlinkTicketAsset)
+			}
+		}
+
+		// Agent routes - queues, availability, timers, problems, changes, assets, canned responses, macros and exports
+		agentAPI := api.Group("")
+		agentAPI.Use(middleware.AgentOnly())
+		{
+			agentAPI.GET("/queues", controllers.GetQueues)
+			agentAPI.GET("/major-incidents", controllers.GetMajorIncidents)
+
+			agentAPI.GET("/problems", controllers.GetProblems)
+			agentAPI.POST("/problems", controllers.CreateProblem)
+			agentAPI.GET("/problems/:id", controllers.GetProblem)
+			agentAPI.PUT("/problems/:id", controllers.UpdateProblem)
+			agentAPI.PUT("/problems/:id/status", controllers.UpdateProblemStatus)
+			agentAPI.GET("/problems/:id/tickets", controllers.GetProblemTickets)
+			agentAPI.POST("/problems/:id/tickets", controllers.LinkProblemTickets)
+			agentAPI.DELETE("/problems/:id/tickets/:ticket_id", controllers.UnlinkProblemTicket)
+			agentAPI.GET("/known-errors", controllers.GetKnownErrors)
+
+			agentAPI.GET("/changes", controllers.GetChangeRequests)
+			agentAPI.POST("/changes", controllers.CreateChangeRequest)
+			agentAPI.GET("/changes/calendar", controllers.GetChangeCalendar)
+			agentAPI.GET("/changes/conflicts", controllers.CheckChangeConflicts)
+			agentAPI.GET("/changes/:id", controllers.GetChangeRequest)
+			agentAPI.PUT("/changes/:id", controllers.UpdateChangeRequest)
+			agentAPI.PUT("/changes/:id/status", controllers.UpdateChangeStatus)
+			agentAPI.POST("/changes/:id/approve", middleware.BlockImpersonation(), controllers.ApproveChangeRequest)
+			agentAPI.POST("/changes/:id/reject", middleware.BlockImpersonation(), controllers.RejectChangeRequest)
+			agentAPI.POST("/changes/:id/assets", controllers.LinkChangeAssets)
+			agentAPI.DELETE("/changes/:id/assets/:asset_id", controllers.UnlinkChangeAsset)
+
+			agentAPI.GET("/assets", controllers.GetAssets)
+			agentAPI.POST("/assets", controllers.CreateAsset)
+			agentAPI.GET("/assets/:id", controllers.GetAsset)
+			agentAPI.PUT("/assets/:id", controllers.UpdateAsset)
+			agentAPI.POST("/assets/:id/relations", controllers.AddAssetRelation)
+			agentAPI.DELETE("/assets/:id/relations/:relation_id", controllers.RemoveAssetRelation)
+			agentAPI.GET("/assets/:id/tickets", controllers.GetAssetTickets)
+			agentAPI.GET("/assets/:id/changes", controllers.GetAssetChanges)
+			agentAPI.PUT("/user/away", controllers.UpdateMyAway)
+
+			agentAPI.GET("/timer", controllers.GetMyTimer)
+			agentAPI.POST("/timer/stop", controllers.StopMyTimer)
+			agentAPI.PUT("/time-entries/:id", controllers.UpdateTimeEntry)
+			agentAPI.DELETE("/time-entries/:id", controllers.DeleteTimeEntry)
+
+			agentAPI.GET("/canned-responses", controllers.GetCannedResponses)
+			agentAPI.POST("/canned-responses", controllers.CreateCannedResponse)
+			agentAPI.PUT("/canned-responses/:id", controllers.UpdateCannedResponse)
+			agentAPI.DELETE("/canned-responses/:id", controllers.DeleteCannedResponse)
+			agentAPI.GET("/canned-responses/:id/render", controllers.RenderCannedResponse)
+
+			agentAPI.GET("/macros", controllers.GetMacros)
+			agentAPI.POST("/macros", controllers.CreateMacro)
+			agentAPI.PUT("/macros/:id", controllers.UpdateMacro)
+			agentAPI.DELETE("/macros/:id", controllers.DeleteMacro)
+
+			agentAPI.GET("/exports/tickets", controllers.ExportTickets)
+		}
 
 		// Dashboard routes
 		dashboard := api.Group("/dashboard")
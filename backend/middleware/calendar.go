@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarFeedAuth validates the token query parameter of calendar feeds.
+// Calendar clients cannot send an Authorization header, so subscriptions use
+// a shared secret in the URL. The feed stays disabled until
+// CHANGE_CALENDAR_TOKEN is set.
+func CalendarFeedAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := os.Getenv("CHANGE_CALENDAR_TOKEN")
+		if expected == "" {
+			log.Println("CalendarFeedAuth: CHANGE_CALENDAR_TOKEN not set, rejecting feed request")
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed is not configured"})
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(expected)) != 1 {
+			log.Printf("CalendarFeedAuth: Invalid token from %s", c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -103,10 +103,76 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if !user.Active {
+			log.Printf("AuthMiddleware: Rejecting token for deactivated user %d", user.ID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token: User account is deactivated"})
+			c.Abort()
+			return
+		}
+
+		// Reject tokens issued before the user's last role, password or status change.
+		// Tokens issued before security stamps existed count as version 0.
+		var tokenVersion uint
+		if version, ok := claims["ver"].(float64); ok {
+			tokenVersion = uint(version)
+		}
+		if tokenVersion != user.TokenVersion {
+			log.Printf("AuthMiddleware: Stale token version %d for user %d (current %d)", tokenVersion, user.ID, user.TokenVersion)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked, please log in again"})
+			c.Abort()
+			return
+		}
+
 		// Set user information in the context
 		c.Set("user_id", user.ID) // Used by controllers
 		c.Set("role", user.Role)   // Used by AdminOnly middleware and controllers
 
+		// Tokens issued for "act as user" carry the session they belong to
+		if sessionID, ok := claims["impersonation_session_id"].(float64); ok {
+			handleImpersonation(c, user, uint(sessionID))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// handleImpersonation validates an impersonation session, flags the request
+// and records it once the handler has run
+func handleImpersonation(c *gin.Context, user *models.User, sessionID uint) {
+	session, err := models.GetImpersonationSession(sessionID)
+	if err != nil || !session.IsActive() || session.TargetUserID != user.ID ||
+		session.Admin.Role != "admin" || !session.Admin.Active {
+		log.Printf("AuthMiddleware: Rejecting token for inactive impersonation session %d", sessionID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation session has ended"})
+		c.Abort()
+		return
+	}
+
+	c.Set("impersonator_id", session.AdminID)
+	c.Set("impersonation_session_id", session.ID)
+	c.Header("X-Impersonated-By", session.Admin.Email)
+	log.Printf("Impersonation: %s acting as %s: %s %s", session.Admin.Email, user.Email, c.Request.Method, c.Request.URL.Path)
+
+	c.Next()
+
+	models.RecordImpersonationAction(models.ImpersonationAction{
+		SessionID:  session.ID,
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.RequestURI(),
+		StatusCode: c.Writer.Status(),
+		IPAddress:  c.ClientIP(),
+	})
+}
+
+// BlockImpersonation rejects sensitive actions on requests made while impersonating
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("impersonator_id"); impersonating {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not allowed while impersonating a user"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -140,15 +206,53 @@ func AdminOnly() gin.HandlerFunc {
 	}
 }
 
+// AgentOnly middleware ensures that only agents (and admins) can access the route
+func AgentOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := c.Get("role")
+		if !ok {
+			log.Println("AgentOnly: 'role' not found in context. AuthMiddleware might not have run or set it.")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: User role not determined"})
+			c.Abort()
+			return
+		}
+
+		if roleName, isString := role.(string); !isString || !models.IsAgentRole(roleName) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: Agent privileges required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // GenerateToken should be THE function used to create JWTs (e.g., in your Login controller)
 func GenerateToken(user models.User) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"id":      user.ID,   // Keep both for compatibility
 		"role":    user.Role, // Good to include for quick checks, though AuthMiddleware re-verifies from DB
+		"ver":     user.TokenVersion, // Security stamp, tokens with an old version are rejected
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
 		"iat":     time.Now().Unix(), // Issued At
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(getJWTSecret())
-}
\ No newline at end of file
+}
+
+// GenerateImpersonationToken creates a token for the target user of an
+// impersonation session. It expires together with the session.
+func GenerateImpersonationToken(session models.ImpersonationSession) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":                  session.TargetUser.ID,
+		"id":                       session.TargetUser.ID,
+		"role":                     session.TargetUser.Role,
+		"impersonator_id":          session.AdminID,
+		"impersonation_session_id": session.ID,
+		"ver":                      session.TargetUser.TokenVersion,
+		"exp":                      session.ExpiresAt.Unix(),
+		"iat":                      time.Now().Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(getJWTSecret())
+}
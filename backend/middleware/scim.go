@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMAuth validates the dedicated bearer token used by the identity provider.
+// Provisioning stays disabled until SCIM_TOKEN is set.
+func SCIMAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := os.Getenv("SCIM_TOKEN")
+		if expected == "" {
+			log.Println("SCIMAuth: SCIM_TOKEN not set, rejecting provisioning request")
+			scimUnauthorized(c, "SCIM provisioning is not configured")
+			return
+		}
+
+		parts := strings.Fields(c.GetHeader("Authorization"))
+		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+			scimUnauthorized(c, "Authorization header format must be Bearer {token}")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(expected)) != 1 {
+			log.Printf("SCIMAuth: Invalid token from %s", c.ClientIP())
+			scimUnauthorized(c, "Invalid token")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func scimUnauthorized(c *gin.Context, detail string) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+		"status":  "401",
+		"detail":  detail,
+	})
+	c.Abort()
+}
@@ -12,12 +12,22 @@ func CreateUsersTable(db *gorm.DB) error {
 // User represents a user in the system
 type User struct {
 	gorm.Model
-	Email    string `gorm:"uniqueIndex;not null"`
-	Password string `gorm:"not null"`
-	Role     string `gorm:"default:'user'"`
+	Email        string `gorm:"uniqueIndex;not null"`
+	Password     string `gorm:"not null"`
+	Role         string `gorm:"default:'user'"`
+	Name         string
+	GivenName    string
+	FamilyName   string
+	ExternalID   string   `gorm:"index"`
+	Active       bool     `gorm:"not null;default:true"`
+	TokenVersion uint     `gorm:"not null;default:0"`
+	Skills       []string `gorm:"type:text[]"`
+	Away         bool     `gorm:"not null;default:false"`
+	ManagerID    *uint    `gorm:"index"` // Approves requests needing the requester's manager
+	Department   string   `gorm:"index"`
 }
 
 // TableName specifies the table name for User
 func (User) TableName() string {
 	return "users"
-} 
\ No newline at end of file
+}
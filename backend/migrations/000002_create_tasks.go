@@ -23,14 +23,16 @@ func CreateTasksTable(db *gorm.DB) error {
 // Task represents a support task in the system
 type Task struct {
 	gorm.Model
-	Title       string   `gorm:"not null"`
-	Description string
-	Content     string   `gorm:"type:text"`
-	Type        string   `gorm:"type:text"`
-	Category    string   `gorm:"index;not null"`
-	Status      string   `gorm:"default:'pending'"`
-	Rating      float64  `gorm:"default:0"`
-	Keywords    []string `gorm:"type:text[]"`
-	UserID      uint
-	User        User     `gorm:"foreignKey:UserID"`
+	Title        string `gorm:"not null"`
+	Description  string
+	Content      string   `gorm:"type:text"`
+	Type         string   `gorm:"type:text"`
+	Category     string   `gorm:"index;not null"`
+	Status       string   `gorm:"default:'pending'"`
+	Rating       float64  `gorm:"default:0"`
+	Keywords     []string `gorm:"type:text[]"`
+	SolvedCount  int      `gorm:"not null;default:0"`
+	CustomFields string   `gorm:"type:jsonb;not null;default:'{}'"` // Values of the custom fields of the category
+	UserID       uint
+	User         User `gorm:"foreignKey:UserID"`
 } 
\ No newline at end of file
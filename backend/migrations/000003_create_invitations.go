@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateInvitationsTable creates the invitations table
+func CreateInvitationsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Invitation{})
+}
+
+// Invitation represents a pending invite for a new user
+type Invitation struct {
+	gorm.Model
+	Email       string `gorm:"index;not null"`
+	Role        string `gorm:"not null;default:'user'"`
+	TokenHash   string `gorm:"uniqueIndex;not null"`
+	ExpiresAt   time.Time
+	InvitedByID uint
+	InvitedBy   User `gorm:"foreignKey:InvitedByID"`
+	AcceptedAt  *time.Time
+	RevokedAt   *time.Time
+	SentCount   int `gorm:"default:0"`
+	LastSentAt  *time.Time
+}
+
+// TableName specifies the table name for Invitation
+func (Invitation) TableName() string {
+	return "invitations"
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateGroupsTable creates the groups table and its membership join table
+func CreateGroupsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Group{})
+}
+
+// Group represents a provisioned group of users
+type Group struct {
+	ID          uint   `gorm:"primaryKey"`
+	DisplayName string `gorm:"uniqueIndex;not null"`
+	ExternalID  string `gorm:"index"`
+	Role        string
+	Members     []User `gorm:"many2many:group_members"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TableName specifies the table name for Group
+func (Group) TableName() string {
+	return "groups"
+}
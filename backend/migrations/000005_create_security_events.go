@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateSecurityEventsTable creates the security_events table
+func CreateSecurityEventsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SecurityEvent{})
+}
+
+// SecurityEvent represents an entry in the security event log
+type SecurityEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    *uint  `gorm:"index"`
+	Email     string `gorm:"index"`
+	Type      string `gorm:"index;not null"`
+	IPAddress string
+	UserAgent string
+	Details   string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name for SecurityEvent
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
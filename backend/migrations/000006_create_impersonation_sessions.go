@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateImpersonationTables creates the impersonation session and action tables
+func CreateImpersonationTables(db *gorm.DB) error {
+	return db.AutoMigrate(&ImpersonationSession{}, &ImpersonationAction{})
+}
+
+// ImpersonationSession represents an admin acting as another user
+type ImpersonationSession struct {
+	ID           uint `gorm:"primaryKey"`
+	AdminID      uint `gorm:"index;not null"`
+	Admin        User `gorm:"foreignKey:AdminID"`
+	TargetUserID uint `gorm:"index;not null"`
+	TargetUser   User `gorm:"foreignKey:TargetUserID"`
+	Reason       string
+	ExpiresAt    time.Time
+	EndedAt      *time.Time
+	CreatedAt    time.Time
+}
+
+// TableName specifies the table name for ImpersonationSession
+func (ImpersonationSession) TableName() string {
+	return "impersonation_sessions"
+}
+
+// ImpersonationAction represents a request made during an impersonation session
+type ImpersonationAction struct {
+	ID         uint                 `gorm:"primaryKey"`
+	SessionID  uint                 `gorm:"index;not null"`
+	Session    ImpersonationSession `gorm:"foreignKey:SessionID"`
+	Method     string
+	Path       string
+	StatusCode int
+	IPAddress  string
+	CreatedAt  time.Time
+}
+
+// TableName specifies the table name for ImpersonationAction
+func (ImpersonationAction) TableName() string {
+	return "impersonation_actions"
+}
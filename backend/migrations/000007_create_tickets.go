@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTicketsTable creates the tickets table
+func CreateTicketsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Ticket{})
+}
+
+// Ticket represents a support request raised by a user
+type Ticket struct {
+	gorm.Model
+	Subject          string `gorm:"not null"`
+	Description      string `gorm:"type:text"`
+	RequesterID      uint   `gorm:"index;not null"`
+	Requester        User   `gorm:"foreignKey:RequesterID"`
+	AssigneeID       *uint  `gorm:"index"`
+	Assignee         *User  `gorm:"foreignKey:AssigneeID"`
+	QueueID          *uint  `gorm:"index"`
+	RequiredSkill    string
+	Priority         string `gorm:"not null;default:'P3'"`
+	Category         string `gorm:"index;not null"`
+	Status           string `gorm:"index;not null;default:'new'"`
+	FirstRespondedAt *time.Time
+	LastAgentReplyAt *time.Time
+	ResolvedAt       *time.Time
+	ClosedAt         *time.Time
+	CloseReason      string
+	SolvedByTaskID   *uint    `gorm:"index"`
+	Source           string   `gorm:"not null;default:'web'"`
+	EmailMessageID   string   `gorm:"index"` // Message-ID header of the email that raised the ticket
+	Tags             []string `gorm:"type:text[]"`
+	MergedIntoID     *uint    `gorm:"index"`                            // Primary ticket this one was merged into
+	CustomFields     string   `gorm:"type:jsonb;not null;default:'{}'"` // Values of the custom fields of the category
+	RequestType      string   `gorm:"index"`                            // Selects the approval chain, if any
+	ApprovalStatus   string   `gorm:"index"`                            // Empty when no approval is needed
+	ApprovedAt       *time.Time
+	CatalogItemID    *uint      `gorm:"index"`                            // Service catalog item the ticket was ordered from
+	FormAnswers      string     `gorm:"type:jsonb;not null;default:'{}'"` // Answers to the item's request form
+	ExpectedBy       *time.Time // Promised delivery of a catalog order
+	MajorIncident    bool       `gorm:"not null;default:false;index"`
+	ParentID         *uint      `gorm:"index"` // Major incident the ticket is a child of
+	ProblemID        *uint      `gorm:"index"` // Problem the incident is attributed to
+}
+
+// TableName specifies the table name for Ticket
+func (Ticket) TableName() string {
+	return "tickets"
+}
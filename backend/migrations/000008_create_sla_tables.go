@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateSLATables creates the SLA policy, timer and event tables
+func CreateSLATables(db *gorm.DB) error {
+	return db.AutoMigrate(&SLAPolicy{}, &SLATimer{}, &SLAEvent{})
+}
+
+// SLAPolicy holds response and resolution targets for a priority and category
+type SLAPolicy struct {
+	gorm.Model
+	Name                 string `gorm:"not null"`
+	Priority             string `gorm:"index;not null"`
+	Category             string `gorm:"index"`
+	FirstResponseMinutes int
+	ResolutionMinutes    int
+	CalendarID           *uint    `gorm:"index"`
+	PauseStatuses        []string `gorm:"type:text[];default:'{pending}'"`
+	Active               bool     `gorm:"not null"`
+}
+
+// TableName specifies the table name for SLAPolicy
+func (SLAPolicy) TableName() string {
+	return "sla_policies"
+}
+
+// SLATimer tracks one SLA target of a ticket
+type SLATimer struct {
+	ID            uint      `gorm:"primaryKey"`
+	TicketID      uint      `gorm:"index;not null"`
+	Ticket        Ticket    `gorm:"foreignKey:TicketID"`
+	PolicyID      uint      `gorm:"index"`
+	Policy        SLAPolicy `gorm:"foreignKey:PolicyID"`
+	Metric        string    `gorm:"not null"`
+	TargetMinutes int
+	CalendarID    *uint `gorm:"index"`
+	StartedAt     time.Time
+	DueAt         time.Time `gorm:"index"`
+	CompletedAt   *time.Time
+	PausedAt      *time.Time
+	PausedSeconds int64 `gorm:"not null;default:0"`
+	AtRiskAt      *time.Time
+	BreachedAt    *time.Time
+	Status        string `gorm:"index;not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName specifies the table name for SLATimer
+func (SLATimer) TableName() string {
+	return "sla_timers"
+}
+
+// SLAEvent records an SLA state change of a ticket
+type SLAEvent struct {
+	ID             uint     `gorm:"primaryKey"`
+	TicketID       uint     `gorm:"index;not null"`
+	TimerID        uint     `gorm:"index"`
+	Timer          SLATimer `gorm:"foreignKey:TimerID"`
+	Metric         string
+	Type           string `gorm:"not null"`
+	TicketStatus   string
+	ElapsedSeconds int64
+	CreatedAt      time.Time
+}
+
+// TableName specifies the table name for SLAEvent
+func (SLAEvent) TableName() string {
+	return "sla_events"
+}
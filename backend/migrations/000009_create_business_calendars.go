@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateBusinessCalendarTables creates the business-hours calendar tables
+func CreateBusinessCalendarTables(db *gorm.DB) error {
+	return db.AutoMigrate(&BusinessCalendar{}, &BusinessHours{}, &BusinessHoliday{})
+}
+
+// BusinessCalendar holds the working hours SLA targets are measured in
+type BusinessCalendar struct {
+	gorm.Model
+	Name     string `gorm:"uniqueIndex;not null"`
+	Timezone string `gorm:"not null"`
+}
+
+// BusinessHours is one working interval on a weekday of a calendar
+type BusinessHours struct {
+	ID         uint             `gorm:"primaryKey"`
+	CalendarID uint             `gorm:"index;not null"`
+	Calendar   BusinessCalendar `gorm:"foreignKey:CalendarID;constraint:OnDelete:CASCADE"`
+	Weekday    int              `gorm:"not null"`
+	StartTime  string           `gorm:"size:5;not null"`
+	EndTime    string           `gorm:"size:5;not null"`
+}
+
+// BusinessHoliday is a day without business hours in a calendar
+type BusinessHoliday struct {
+	ID         uint             `gorm:"primaryKey"`
+	CalendarID uint             `gorm:"uniqueIndex:idx_calendar_holiday;not null"`
+	Calendar   BusinessCalendar `gorm:"foreignKey:CalendarID;constraint:OnDelete:CASCADE"`
+	Date       string           `gorm:"uniqueIndex:idx_calendar_holiday;size:10;not null"`
+	Name       string
+	CreatedAt  time.Time
+}
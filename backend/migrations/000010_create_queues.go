@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateQueueTables creates the queue, queue membership and routing rule tables
+func CreateQueueTables(db *gorm.DB) error {
+	return db.AutoMigrate(&Queue{}, &RoutingRule{})
+}
+
+// Queue is a named pile of tickets worked by its member agents
+type Queue struct {
+	ID             uint   `gorm:"primaryKey"`
+	Name           string `gorm:"uniqueIndex;not null"`
+	Description    string
+	Strategy       string `gorm:"not null;default:'manual'"`
+	LastAssignedID *uint
+	Members        []User `gorm:"many2many:queue_members"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// TableName specifies the table name for Queue
+func (Queue) TableName() string {
+	return "queues"
+}
+
+// RoutingRule sends new tickets matching its conditions to a queue
+type RoutingRule struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"not null"`
+	Position      int    `gorm:"index;not null;default:0"`
+	QueueID       uint   `gorm:"index;not null"`
+	Queue         Queue  `gorm:"foreignKey:QueueID;constraint:OnDelete:CASCADE"`
+	Category      string
+	Priority      string
+	Keyword       string
+	RequiredSkill string
+	Active        bool `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName specifies the table name for RoutingRule
+func (RoutingRule) TableName() string {
+	return "routing_rules"
+}
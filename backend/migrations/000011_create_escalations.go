@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateEscalationTables creates the escalation rule, escalation log and ticket watcher tables
+func CreateEscalationTables(db *gorm.DB) error {
+	return db.AutoMigrate(&EscalationRule{}, &EscalationLog{}, &TicketWatcher{})
+}
+
+// EscalationRule fires its actions on tickets left too long in a state
+type EscalationRule struct {
+	gorm.Model
+	Name             string `gorm:"not null"`
+	Position         int    `gorm:"not null;default:0"`
+	Trigger          string `gorm:"not null"`
+	ThresholdMinutes int    `gorm:"not null"`
+	CalendarID       *uint  `gorm:"index"`
+	Priority         string
+	Category         string
+	QueueID          *uint `gorm:"index"`
+	ReassignToID     *uint
+	ReassignQueueID  *uint
+	RaisePriority    bool `gorm:"not null;default:false"`
+	NotifyUserID     *uint
+	WatcherID        *uint
+	Active           bool `gorm:"not null"`
+}
+
+// TableName specifies the table name for EscalationRule
+func (EscalationRule) TableName() string {
+	return "escalation_rules"
+}
+
+// EscalationLog records each time a rule fired on a ticket. The anchor is
+// the moment the rule measured from, so a rule fires once per anchor.
+type EscalationLog struct {
+	ID        uint           `gorm:"primaryKey"`
+	RuleID    uint           `gorm:"uniqueIndex:idx_escalation_once;not null"`
+	Rule      EscalationRule `gorm:"foreignKey:RuleID"`
+	TicketID  uint           `gorm:"uniqueIndex:idx_escalation_once;index;not null"`
+	Ticket    Ticket         `gorm:"foreignKey:TicketID"`
+	Anchor    time.Time      `gorm:"uniqueIndex:idx_escalation_once;not null"`
+	Actions   string         `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name for EscalationLog
+func (EscalationLog) TableName() string {
+	return "escalation_logs"
+}
+
+// TicketWatcher is a user following a ticket
+type TicketWatcher struct {
+	TicketID uint   `gorm:"primaryKey"`
+	Ticket   Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	UserID   uint   `gorm:"primaryKey"`
+	User     User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName specifies the table name for TicketWatcher
+func (TicketWatcher) TableName() string {
+	return "ticket_watchers"
+}
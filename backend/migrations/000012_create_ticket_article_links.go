@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTicketArticleLinksTable creates the table linking tickets to knowledge articles
+func CreateTicketArticleLinksTable(db *gorm.DB) error {
+	return db.AutoMigrate(&TicketArticleLink{})
+}
+
+// TicketArticleLink connects a ticket with a knowledge article (task)
+type TicketArticleLink struct {
+	ID         uint   `gorm:"primaryKey"`
+	TicketID   uint   `gorm:"uniqueIndex:idx_ticket_article;not null"`
+	Ticket     Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	TaskID     uint   `gorm:"uniqueIndex:idx_ticket_article;index;not null"`
+	Task       Task   `gorm:"foreignKey:TaskID;constraint:OnDelete:CASCADE"`
+	LinkedByID uint
+	CreatedAt  time.Time
+}
+
+// TableName specifies the table name for TicketArticleLink
+func (TicketArticleLink) TableName() string {
+	return "ticket_article_links"
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTicketMessagesTable creates the ticket message and attachment tables
+func CreateTicketMessagesTable(db *gorm.DB) error {
+	return db.AutoMigrate(&TicketMessage{}, &TicketAttachment{})
+}
+
+// TicketMessage is a reply in the conversation of a ticket
+type TicketMessage struct {
+	ID             uint   `gorm:"primaryKey"`
+	TicketID       uint   `gorm:"index;not null"`
+	Ticket         Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	AuthorID       uint   `gorm:"index;not null"`
+	Author         User   `gorm:"foreignKey:AuthorID"`
+	Body           string `gorm:"type:text;not null"`
+	Visibility     string `gorm:"index;not null;default:'public'"`
+	Source         string `gorm:"not null;default:'web'"`
+	EmailMessageID string `gorm:"index"` // Message-ID header of the email the message came from
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// TableName specifies the table name for TicketMessage
+func (TicketMessage) TableName() string {
+	return "ticket_messages"
+}
+
+// TicketAttachment is a file attached to a ticket or to one of its messages
+type TicketAttachment struct {
+	ID              uint           `gorm:"primaryKey"`
+	TicketID        uint           `gorm:"index;not null"`
+	Ticket          Ticket         `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	TicketMessageID *uint          `gorm:"index"`
+	TicketMessage   *TicketMessage `gorm:"foreignKey:TicketMessageID;constraint:OnDelete:CASCADE"`
+	Filename        string         `gorm:"not null"`
+	ContentType     string
+	Size            int64
+	Checksum        string // SHA-256 of the content
+	StoragePath     string `gorm:"not null"`
+	CreatedAt       time.Time
+}
+
+// TableName specifies the table name for TicketAttachment
+func (TicketAttachment) TableName() string {
+	return "ticket_attachments"
+}
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCannedResponseTables creates the canned response, macro and macro usage tables
+func CreateCannedResponseTables(db *gorm.DB) error {
+	return db.AutoMigrate(&CannedResponse{}, &Macro{}, &MacroUsage{})
+}
+
+// CannedResponse is a reusable reply text. It belongs to its owner, is
+// shared with the members of a queue, or with every agent when it has neither.
+type CannedResponse struct {
+	ID         uint   `gorm:"primaryKey"`
+	Title      string `gorm:"not null"`
+	Body       string `gorm:"type:text;not null"`
+	OwnerID    *uint  `gorm:"index"`
+	Owner      *User  `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
+	QueueID    *uint  `gorm:"index"`
+	Queue      *Queue `gorm:"foreignKey:QueueID;constraint:OnDelete:CASCADE"`
+	ArticleID  *uint
+	Article    *Task `gorm:"foreignKey:ArticleID;constraint:OnDelete:SET NULL"`
+	UsageCount int64 `gorm:"not null;default:0"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// TableName specifies the table name for CannedResponse
+func (CannedResponse) TableName() string {
+	return "canned_responses"
+}
+
+// Macro applies a reply and ticket field changes in one action. It is
+// scoped like a canned response.
+type Macro struct {
+	ID              uint   `gorm:"primaryKey"`
+	Name            string `gorm:"not null"`
+	Description     string
+	OwnerID         *uint  `gorm:"index"`
+	Owner           *User  `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE"`
+	QueueID         *uint  `gorm:"index"`
+	Queue           *Queue `gorm:"foreignKey:QueueID;constraint:OnDelete:CASCADE"`
+	ReplyBody       string `gorm:"type:text"`
+	ReplyVisibility string `gorm:"not null;default:'public'"`
+	ArticleID       *uint
+	Article         *Task `gorm:"foreignKey:ArticleID;constraint:OnDelete:SET NULL"`
+	Status          string
+	Priority        string
+	AddTags         []string `gorm:"type:text[]"`
+	RemoveTags      []string `gorm:"type:text[]"`
+	AssigneeID      *uint
+	Assignee        *User `gorm:"foreignKey:AssigneeID;constraint:OnDelete:SET NULL"`
+	AssignToSelf    bool  `gorm:"not null;default:false"`
+	UsageCount      int64 `gorm:"not null;default:0"`
+	LastUsedAt      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// TableName specifies the table name for Macro
+func (Macro) TableName() string {
+	return "macros"
+}
+
+// MacroUsage records a macro being applied to a ticket
+type MacroUsage struct {
+	ID        uint      `gorm:"primaryKey"`
+	MacroID   uint      `gorm:"index;not null"`
+	Macro     Macro     `gorm:"foreignKey:MacroID;constraint:OnDelete:CASCADE"`
+	TicketID  uint      `gorm:"index;not null"`
+	Ticket    Ticket    `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	UserID    uint      `gorm:"index;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName specifies the table name for MacroUsage
+func (MacroUsage) TableName() string {
+	return "macro_usages"
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCSATSurveysTable creates the customer satisfaction survey table
+func CreateCSATSurveysTable(db *gorm.DB) error {
+	return db.AutoMigrate(&CSATSurvey{})
+}
+
+// CSATSurvey asks the requester of a resolved ticket how satisfied they
+// were. The agent, queue and category are kept as they were at resolution.
+type CSATSurvey struct {
+	ID          uint   `gorm:"primaryKey"`
+	TicketID    uint   `gorm:"uniqueIndex;not null"`
+	Ticket      Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	TokenHash   string `gorm:"uniqueIndex;not null"`
+	RequesterID uint   `gorm:"index;not null"`
+	AgentID     *uint  `gorm:"index"`
+	QueueID     *uint  `gorm:"index"`
+	Category    string `gorm:"index"`
+	ExpiresAt   time.Time
+	Score       *int
+	Comment     string     `gorm:"type:text"`
+	RespondedAt *time.Time `gorm:"index"`
+	FollowUp    string     // What was done about a low score
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TableName specifies the table name for CSATSurvey
+func (CSATSurvey) TableName() string {
+	return "csat_surveys"
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// CreateTicketCCsTable creates the table of users copied on tickets
+func CreateTicketCCsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&TicketCC{})
+}
+
+// TicketCC is a user copied on a ticket besides its requester, such as the
+// requester of a ticket merged into it
+type TicketCC struct {
+	TicketID uint   `gorm:"primaryKey"`
+	Ticket   Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	UserID   uint   `gorm:"primaryKey"`
+	User     User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName specifies the table name for TicketCC
+func (TicketCC) TableName() string {
+	return "ticket_ccs"
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCustomFieldsTable creates the table of admin-defined custom fields
+func CreateCustomFieldsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&CustomField{})
+}
+
+// CustomField is a field tickets or articles of a category carry besides
+// their built-in ones
+type CustomField struct {
+	ID        uint     `gorm:"primaryKey"`
+	Entity    string   `gorm:"uniqueIndex:idx_custom_field_key;not null"` // ticket or article
+	Category  string   `gorm:"uniqueIndex:idx_custom_field_key;not null"`
+	Key       string   `gorm:"uniqueIndex:idx_custom_field_key;not null"`
+	Label     string   `gorm:"not null"`
+	Type      string   `gorm:"not null"`
+	Required  bool     `gorm:"not null;default:false"`
+	Options   []string `gorm:"type:text[]"` // Choices of select fields
+	Position  int      `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName specifies the table name for CustomField
+func (CustomField) TableName() string {
+	return "custom_fields"
+}
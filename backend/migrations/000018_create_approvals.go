@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateApprovalTables creates the approval chain, step and ticket approval tables
+func CreateApprovalTables(db *gorm.DB) error {
+	return db.AutoMigrate(&ApprovalChain{}, &ApprovalStep{}, &TicketApproval{})
+}
+
+// ApprovalChain lists who must sign off a request type before it is worked
+type ApprovalChain struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"not null"`
+	RequestType string `gorm:"uniqueIndex;not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TableName specifies the table name for ApprovalChain
+func (ApprovalChain) TableName() string {
+	return "approval_chains"
+}
+
+// ApprovalStep is one sign-off of a chain. Steps sharing a position run in
+// parallel; positions are worked through in order.
+type ApprovalStep struct {
+	ID           uint          `gorm:"primaryKey"`
+	ChainID      uint          `gorm:"index;not null"`
+	Chain        ApprovalChain `gorm:"foreignKey:ChainID;constraint:OnDelete:CASCADE"`
+	Position     int           `gorm:"not null"`
+	Name         string        `gorm:"not null"`
+	ApproverType string        `gorm:"not null"` // user, role or manager
+	ApproverID   *uint
+	ApproverRole string
+}
+
+// TableName specifies the table name for ApprovalStep
+func (ApprovalStep) TableName() string {
+	return "approval_steps"
+}
+
+// TicketApproval is a step of a chain as copied onto a ticket, with the
+// approver worked out and the decision taken
+type TicketApproval struct {
+	ID           uint   `gorm:"primaryKey"`
+	TicketID     uint   `gorm:"index;not null"`
+	Ticket       Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	Position     int    `gorm:"not null"`
+	Name         string `gorm:"not null"`
+	ApproverType string `gorm:"not null"`
+	ApproverID   *uint  `gorm:"index"`
+	ApproverRole string
+	Status       string `gorm:"index;not null"`
+	DecidedByID  *uint
+	Comment      string `gorm:"type:text"`
+	DecidedAt    *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// TableName specifies the table name for TicketApproval
+func (TicketApproval) TableName() string {
+	return "ticket_approvals"
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCatalogItemsTable creates the service catalog table
+func CreateCatalogItemsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&CatalogItem{})
+}
+
+// CatalogItem is an orderable service. Ordering it raises a fulfilment
+// ticket carrying the answers to its request form.
+type CatalogItem struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"not null"`
+	Description   string `gorm:"type:text"`
+	Category      string `gorm:"not null;default:'request-solving'"`
+	Form          string `gorm:"type:jsonb;not null;default:'[]'"`
+	QueueID       *uint  `gorm:"index"` // Fulfilment queue
+	RequestType   string // Selects the approval chain, if any
+	Priority      string `gorm:"not null;default:'P3'"`
+	DeliveryHours int    `gorm:"not null;default:0"`
+	ArticleID     *uint  // Article describing the service
+	Active        bool   `gorm:"not null;default:true"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// TableName specifies the table name for CatalogItem
+func (CatalogItem) TableName() string {
+	return "catalog_items"
+}
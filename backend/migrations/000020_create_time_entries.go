@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTimeEntriesTable creates the table of time agents log on tickets
+func CreateTimeEntriesTable(db *gorm.DB) error {
+	return db.AutoMigrate(&TimeEntry{})
+}
+
+// TimeEntry is time an agent spent on a ticket, logged by hand or by a
+// timer. A running timer has TimerStartedAt set and no minutes yet.
+type TimeEntry struct {
+	ID             uint      `gorm:"primaryKey"`
+	TicketID       uint      `gorm:"index;not null"`
+	Ticket         Ticket    `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	UserID         uint      `gorm:"index;not null"`
+	Minutes        int       `gorm:"not null;default:0"`
+	Billable       bool      `gorm:"not null;default:false"`
+	Note           string    `gorm:"type:text"`
+	WorkedAt       time.Time `gorm:"index;not null"`
+	TimerStartedAt *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// TableName specifies the table name for TimeEntry
+func (TimeEntry) TableName() string {
+	return "time_entries"
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateIncidentUpdatesTable creates the timeline table of major incidents
+func CreateIncidentUpdatesTable(db *gorm.DB) error {
+	return db.AutoMigrate(&IncidentUpdate{})
+}
+
+// IncidentUpdate is an entry on the timeline of a major incident, from its
+// declaration through status updates to its resolution
+type IncidentUpdate struct {
+	ID         uint   `gorm:"primaryKey"`
+	TicketID   uint   `gorm:"index;not null"`
+	Ticket     Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	AuthorID   uint   `gorm:"not null"`
+	Kind       string `gorm:"not null"`
+	Body       string `gorm:"type:text"`
+	Broadcast  bool   `gorm:"not null;default:false"` // Sent to the requesters of the child tickets
+	Recipients int    `gorm:"not null;default:0"`
+	CreatedAt  time.Time
+}
+
+// TableName specifies the table name for IncidentUpdate
+func (IncidentUpdate) TableName() string {
+	return "incident_updates"
+}
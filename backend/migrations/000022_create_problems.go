@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateProblemsTable creates the problem records table
+func CreateProblemsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&Problem{})
+}
+
+// Problem is the underlying cause of recurring incidents. Once its root
+// cause is known and a workaround documented it is a known error.
+type Problem struct {
+	ID           uint   `gorm:"primaryKey"`
+	Title        string `gorm:"not null"`
+	Description  string `gorm:"type:text"`
+	Category     string `gorm:"index"`
+	Status       string `gorm:"index;not null;default:'investigation'"`
+	RootCause    string `gorm:"type:text"`
+	Workaround   string `gorm:"type:text"`
+	ArticleID    *uint  `gorm:"index"` // Issue article documenting the problem
+	OwnerID      *uint  `gorm:"index"`
+	KnownErrorAt *time.Time
+	ResolvedAt   *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// TableName specifies the table name for Problem
+func (Problem) TableName() string {
+	return "problems"
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateChangeRequestsTable creates the change requests table
+func CreateChangeRequestsTable(db *gorm.DB) error {
+	return db.AutoMigrate(&ChangeRequest{})
+}
+
+// ChangeRequest is a planned change to a service, carried out in its
+// window once the change advisory board (CAB) approved it
+type ChangeRequest struct {
+	ID                 uint      `gorm:"primaryKey"`
+	Title              string    `gorm:"not null"`
+	Description        string    `gorm:"type:text"`
+	Service            string    `gorm:"index;not null"`
+	Risk               string    `gorm:"not null;default:'low'"`
+	Impact             string    `gorm:"not null;default:'low'"`
+	ImplementationPlan string    `gorm:"type:text"`
+	BackoutPlan        string    `gorm:"type:text"`
+	WindowStart        time.Time `gorm:"index;not null"`
+	WindowEnd          time.Time `gorm:"index;not null"`
+	Status             string    `gorm:"index;not null;default:'draft'"`
+	RequesterID        uint      `gorm:"index;not null"`
+	CABDecidedByID     *uint
+	CABDecidedAt       *time.Time
+	CABNote            string `gorm:"type:text"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// TableName specifies the table name for ChangeRequest
+func (ChangeRequest) TableName() string {
+	return "change_requests"
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateAssetsTables creates the asset registry, the relationships between
+// assets and the tables linking assets to tickets and change requests
+func CreateAssetsTables(db *gorm.DB) error {
+	return db.AutoMigrate(&Asset{}, &AssetRelation{}, &TicketAsset{}, &ChangeRequestAsset{})
+}
+
+// Asset is a configuration item such as a laptop, a server or a service
+type Asset struct {
+	ID         uint   `gorm:"primaryKey"`
+	Tag        string `gorm:"uniqueIndex;not null"` // Inventory number, e.g. LAP-0042
+	Name       string `gorm:"not null"`
+	Type       string `gorm:"index;not null"`
+	Serial     string `gorm:"index"`
+	OwnerID    *uint  `gorm:"index"`
+	Owner      *User  `gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL"`
+	Location   string
+	Status     string `gorm:"index;not null;default:'active'"`
+	Attributes string `gorm:"type:jsonb;not null;default:'{}'"` // Custom attributes, e.g. model or OS version
+	Notes      string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// TableName specifies the table name for Asset
+func (Asset) TableName() string {
+	return "assets"
+}
+
+// AssetRelation is a typed relationship from one asset to another, e.g. an
+// application that runs on a server
+type AssetRelation struct {
+	ID        uint   `gorm:"primaryKey"`
+	SourceID  uint   `gorm:"uniqueIndex:idx_asset_relation;not null"`
+	Source    Asset  `gorm:"foreignKey:SourceID;constraint:OnDelete:CASCADE"`
+	TargetID  uint   `gorm:"uniqueIndex:idx_asset_relation;index;not null"`
+	Target    Asset  `gorm:"foreignKey:TargetID;constraint:OnDelete:CASCADE"`
+	Type      string `gorm:"uniqueIndex:idx_asset_relation;not null"`
+	CreatedAt time.Time
+}
+
+// TableName specifies the table name for AssetRelation
+func (AssetRelation) TableName() string {
+	return "asset_relations"
+}
+
+// TicketAsset links a ticket to an asset it is about
+type TicketAsset struct {
+	TicketID uint   `gorm:"primaryKey"`
+	Ticket   Ticket `gorm:"foreignKey:TicketID;constraint:OnDelete:CASCADE"`
+	AssetID  uint   `gorm:"primaryKey;index"`
+	Asset    Asset  `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName specifies the table name for TicketAsset
+func (TicketAsset) TableName() string {
+	return "ticket_assets"
+}
+
+// ChangeRequestAsset links a change request to an asset it changes
+type ChangeRequestAsset struct {
+	ChangeRequestID uint          `gorm:"primaryKey"`
+	ChangeRequest   ChangeRequest `gorm:"foreignKey:ChangeRequestID;constraint:OnDelete:CASCADE"`
+	AssetID         uint          `gorm:"primaryKey;index"`
+	Asset           Asset         `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName specifies the table name for ChangeRequestAsset
+func (ChangeRequestAsset) TableName() string {
+	return "change_request_assets"
+}
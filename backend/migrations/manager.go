@@ -38,6 +38,28 @@ func RunMigrations(db *gorm.DB) error {
 	}{
 		{"Create Users Table", CreateUsersTable},
 		{"Create Tasks Table", CreateTasksTable},
+		{"Create Invitations Table", CreateInvitationsTable},
+		{"Create Groups Table", CreateGroupsTable},
+		{"Create Security Events Table", CreateSecurityEventsTable},
+		{"Create Impersonation Tables", CreateImpersonationTables},
+		{"Create Tickets Table", CreateTicketsTable},
+		{"Create SLA Tables", CreateSLATables},
+		{"Create Business Calendar Tables", CreateBusinessCalendarTables},
+		{"Create Queue Tables", CreateQueueTables},
+		{"Create Escalation Tables", CreateEscalationTables},
+		{"Create Ticket Article Links Table", CreateTicketArticleLinksTable},
+		{"Create Ticket Messages Table", CreateTicketMessagesTable},
+		{"Create Canned Response Tables", CreateCannedResponseTables},
+		{"Create CSAT Surveys Table", CreateCSATSurveysTable},
+		{"Create Ticket CCs Table", CreateTicketCCsTable},
+		{"Create Custom Fields Table", CreateCustomFieldsTable},
+		{"Create Approval Tables", CreateApprovalTables},
+		{"Create Catalog Items Table", CreateCatalogItemsTable},
+		{"Create Time Entries Table", CreateTimeEntriesTable},
+		{"Create Incident Updates Table", CreateIncidentUpdatesTable},
+		{"Create Problems Table", CreateProblemsTable},
+		{"Create Change Requests Table", CreateChangeRequestsTable},
+		{"Create Assets Tables", CreateAssetsTables},
 	}
 
 	for _, migration := range migrations {
@@ -0,0 +1,557 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ApprovalChain lists who must sign off a request type before it is worked
+type ApprovalChain struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name"`
+	RequestType string         `json:"request_type"`
+	Steps       []ApprovalStep `json:"steps" gorm:"foreignKey:ChainID"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// ApprovalStep is one sign-off of a chain. Steps sharing a position run in
+// parallel; positions are worked through in order.
+type ApprovalStep struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	ChainID      uint   `json:"chain_id"`
+	Position     int    `json:"position"`
+	Name         string `json:"name"`
+	ApproverType string `json:"approver_type"`
+	ApproverID   *uint  `json:"approver_id"`
+	ApproverRole string `json:"approver_role,omitempty"`
+}
+
+// ApprovalChainRequest is used for creating/updating approval chains
+type ApprovalChainRequest struct {
+	Name        string                `json:"name" binding:"required"`
+	RequestType string                `json:"request_type" binding:"required"`
+	Steps       []ApprovalStepRequest `json:"steps" binding:"required,min=1,dive"`
+}
+
+// ApprovalStepRequest describes a step of an approval chain. User steps
+// name the approver, role steps let anyone with the role decide and manager
+// steps go to the requester's manager.
+type ApprovalStepRequest struct {
+	Position     int    `json:"position" binding:"min=1"`
+	Name         string `json:"name" binding:"required"`
+	ApproverType string `json:"approver_type" binding:"required"`
+	ApproverID   *uint  `json:"approver_id"`
+	ApproverRole string `json:"approver_role"`
+}
+
+// TicketApproval is a step of a chain as copied onto a ticket, with the
+// approver worked out and the decision taken
+type TicketApproval struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	TicketID     uint       `json:"ticket_id"`
+	Ticket       *Ticket    `json:"ticket,omitempty" gorm:"foreignKey:TicketID"`
+	Position     int        `json:"position"`
+	Name         string     `json:"name"`
+	ApproverType string     `json:"approver_type"`
+	ApproverID   *uint      `json:"approver_id"`
+	Approver     *User      `json:"approver,omitempty" gorm:"foreignKey:ApproverID"`
+	ApproverRole string     `json:"approver_role,omitempty"`
+	Status       string     `json:"status"`
+	DecidedByID  *uint      `json:"decided_by_id"`
+	DecidedBy    *User      `json:"decided_by,omitempty" gorm:"foreignKey:DecidedByID"`
+	Comment      string     `json:"comment"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ApprovalDecision approves or rejects a pending approval
+type ApprovalDecision struct {
+	Comment string `json:"comment"`
+}
+
+// Approver types
+const (
+	ApproverUser    = "user"
+	ApproverRole    = "role"
+	ApproverManager = "manager"
+)
+
+// Statuses of a ticket approval. Later positions wait until the earlier
+// ones are approved; a rejection skips whatever is left.
+const (
+	ApprovalWaiting  = "waiting"
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalSkipped  = "skipped"
+)
+
+// ApprovalCancelled is the approval status of a ticket closed before its chain finished
+const ApprovalCancelled = "cancelled"
+
+// CloseReasonRejected is the close reason of a ticket whose approval was rejected
+const CloseReasonRejected = "rejected"
+
+var ValidApproverTypes = []string{ApproverUser, ApproverRole, ApproverManager}
+
+var (
+	ErrApprovalChainNotFound = errors.New("approval chain not found")
+	ErrApprovalNotFound      = errors.New("approval not found")
+	ErrRequestTypeTaken      = errors.New("an approval chain already exists for this request type")
+	ErrInvalidApprover       = errors.New("invalid approver")
+	ErrApprovalDecided       = errors.New("approval is not pending")
+	ErrNotApprover           = errors.New("not an approver of this step")
+	ErrSelfApproval          = errors.New("requesters cannot approve their own requests")
+	ErrAwaitingApproval      = errors.New("ticket is awaiting approval")
+)
+
+// normalizeRequestType makes request types case and space insensitive
+func normalizeRequestType(requestType string) string {
+	return strings.Join(strings.Fields(strings.ToLower(requestType)), "-")
+}
+
+// validateApprovalChain checks a chain and orders its steps
+func validateApprovalChain(req *ApprovalChainRequest) error {
+	req.RequestType = normalizeRequestType(req.RequestType)
+	for _, step := range req.Steps {
+		switch step.ApproverType {
+		case ApproverUser:
+			if step.ApproverID == nil {
+				return fmt.Errorf("%w: step %q needs an approver_id", ErrInvalidApprover, step.Name)
+			}
+			if _, err := GetUserByID(*step.ApproverID); err != nil {
+				return fmt.Errorf("%w: step %q: %v", ErrInvalidApprover, step.Name, err)
+			}
+		case ApproverRole:
+			if !ValidateRole(step.ApproverRole) {
+				return fmt.Errorf("%w: step %q needs an approver_role of %s", ErrInvalidApprover, step.Name, strings.Join(ValidRoles, ", "))
+			}
+		case ApproverManager:
+		default:
+			return fmt.Errorf("%w: approver_type must be one of %s", ErrInvalidApprover, strings.Join(ValidApproverTypes, ", "))
+		}
+	}
+	sort.SliceStable(req.Steps, func(i, j int) bool { return req.Steps[i].Position < req.Steps[j].Position })
+	return nil
+}
+
+// chainSteps turns the steps of a request into chain steps
+func chainSteps(chainID uint, steps []ApprovalStepRequest) []ApprovalStep {
+	result := make([]ApprovalStep, len(steps))
+	for i, step := range steps {
+		result[i] = ApprovalStep{
+			ChainID:      chainID,
+			Position:     step.Position,
+			Name:         step.Name,
+			ApproverType: step.ApproverType,
+		}
+		switch step.ApproverType {
+		case ApproverUser:
+			result[i].ApproverID = step.ApproverID
+		case ApproverRole:
+			result[i].ApproverRole = step.ApproverRole
+		}
+	}
+	return result
+}
+
+// preloadSteps loads the steps of chains in order
+func preloadSteps(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	})
+}
+
+// GetApprovalChains lists the approval chains
+func GetApprovalChains() ([]ApprovalChain, error) {
+	var chains []ApprovalChain
+	err := preloadSteps(DB).Order("request_type").Find(&chains).Error
+	return chains, err
+}
+
+// GetApprovalChainByID retrieves an approval chain with its steps
+func GetApprovalChainByID(id uint) (*ApprovalChain, error) {
+	var chain ApprovalChain
+	if err := preloadSteps(DB).First(&chain, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrApprovalChainNotFound
+		}
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// approvalChainFor returns the chain of a request type, or nil when the
+// type needs no approval
+func approvalChainFor(requestType string) (*ApprovalChain, error) {
+	if requestType == "" {
+		return nil, nil
+	}
+	var chain ApprovalChain
+	if err := preloadSteps(DB).Where("request_type = ?", requestType).First(&chain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// requestTypeTaken reports whether another chain uses the request type
+func requestTypeTaken(requestType string, exceptID uint) (bool, error) {
+	var count int64
+	err := DB.Model(&ApprovalChain{}).Where("request_type = ? AND id <> ?", requestType, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateApprovalChain creates an approval chain for a request type
+func CreateApprovalChain(req ApprovalChainRequest) (*ApprovalChain, error) {
+	if err := validateApprovalChain(&req); err != nil {
+		return nil, err
+	}
+	if taken, err := requestTypeTaken(req.RequestType, 0); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrRequestTypeTaken
+	}
+
+	chain := ApprovalChain{Name: req.Name, RequestType: req.RequestType}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&chain).Error; err != nil {
+			return err
+		}
+		steps := chainSteps(chain.ID, req.Steps)
+		return tx.Create(&steps).Error
+	}); err != nil {
+		return nil, err
+	}
+	return GetApprovalChainByID(chain.ID)
+}
+
+// UpdateApprovalChain replaces an approval chain. Tickets already waiting
+// for sign-off keep the steps they started with.
+func UpdateApprovalChain(id uint, req ApprovalChainRequest) (*ApprovalChain, error) {
+	chain, err := GetApprovalChainByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateApprovalChain(&req); err != nil {
+		return nil, err
+	}
+	if taken, err := requestTypeTaken(req.RequestType, id); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrRequestTypeTaken
+	}
+
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(chain).Updates(map[string]interface{}{
+			"name":         req.Name,
+			"request_type": req.RequestType,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chain_id = ?", id).Delete(&ApprovalStep{}).Error; err != nil {
+			return err
+		}
+		steps := chainSteps(id, req.Steps)
+		return tx.Create(&steps).Error
+	}); err != nil {
+		return nil, err
+	}
+	return GetApprovalChainByID(id)
+}
+
+// DeleteApprovalChain deletes an approval chain. Tickets already waiting for
+// sign-off keep their steps.
+func DeleteApprovalChain(id uint) error {
+	chain, err := GetApprovalChainByID(id)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(chain).Error
+}
+
+// startApprovals copies the steps of a chain onto a new ticket. The first
+// position becomes pending; a manager step of a requester without a manager
+// falls back to the admins.
+func startApprovals(tx *gorm.DB, ticket *Ticket, chain *ApprovalChain) ([]TicketApproval, error) {
+	requester, err := GetUserByID(ticket.RequesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]TicketApproval, len(chain.Steps))
+	for i, step := range chain.Steps {
+		approvals[i] = TicketApproval{
+			TicketID:     ticket.ID,
+			Position:     step.Position,
+			Name:         step.Name,
+			ApproverType: step.ApproverType,
+			ApproverID:   step.ApproverID,
+			ApproverRole: step.ApproverRole,
+			Status:       ApprovalWaiting,
+		}
+		if step.ApproverType == ApproverManager {
+			if requester.ManagerID != nil {
+				approvals[i].ApproverID = requester.ManagerID
+			} else {
+				approvals[i].ApproverRole = "admin"
+			}
+		}
+		if step.Position == chain.Steps[0].Position {
+			approvals[i].Status = ApprovalPending
+		}
+	}
+	if err := tx.Create(&approvals).Error; err != nil {
+		return nil, err
+	}
+
+	ticket.ApprovalStatus = ApprovalPending
+	if err := tx.Model(ticket).Update("approval_status", ApprovalPending).Error; err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// GetTicketApprovals lists the approval steps of a ticket in order
+func GetTicketApprovals(ticketID uint) ([]TicketApproval, error) {
+	var approvals []TicketApproval
+	err := DB.Preload("Approver").Preload("DecidedBy").
+		Where("ticket_id = ?", ticketID).Order("position, id").Find(&approvals).Error
+	return approvals, err
+}
+
+// GetMyApprovals lists the approvals waiting for the user's decision, with
+// their tickets
+func GetMyApprovals(user *User) ([]TicketApproval, error) {
+	var approvals []TicketApproval
+	err := DB.Preload("Ticket").Preload("Ticket.Requester").
+		Where("status = ?", ApprovalPending).
+		Where("approver_id = ? OR (approver_id IS NULL AND approver_role = ?)", user.ID, user.Role).
+		Where("ticket_id NOT IN (SELECT id FROM tickets WHERE requester_id = ?)", user.ID).
+		Order("created_at").Find(&approvals).Error
+	return approvals, err
+}
+
+// canDecide reports whether the user is an approver of the step
+func (a *TicketApproval) canDecide(user *User) bool {
+	if a.ApproverID != nil {
+		return *a.ApproverID == user.ID
+	}
+	return a.ApproverRole == user.Role
+}
+
+// DecideApproval approves or rejects a pending approval. A rejection closes
+// the ticket; once every step is approved the ticket is routed and its SLA
+// clocks start.
+func DecideApproval(id uint, approve bool, decision ApprovalDecision, actor *User) (*TicketApproval, error) {
+	var approval TicketApproval
+	if err := DB.First(&approval, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrApprovalNotFound
+		}
+		return nil, err
+	}
+	if !approval.canDecide(actor) {
+		return nil, ErrNotApprover
+	}
+
+	now := time.Now()
+	comment := strings.TrimSpace(decision.Comment)
+	var ticket Ticket
+	var activated []TicketApproval
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		// Parallel approvers decide one at a time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ticket, approval.TicketID).Error; err != nil {
+			return err
+		}
+		if ticket.RequesterID == actor.ID {
+			return ErrSelfApproval
+		}
+
+		status := ApprovalRejected
+		if approve {
+			status = ApprovalApproved
+		}
+		result := tx.Model(&TicketApproval{}).Where("id = ? AND status = ?", id, ApprovalPending).Updates(map[string]interface{}{
+			"status":        status,
+			"decided_by_id": actor.ID,
+			"comment":       comment,
+			"decided_at":    now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrApprovalDecided
+		}
+
+		body := fmt.Sprintf("%s %s %q.", displayName(actor), status, approval.Name)
+		if comment != "" {
+			body += "\n\n" + comment
+		}
+		if err := tx.Create(&TicketMessage{
+			TicketID:   ticket.ID,
+			AuthorID:   actor.ID,
+			Body:       body,
+			Visibility: VisibilityPublic,
+			Source:     SourceWeb,
+		}).Error; err != nil {
+			return err
+		}
+
+		if !approve {
+			return rejectTicket(tx, &ticket, now)
+		}
+		var err error
+		activated, err = advanceApprovals(tx, &ticket, now)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(activated) > 0 {
+		notifyApprovers(&ticket, activated)
+	} else if ticket.ApprovalStatus != ApprovalPending {
+		notifyApprovalOutcome(&ticket)
+	}
+
+	if err := DB.Preload("Approver").Preload("DecidedBy").First(&approval, id).Error; err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// rejectTicket skips the rest of the chain and closes the ticket
+func rejectTicket(tx *gorm.DB, ticket *Ticket, now time.Time) error {
+	if err := tx.Model(&TicketApproval{}).Where("ticket_id = ? AND status IN ?", ticket.ID, []string{ApprovalWaiting, ApprovalPending}).
+		Update("status", ApprovalSkipped).Error; err != nil {
+		return err
+	}
+	ticket.ApprovalStatus = ApprovalRejected
+	return tx.Model(ticket).Updates(map[string]interface{}{
+		"approval_status": ApprovalRejected,
+		"status":          TicketStatusClosed,
+		"closed_at":       now,
+		"resolved_at":     now,
+		"close_reason":    CloseReasonRejected,
+	}).Error
+}
+
+// advanceApprovals moves the chain on once every step of the current
+// position is approved. It returns the approvals that became pending; when
+// none are left the ticket is approved, routed and its SLA clocks start. A
+// ticket moved to a queue while it waited is assigned by that queue.
+func advanceApprovals(tx *gorm.DB, ticket *Ticket, now time.Time) ([]TicketApproval, error) {
+	var pending int64
+	if err := tx.Model(&TicketApproval{}).Where("ticket_id = ? AND status = ?", ticket.ID, ApprovalPending).
+		Count(&pending).Error; err != nil || pending > 0 {
+		return nil, err
+	}
+
+	var waiting []TicketApproval
+	if err := tx.Where("ticket_id = ? AND status = ?", ticket.ID, ApprovalWaiting).Order("position, id").
+		Find(&waiting).Error; err != nil {
+		return nil, err
+	}
+	if len(waiting) > 0 {
+		var next []TicketApproval
+		for _, approval := range waiting {
+			if approval.Position == waiting[0].Position {
+				approval.Status = ApprovalPending
+				next = append(next, approval)
+			}
+		}
+		if err := tx.Model(&TicketApproval{}).Where("ticket_id = ? AND status = ? AND position = ?", ticket.ID, ApprovalWaiting, waiting[0].Position).
+			Update("status", ApprovalPending).Error; err != nil {
+			return nil, err
+		}
+		return next, nil
+	}
+
+	ticket.ApprovalStatus = ApprovalApproved
+	ticket.ApprovedAt = &now
+	if err := tx.Model(ticket).Updates(map[string]interface{}{
+		"approval_status": ApprovalApproved,
+		"approved_at":     now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := routeTicket(tx, ticket); err != nil {
+		return nil, err
+	}
+	if err := autoAssignTicket(tx, ticket); err != nil {
+		return nil, err
+	}
+	return nil, syncTicketSLA(tx, ticket.ID, now)
+}
+
+// cancelApprovals skips the open steps of a ticket closed before its chain finished
+func cancelApprovals(tx *gorm.DB, ticketID uint) error {
+	if err := tx.Model(&TicketApproval{}).Where("ticket_id = ? AND status IN ?", ticketID, []string{ApprovalWaiting, ApprovalPending}).
+		Update("status", ApprovalSkipped).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Ticket{}).Where("id = ?", ticketID).Update("approval_status", ApprovalCancelled).Error
+}
+
+// approverEmails returns the addresses of the users who may decide an approval
+func approverEmails(approval *TicketApproval) ([]string, error) {
+	var emails []string
+	query := DB.Model(&User{}).Where("active = ?", true)
+	if approval.ApproverID != nil {
+		query = query.Where("id = ?", *approval.ApproverID)
+	} else {
+		query = query.Where("role = ?", approval.ApproverRole)
+	}
+	err := query.Pluck("email", &emails).Error
+	return emails, err
+}
+
+// notifyApprovers asks the approvers of newly pending steps for a decision
+func notifyApprovers(ticket *Ticket, approvals []TicketApproval) {
+	for i := range approvals {
+		emails, err := approverEmails(&approvals[i])
+		if err != nil {
+			log.Printf("Warning: Could not find the approvers of %s: %v", ticket.Reference(), err)
+			continue
+		}
+		subject := fmt.Sprintf("[%s] Approval needed: %s", ticket.Reference(), ticket.Subject)
+		body := fmt.Sprintf(
+			"Your approval (%s) is needed for %s \"%s\".\n\n%s\n\nApprove or reject it here: %s",
+			approvals[i].Name, ticket.Reference(), ticket.Subject, ticket.Description, mailer.Link("/approvals"),
+		)
+		for _, to := range emails {
+			if err := mailer.Send(to, subject, body); err != nil {
+				log.Printf("Warning: Could not ask %s to approve %s: %v", to, ticket.Reference(), err)
+			}
+		}
+	}
+}
+
+// notifyApprovalOutcome tells the requester that their request was approved or rejected
+func notifyApprovalOutcome(ticket *Ticket) {
+	requester, err := GetUserByID(ticket.RequesterID)
+	if err != nil {
+		log.Printf("Warning: Could not notify the requester of %s: %v", ticket.Reference(), err)
+		return
+	}
+	subject := fmt.Sprintf("[%s] %s", ticket.Reference(), ticket.Subject)
+	body := fmt.Sprintf("Your request %s has been %s.\n\nView the ticket: %s",
+		ticket.Reference(), ticket.ApprovalStatus, mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID)))
+	if err := mailer.Send(requester.Email, subject, body); err != nil {
+		log.Printf("Warning: Could not notify %s of the approval of %s: %v", requester.Email, ticket.Reference(), err)
+	}
+}
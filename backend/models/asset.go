@@ -0,0 +1,635 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Asset is a configuration item such as a laptop, a server or a service
+type Asset struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	Tag        string          `json:"tag"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Serial     string          `json:"serial"`
+	OwnerID    *uint           `json:"owner_id"`
+	Owner      *User           `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
+	Location   string          `json:"location"`
+	Status     string          `json:"status"`
+	Attributes JSONMap         `json:"attributes" gorm:"type:jsonb"`
+	Notes      string          `json:"notes"`
+	Relations  []AssetRelation `json:"relations,omitempty" gorm:"-"` // Both directions, when fetched on its own
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// AssetRelation is a typed relationship from one asset to another
+type AssetRelation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SourceID  uint      `json:"source_id"`
+	Source    *Asset    `json:"source,omitempty" gorm:"foreignKey:SourceID"`
+	TargetID  uint      `json:"target_id"`
+	Target    *Asset    `json:"target,omitempty" gorm:"foreignKey:TargetID"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AssetRequest is used for creating/updating assets
+type AssetRequest struct {
+	Tag        string  `json:"tag" binding:"required"`
+	Name       string  `json:"name" binding:"required"`
+	Type       string  `json:"type" binding:"required"`
+	Serial     string  `json:"serial"`
+	OwnerID    *uint   `json:"owner_id"`
+	Location   string  `json:"location"`
+	Status     string  `json:"status"` // Defaults to active
+	Attributes JSONMap `json:"attributes"`
+	Notes      string  `json:"notes"`
+}
+
+// AssetRelationRequest relates an asset to another one
+type AssetRelationRequest struct {
+	TargetID uint   `json:"target_id" binding:"required"`
+	Type     string `json:"type" binding:"required"`
+}
+
+// AssetLinkRequest links assets to a ticket or change request
+type AssetLinkRequest struct {
+	AssetIDs []uint `json:"asset_ids" binding:"required,min=1"`
+}
+
+// AssetFilter narrows down an asset listing
+type AssetFilter struct {
+	Type    string
+	Status  string
+	OwnerID uint
+	Search  string // Tag, name or serial
+}
+
+// AssetImportError reports a CSV row that could not be imported
+type AssetImportError struct {
+	Line  int    `json:"line"`
+	Tag   string `json:"tag,omitempty"`
+	Error string `json:"error"`
+}
+
+// AssetImportResult summarises a CSV import
+type AssetImportResult struct {
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Errors  []AssetImportError `json:"errors"`
+	DryRun  bool               `json:"dry_run"`
+}
+
+// Asset statuses
+const (
+	AssetStatusInStock  = "in_stock"
+	AssetStatusActive   = "active"
+	AssetStatusInRepair = "in_repair"
+	AssetStatusRetired  = "retired"
+	AssetStatusLost     = "lost"
+)
+
+// Asset relation types, read as "source <type> target"
+const (
+	AssetRelationDependsOn   = "depends_on"
+	AssetRelationRunsOn      = "runs_on"
+	AssetRelationConnectedTo = "connected_to"
+	AssetRelationPartOf      = "part_of"
+)
+
+var (
+	ValidAssetStatuses      = []string{AssetStatusInStock, AssetStatusActive, AssetStatusInRepair, AssetStatusRetired, AssetStatusLost}
+	ValidAssetRelationTypes = []string{AssetRelationDependsOn, AssetRelationRunsOn, AssetRelationConnectedTo, AssetRelationPartOf}
+
+	// assetColumns maps CSV headers to asset fields. Other columns become
+	// custom attributes.
+	assetColumns = map[string]string{
+		"tag": "tag", "asset_tag": "tag",
+		"name":   "name",
+		"type":   "type",
+		"serial": "serial", "serial_number": "serial",
+		"owner": "owner", "owner_email": "owner",
+		"location": "location",
+		"status":   "status",
+		"notes":    "notes",
+	}
+)
+
+var (
+	ErrAssetNotFound         = errors.New("asset not found")
+	ErrDuplicateAssetTag     = errors.New("an asset with this tag already exists")
+	ErrInvalidAssetStatus    = errors.New("invalid asset status")
+	ErrInvalidAssetOwner     = errors.New("asset owner not found")
+	ErrInvalidRelationType   = errors.New("invalid relation type")
+	ErrRelationToSelf        = errors.New("an asset cannot be related to itself")
+	ErrAssetRelationNotFound = errors.New("asset relation not found")
+	ErrAssetNotOwned         = errors.New("tickets can only reference your own or shared assets")
+	ErrAssetImportHeader     = errors.New("the CSV needs a header row with at least tag, name and type columns")
+)
+
+// GetAssets lists assets matching the filter, by tag
+func GetAssets(filter AssetFilter) ([]Asset, error) {
+	var assets []Asset
+	query := DB.Preload("Owner").Order("tag")
+	if filter.Type != "" {
+		query = query.Where("type = ?", strings.ToLower(filter.Type))
+	}
+	if filter.Status != "" {
+		query = query.Where("status IN ?", strings.Split(filter.Status, ","))
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("owner_id = ?", filter.OwnerID)
+	}
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+		query = query.Where("(tag ILIKE ? OR name ILIKE ? OR serial ILIKE ?)", pattern, pattern, pattern)
+	}
+	err := query.Find(&assets).Error
+	return assets, err
+}
+
+// GetAssetByID retrieves an asset with its owner and relations
+func GetAssetByID(id uint) (*Asset, error) {
+	var asset Asset
+	if err := DB.Preload("Owner").First(&asset, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, err
+	}
+	if err := DB.Preload("Source").Preload("Target").
+		Where("source_id = ? OR target_id = ?", id, id).
+		Order("type, id").Find(&asset.Relations).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// validateAsset checks an asset's status and owner and normalises its fields
+func validateAsset(tx *gorm.DB, req *AssetRequest) error {
+	req.Tag = strings.TrimSpace(req.Tag)
+	req.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	if req.Status == "" {
+		req.Status = AssetStatusActive
+	}
+	if !containsString(ValidAssetStatuses, req.Status) {
+		return ErrInvalidAssetStatus
+	}
+	if req.Attributes == nil {
+		req.Attributes = JSONMap{}
+	}
+	if req.OwnerID != nil {
+		var count int64
+		if err := tx.Model(&User{}).Where("id = ?", *req.OwnerID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInvalidAssetOwner
+		}
+	}
+	return nil
+}
+
+// tagTaken reports whether another asset already uses the tag
+func tagTaken(tx *gorm.DB, tag string, exceptID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&Asset{}).Where("LOWER(tag) = LOWER(?) AND id <> ?", tag, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// assetFields returns the column values of an asset request
+func assetFields(req AssetRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"tag":        req.Tag,
+		"name":       req.Name,
+		"type":       req.Type,
+		"serial":     req.Serial,
+		"owner_id":   req.OwnerID,
+		"location":   req.Location,
+		"status":     req.Status,
+		"attributes": req.Attributes,
+		"notes":      req.Notes,
+	}
+}
+
+// CreateAsset registers an asset
+func CreateAsset(req AssetRequest) (*Asset, error) {
+	if err := validateAsset(DB, &req); err != nil {
+		return nil, err
+	}
+	taken, err := tagTaken(DB, req.Tag, 0)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrDuplicateAssetTag
+	}
+
+	asset := Asset{
+		Tag:        req.Tag,
+		Name:       req.Name,
+		Type:       req.Type,
+		Serial:     req.Serial,
+		OwnerID:    req.OwnerID,
+		Location:   req.Location,
+		Status:     req.Status,
+		Attributes: req.Attributes,
+		Notes:      req.Notes,
+	}
+	if err := DB.Create(&asset).Error; err != nil {
+		return nil, err
+	}
+	return GetAssetByID(asset.ID)
+}
+
+// UpdateAsset updates an asset
+func UpdateAsset(id uint, req AssetRequest) (*Asset, error) {
+	if _, err := GetAssetByID(id); err != nil {
+		return nil, err
+	}
+	if err := validateAsset(DB, &req); err != nil {
+		return nil, err
+	}
+	taken, err := tagTaken(DB, req.Tag, id)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrDuplicateAssetTag
+	}
+
+	if err := DB.Model(&Asset{ID: id}).Updates(assetFields(req)).Error; err != nil {
+		return nil, err
+	}
+	return GetAssetByID(id)
+}
+
+// DeleteAsset removes an asset together with its relations and links
+func DeleteAsset(id uint) error {
+	if _, err := GetAssetByID(id); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ? OR target_id = ?", id, id).Delete(&AssetRelation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM ticket_assets WHERE asset_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM change_request_assets WHERE asset_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Asset{}, id).Error
+	})
+}
+
+// AddAssetRelation relates an asset to another one. Relating the same pair
+// the same way twice is a no-op.
+func AddAssetRelation(id uint, req AssetRelationRequest) (*Asset, error) {
+	if !containsString(ValidAssetRelationTypes, req.Type) {
+		return nil, ErrInvalidRelationType
+	}
+	if req.TargetID == id {
+		return nil, ErrRelationToSelf
+	}
+	if _, err := GetAssetByID(id); err != nil {
+		return nil, err
+	}
+	if _, err := GetAssetByID(req.TargetID); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Exec("INSERT INTO asset_relations (source_id, target_id, type, created_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		id, req.TargetID, req.Type, time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return GetAssetByID(id)
+}
+
+// RemoveAssetRelation removes a relation of an asset, in either direction
+func RemoveAssetRelation(id, relationID uint) error {
+	result := DB.Where("id = ? AND (source_id = ? OR target_id = ?)", relationID, id, id).Delete(&AssetRelation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAssetRelationNotFound
+	}
+	return nil
+}
+
+// GetAssetTickets lists the tickets about an asset, newest first
+func GetAssetTickets(id uint) ([]Ticket, error) {
+	if _, err := GetAssetByID(id); err != nil {
+		return nil, err
+	}
+	return GetTickets(TicketFilter{AssetID: id})
+}
+
+// GetAssetChanges lists the change requests touching an asset, newest
+// window first
+func GetAssetChanges(id uint) ([]ChangeRequest, error) {
+	if _, err := GetAssetByID(id); err != nil {
+		return nil, err
+	}
+	var changes []ChangeRequest
+	err := preloadChange(DB).
+		Where("id IN (SELECT change_request_id FROM change_request_assets WHERE asset_id = ?)", id).
+		Order("window_start DESC, id DESC").
+		Find(&changes).Error
+	return changes, err
+}
+
+// assetsExist checks that every asset ID refers to an asset
+func assetsExist(tx *gorm.DB, ids []uint) error {
+	var count int64
+	if err := tx.Model(&Asset{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(uniqueIDs(ids)) {
+		return ErrAssetNotFound
+	}
+	return nil
+}
+
+// checkRequesterAssets makes sure the assets a ticket is raised about belong
+// to the requester or to nobody, like a shared service
+func checkRequesterAssets(ids []uint, requesterID uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := assetsExist(DB, ids); err != nil {
+		return err
+	}
+	var foreign int64
+	if err := DB.Model(&Asset{}).
+		Where("id IN ? AND owner_id IS NOT NULL AND owner_id <> ?", ids, requesterID).
+		Count(&foreign).Error; err != nil {
+		return err
+	}
+	if foreign > 0 {
+		return ErrAssetNotOwned
+	}
+	return nil
+}
+
+// linkTicketAssets links assets to a ticket, skipping those already linked
+func linkTicketAssets(tx *gorm.DB, ticketID uint, ids []uint) error {
+	for _, assetID := range uniqueIDs(ids) {
+		if err := tx.Exec("INSERT INTO ticket_assets (ticket_id, asset_id) VALUES (?, ?) ON CONFLICT DO NOTHING", ticketID, assetID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkTicketAssets links assets to a ticket and returns its assets
+func LinkTicketAssets(ticketID uint, req AssetLinkRequest) ([]Asset, error) {
+	if _, err := GetTicketByID(ticketID); err != nil {
+		return nil, err
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := assetsExist(tx, req.AssetIDs); err != nil {
+			return err
+		}
+		return linkTicketAssets(tx, ticketID, req.AssetIDs)
+	}); err != nil {
+		return nil, err
+	}
+	return GetTicketAssets(ticketID)
+}
+
+// UnlinkTicketAsset removes an asset from a ticket
+func UnlinkTicketAsset(ticketID, assetID uint) error {
+	return DB.Exec("DELETE FROM ticket_assets WHERE ticket_id = ? AND asset_id = ?", ticketID, assetID).Error
+}
+
+// GetTicketAssets lists the assets a ticket is about
+func GetTicketAssets(ticketID uint) ([]Asset, error) {
+	var assets []Asset
+	err := DB.Preload("Owner").
+		Where("id IN (SELECT asset_id FROM ticket_assets WHERE ticket_id = ?)", ticketID).
+		Order("tag").Find(&assets).Error
+	return assets, err
+}
+
+// LinkChangeAssets links assets to a change request and returns its assets
+func LinkChangeAssets(changeID uint, req AssetLinkRequest) ([]Asset, error) {
+	if _, err := GetChangeRequestByID(changeID); err != nil {
+		return nil, err
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := assetsExist(tx, req.AssetIDs); err != nil {
+			return err
+		}
+		for _, assetID := range uniqueIDs(req.AssetIDs) {
+			if err := tx.Exec("INSERT INTO change_request_assets (change_request_id, asset_id) VALUES (?, ?) ON CONFLICT DO NOTHING", changeID, assetID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return GetChangeAssets(changeID)
+}
+
+// UnlinkChangeAsset removes an asset from a change request
+func UnlinkChangeAsset(changeID, assetID uint) error {
+	return DB.Exec("DELETE FROM change_request_assets WHERE change_request_id = ? AND asset_id = ?", changeID, assetID).Error
+}
+
+// GetChangeAssets lists the assets a change request touches
+func GetChangeAssets(changeID uint) ([]Asset, error) {
+	var assets []Asset
+	err := DB.Preload("Owner").
+		Where("id IN (SELECT asset_id FROM change_request_assets WHERE change_request_id = ?)", changeID).
+		Order("tag").Find(&assets).Error
+	return assets, err
+}
+
+// errDryRun rolls back the transaction of a dry-run import
+var errDryRun = errors.New("dry run")
+
+// ImportAssets reads an inventory CSV and creates or updates assets by tag.
+// The header row names the columns: tag, name, type, serial, owner (an
+// email address), location, status and notes; any other column is stored
+// as a custom attribute. Rows that fail are reported and skipped. A dry run
+// validates the file without saving anything.
+func ImportAssets(r io.Reader, dryRun bool) (*AssetImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrAssetImportHeader
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAssetImportHeader, err)
+	}
+	columns := make([]string, len(header))
+	attributes := make([]string, len(header))
+	found := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if field, ok := assetColumns[strings.ToLower(name)]; ok {
+			columns[i] = field
+			found[field] = true
+		} else if name != "" {
+			attributes[i] = name
+		}
+	}
+	if !found["tag"] || !found["name"] || !found["type"] {
+		return nil, ErrAssetImportHeader
+	}
+
+	result := &AssetImportResult{Errors: []AssetImportError{}, DryRun: dryRun}
+	owners := map[string]*uint{}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Errors = append(result.Errors, AssetImportError{Line: parseErr.Line, Error: parseErr.Err.Error()})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			line, _ := reader.FieldPos(0)
+
+			// A failed row must not abort the rows after it
+			if err := tx.SavePoint("asset_row").Error; err != nil {
+				return err
+			}
+			req, created, err := importAssetRow(tx, record, columns, found, attributes, owners)
+			if err != nil {
+				if err := tx.RollbackTo("asset_row").Error; err != nil {
+					return err
+				}
+				result.Errors = append(result.Errors, AssetImportError{Line: line, Tag: req.Tag, Error: err.Error()})
+				continue
+			}
+			if created {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importAssetRow creates or updates the asset of one CSV row. Updates leave
+// the fields without a column in the file alone. owners caches the user IDs
+// of owner email addresses.
+func importAssetRow(tx *gorm.DB, record, columns []string, found map[string]bool, attributes []string, owners map[string]*uint) (AssetRequest, bool, error) {
+	req := AssetRequest{Attributes: JSONMap{}}
+	var owner string
+	for i, value := range record {
+		if i >= len(columns) {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch columns[i] {
+		case "tag":
+			req.Tag = value
+		case "name":
+			req.Name = value
+		case "type":
+			req.Type = value
+		case "serial":
+			req.Serial = value
+		case "owner":
+			owner = strings.ToLower(value)
+		case "location":
+			req.Location = value
+		case "status":
+			req.Status = strings.ToLower(value)
+		case "notes":
+			req.Notes = value
+		default:
+			if attributes[i] != "" && value != "" {
+				req.Attributes[attributes[i]] = value
+			}
+		}
+	}
+	if req.Tag == "" || req.Name == "" || req.Type == "" {
+		return req, false, errors.New("tag, name and type are required")
+	}
+
+	if owner != "" {
+		id, ok := owners[owner]
+		if !ok {
+			var user User
+			if err := tx.Where("LOWER(email) = ?", owner).First(&user).Error; err == nil {
+				id = &user.ID
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return req, false, err
+			}
+			owners[owner] = id
+		}
+		if id == nil {
+			return req, false, fmt.Errorf("no user with email %s", owner)
+		}
+		req.OwnerID = id
+	}
+	if err := validateAsset(tx, &req); err != nil {
+		return req, false, err
+	}
+
+	var existing Asset
+	err := tx.Where("LOWER(tag) = LOWER(?)", req.Tag).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		asset := Asset{
+			Tag:        req.Tag,
+			Name:       req.Name,
+			Type:       req.Type,
+			Serial:     req.Serial,
+			OwnerID:    req.OwnerID,
+			Location:   req.Location,
+			Status:     req.Status,
+			Attributes: req.Attributes,
+			Notes:      req.Notes,
+		}
+		return req, true, tx.Create(&asset).Error
+	}
+	if err != nil {
+		return req, false, err
+	}
+
+	// Attributes missing from the file are kept
+	for key, value := range existing.Attributes {
+		if _, ok := req.Attributes[key]; !ok {
+			req.Attributes[key] = value
+		}
+	}
+	fields := assetFields(req)
+	for _, column := range []string{"serial", "location", "status", "notes"} {
+		if !found[column] {
+			delete(fields, column)
+		}
+	}
+	if !found["owner"] {
+		delete(fields, "owner_id")
+	}
+	return req, false, tx.Model(&Asset{ID: existing.ID}).Updates(fields).Error
+}
@@ -0,0 +1,393 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	// Embedded zone database so calendars work on hosts without tzdata
+	_ "time/tzdata"
+
+	"gorm.io/gorm"
+)
+
+// BusinessCalendar defines the working hours SLA targets are measured in
+type BusinessCalendar struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	Name      string            `json:"name" gorm:"uniqueIndex;not null"`
+	Timezone  string            `json:"timezone" gorm:"not null"`
+	Hours     []BusinessHours   `json:"hours" gorm:"foreignKey:CalendarID"`
+	Holidays  []BusinessHoliday `json:"holidays" gorm:"foreignKey:CalendarID"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	DeletedAt gorm.DeletedAt    `json:"-" gorm:"index"`
+
+	location *time.Location
+}
+
+// BusinessHours is one working interval on a weekday, in the calendar's timezone
+type BusinessHours struct {
+	ID         uint   `json:"-" gorm:"primaryKey"`
+	CalendarID uint   `json:"-" gorm:"index"`
+	Weekday    int    `json:"weekday" binding:"min=0,max=6"` // 0 = Sunday
+	StartTime  string `json:"start" binding:"required"`      // HH:MM
+	EndTime    string `json:"end" binding:"required"`        // HH:MM, 24:00 for midnight
+}
+
+// BusinessHoliday is a date without working hours
+type BusinessHoliday struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	CalendarID uint      `json:"-" gorm:"index"`
+	Date       string    `json:"date" binding:"required"` // YYYY-MM-DD
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"-"`
+}
+
+// BusinessCalendarRequest is used for creating/updating calendars. Hours and
+// holidays replace the existing ones.
+type BusinessCalendarRequest struct {
+	Name     string            `json:"name" binding:"required"`
+	Timezone string            `json:"timezone" binding:"required"`
+	Hours    []BusinessHours   `json:"hours" binding:"required,min=1,dive"`
+	Holidays []BusinessHoliday `json:"holidays" binding:"dive"`
+}
+
+var (
+	ErrCalendarNotFound     = errors.New("business calendar not found")
+	ErrCalendarExists       = errors.New("a business calendar with this name already exists")
+	ErrCalendarInUse        = errors.New("business calendar is used by an SLA policy or escalation rule")
+	ErrInvalidTimezone      = errors.New("invalid timezone")
+	ErrInvalidBusinessHours = errors.New("business hours must be HH:MM intervals with start before end")
+	ErrInvalidHoliday       = errors.New("holiday dates must be formatted as YYYY-MM-DD")
+	ErrOverlappingHours     = errors.New("business hours of a weekday must not overlap or touch, join them into one interval")
+)
+
+// businessSearchLimit bounds how far calendar arithmetic looks ahead
+const businessSearchLimit = 5 * 366
+
+// parseClock converts HH:MM to minutes since midnight
+func parseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || len(value) != 5 {
+		return 0, ErrInvalidBusinessHours
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, ErrInvalidBusinessHours
+	}
+	return hours*60 + minutes, nil
+}
+
+// validateBusinessCalendar checks the timezone, hours and holidays of a request
+func validateBusinessCalendar(req BusinessCalendarRequest) error {
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	days := map[int][][2]int{}
+	for _, hours := range req.Hours {
+		start, err := parseClock(hours.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(hours.EndTime)
+		if err != nil {
+			return err
+		}
+		if start >= end || hours.Weekday < 0 || hours.Weekday > 6 {
+			return ErrInvalidBusinessHours
+		}
+		days[hours.Weekday] = append(days[hours.Weekday], [2]int{start, end})
+	}
+	// Overlapping intervals would count the same time twice
+	for _, intervals := range days {
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i][0] < intervals[j][0] })
+		for i := 1; i < len(intervals); i++ {
+			if intervals[i][0] <= intervals[i-1][1] {
+				return ErrOverlappingHours
+			}
+		}
+	}
+	for _, holiday := range req.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return ErrInvalidHoliday
+		}
+	}
+	return nil
+}
+
+// Location returns the calendar's timezone, falling back to UTC
+func (c *BusinessCalendar) Location() *time.Location {
+	if c.location == nil {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		c.location = loc
+	}
+	return c.location
+}
+
+// workingIntervals returns the disjoint working intervals of a calendar day in order
+func (c *BusinessCalendar) workingIntervals(day time.Time) [][2]time.Time {
+	date := day.Format("2006-01-02")
+	for _, holiday := range c.Holidays {
+		if holiday.Date == date {
+			return nil
+		}
+	}
+
+	var intervals [][2]time.Time
+	for _, hours := range c.Hours {
+		if time.Weekday(hours.Weekday) != day.Weekday() {
+			continue
+		}
+		start, errStart := parseClock(hours.StartTime)
+		end, errEnd := parseClock(hours.EndTime)
+		if errStart != nil || errEnd != nil || start >= end {
+			continue
+		}
+		intervals = append(intervals, [2]time.Time{
+			time.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, c.Location()),
+			time.Date(day.Year(), day.Month(), day.Day(), 0, end, 0, 0, c.Location()),
+		})
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i][0].Before(intervals[j][0]) })
+
+	// Overlapping intervals are joined so each minute counts once
+	merged := intervals[:0]
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 && !interval[0].After(merged[n-1][1]) {
+			if interval[1].After(merged[n-1][1]) {
+				merged[n-1][1] = interval[1]
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// startOfDay returns midnight of the calendar day containing t
+func (c *BusinessCalendar) startOfDay(t time.Time) time.Time {
+	local := t.In(c.Location())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.Location())
+}
+
+// AddBusinessDuration returns the moment d of business time after start.
+// A nil calendar counts wall-clock time.
+func (c *BusinessCalendar) AddBusinessDuration(start time.Time, d time.Duration) time.Time {
+	if c == nil || len(c.Hours) == 0 {
+		return start.Add(d)
+	}
+
+	remaining := d
+	day := c.startOfDay(start)
+	for i := 0; i < businessSearchLimit; i++ {
+		for _, interval := range c.workingIntervals(day) {
+			from, to := interval[0], interval[1]
+			if to.Before(start) || to.Equal(start) {
+				continue
+			}
+			if from.Before(start) {
+				from = start
+			}
+			available := to.Sub(from)
+			if available >= remaining {
+				return from.Add(remaining)
+			}
+			remaining -= available
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return start.Add(d)
+}
+
+// BusinessDuration returns the business time between from and to.
+// A nil calendar counts wall-clock time.
+func (c *BusinessCalendar) BusinessDuration(from, to time.Time) time.Duration {
+	if c == nil || len(c.Hours) == 0 {
+		return to.Sub(from)
+	}
+	if to.Before(from) {
+		return -c.BusinessDuration(to, from)
+	}
+
+	var total time.Duration
+	day := c.startOfDay(from)
+	for i := 0; i < businessSearchLimit && day.Before(to); i++ {
+		for _, interval := range c.workingIntervals(day) {
+			start, end := interval[0], interval[1]
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				total += end.Sub(start)
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return total
+}
+
+// GetBusinessCalendars lists all calendars with their hours and holidays
+func GetBusinessCalendars() ([]BusinessCalendar, error) {
+	var calendars []BusinessCalendar
+	err := DB.Preload("Hours").Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date")
+	}).Order("name").Find(&calendars).Error
+	return calendars, err
+}
+
+// GetBusinessCalendarByID retrieves a calendar with its hours and holidays
+func GetBusinessCalendarByID(id uint) (*BusinessCalendar, error) {
+	var calendar BusinessCalendar
+	if err := DB.Preload("Hours").Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date")
+	}).First(&calendar, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCalendarNotFound
+		}
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+// loadBusinessCalendars loads the calendars with the given IDs, keyed by ID
+func loadBusinessCalendars(tx *gorm.DB, ids []uint) (map[uint]*BusinessCalendar, error) {
+	calendars := make(map[uint]*BusinessCalendar)
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return calendars, nil
+	}
+
+	var found []BusinessCalendar
+	if err := tx.Preload("Hours").Preload("Holidays").Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for i := range found {
+		calendars[found[i].ID] = &found[i]
+	}
+	return calendars, nil
+}
+
+// ensureCalendarNameAvailable checks that no other calendar uses the name
+func ensureCalendarNameAvailable(tx *gorm.DB, name string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(&BusinessCalendar{}).Where("LOWER(name) = LOWER(?) AND id <> ?", name, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCalendarExists
+	}
+	return nil
+}
+
+// replaceCalendarSchedule swaps the hours and holidays of a calendar
+func replaceCalendarSchedule(tx *gorm.DB, calendarID uint, req BusinessCalendarRequest) error {
+	if err := tx.Where("calendar_id = ?", calendarID).Delete(&BusinessHours{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("calendar_id = ?", calendarID).Delete(&BusinessHoliday{}).Error; err != nil {
+		return err
+	}
+
+	for _, hours := range req.Hours {
+		hours.ID = 0
+		hours.CalendarID = calendarID
+		if err := tx.Create(&hours).Error; err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, holiday := range req.Holidays {
+		if seen[holiday.Date] {
+			continue
+		}
+		seen[holiday.Date] = true
+		holiday.ID = 0
+		holiday.CalendarID = calendarID
+		if err := tx.Create(&holiday).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateBusinessCalendar creates a calendar with its hours and holidays
+func CreateBusinessCalendar(req BusinessCalendarRequest) (*BusinessCalendar, error) {
+	if err := validateBusinessCalendar(req); err != nil {
+		return nil, err
+	}
+
+	calendar := BusinessCalendar{Name: req.Name, Timezone: req.Timezone}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensureCalendarNameAvailable(tx, req.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&calendar).Error; err != nil {
+			return err
+		}
+		return replaceCalendarSchedule(tx, calendar.ID, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetBusinessCalendarByID(calendar.ID)
+}
+
+// UpdateBusinessCalendar replaces a calendar's settings and moves the due
+// dates of running SLA timers that are measured in it
+func UpdateBusinessCalendar(id uint, req BusinessCalendarRequest) (*BusinessCalendar, error) {
+	calendar, err := GetBusinessCalendarByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateBusinessCalendar(req); err != nil {
+		return nil, err
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensureCalendarNameAvailable(tx, req.Name, id); err != nil {
+			return err
+		}
+		if err := tx.Model(calendar).Updates(map[string]interface{}{
+			"name":     req.Name,
+			"timezone": req.Timezone,
+		}).Error; err != nil {
+			return err
+		}
+		if err := replaceCalendarSchedule(tx, id, req); err != nil {
+			return err
+		}
+		return retargetCalendarTimers(tx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetBusinessCalendarByID(id)
+}
+
+// DeleteBusinessCalendar deletes a calendar that no SLA policy or
+// escalation rule uses
+func DeleteBusinessCalendar(id uint) error {
+	if _, err := GetBusinessCalendarByID(id); err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{&SLAPolicy{}, &EscalationRule{}} {
+		var count int64
+		if err := DB.Model(model).Where("calendar_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCalendarInUse
+		}
+	}
+
+	// Deleted for good so the name can be reused; hours and holidays cascade
+	return DB.Unscoped().Delete(&BusinessCalendar{}, id).Error
+}
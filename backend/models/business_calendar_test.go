@@ -0,0 +1,214 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// officeCalendar works Monday to Friday, 09:00-17:00 in Berlin, with a
+// holiday on Tuesday 2026-10-20
+func officeCalendar() *BusinessCalendar {
+	calendar := &BusinessCalendar{
+		Timezone: "Europe/Berlin",
+		Holidays: []BusinessHoliday{{Date: "2026-10-20", Name: "Company day"}},
+	}
+	for weekday := 1; weekday <= 5; weekday++ {
+		calendar.Hours = append(calendar.Hours, BusinessHours{Weekday: weekday, StartTime: "09:00", EndTime: "17:00"})
+	}
+	return calendar
+}
+
+// roundTheClockCalendar works every day from midnight to midnight in Berlin
+func roundTheClockCalendar() *BusinessCalendar {
+	calendar := &BusinessCalendar{Timezone: "Europe/Berlin"}
+	for weekday := 0; weekday <= 6; weekday++ {
+		calendar.Hours = append(calendar.Hours, BusinessHours{Weekday: weekday, StartTime: "00:00", EndTime: "24:00"})
+	}
+	return calendar
+}
+
+// lateShiftCalendar works Saturday 20:00-24:00 and Sunday 00:00-04:00 in Berlin
+func lateShiftCalendar() *BusinessCalendar {
+	return &BusinessCalendar{
+		Timezone: "Europe/Berlin",
+		Hours: []BusinessHours{
+			{Weekday: 6, StartTime: "20:00", EndTime: "24:00"},
+			{Weekday: 0, StartTime: "00:00", EndTime: "04:00"},
+		},
+	}
+}
+
+// berlin returns a wall-clock time in Europe/Berlin
+func berlin(t *testing.T, value string) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestAddBusinessDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar *BusinessCalendar
+		start    string
+		duration time.Duration
+		want     string
+	}{
+		{"start inside an interval", officeCalendar(), "2026-10-19 10:30", time.Hour, "2026-10-19 11:30"},
+		{"start before opening", officeCalendar(), "2026-10-19 07:00", time.Hour, "2026-10-19 10:00"},
+		{"start after closing", officeCalendar(), "2026-10-22 18:00", time.Hour, "2026-10-23 10:00"},
+		{"ends at closing", officeCalendar(), "2026-10-19 16:00", time.Hour, "2026-10-19 17:00"},
+		{"weekend span", officeCalendar(), "2026-10-16 16:00", 2 * time.Hour, "2026-10-19 10:00"},
+		{"start on the weekend", officeCalendar(), "2026-10-17 12:00", time.Hour, "2026-10-19 10:00"},
+		{"holiday", officeCalendar(), "2026-10-19 16:00", 2 * time.Hour, "2026-10-21 10:00"},
+		{"start on a holiday", officeCalendar(), "2026-10-20 10:00", time.Hour, "2026-10-21 10:00"},
+		{"several days", officeCalendar(), "2026-10-19 09:00", 24 * time.Hour, "2026-10-22 17:00"},
+		{"end time of 24:00", lateShiftCalendar(), "2026-10-17 23:00", 2 * time.Hour, "2026-10-18 01:00"},
+		{"weekend span into the spring DST change", officeCalendar(), "2026-03-27 16:00", 2 * time.Hour, "2026-03-30 10:00"},
+		{"spring DST change", roundTheClockCalendar(), "2026-03-28 12:00", 24 * time.Hour, "2026-03-29 13:00"},
+		{"autumn DST change", roundTheClockCalendar(), "2026-10-24 12:00", 24 * time.Hour, "2026-10-25 11:00"},
+		{"nil calendar", nil, "2026-10-17 12:00", time.Hour, "2026-10-17 13:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.calendar.AddBusinessDuration(berlin(t, tt.start), tt.duration)
+			if want := berlin(t, tt.want); !got.Equal(want) {
+				t.Errorf("AddBusinessDuration(%s, %s) = %s, want %s", tt.start, tt.duration, got, want)
+			}
+		})
+	}
+}
+
+func TestBusinessDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar *BusinessCalendar
+		from     string
+		to       string
+		want     time.Duration
+	}{
+		{"inside an interval", officeCalendar(), "2026-10-19 10:30", "2026-10-19 11:30", time.Hour},
+		{"outside the hours", officeCalendar(), "2026-10-19 18:00", "2026-10-19 23:00", 0},
+		{"weekend span", officeCalendar(), "2026-10-16 16:00", "2026-10-19 10:00", 2 * time.Hour},
+		{"holiday", officeCalendar(), "2026-10-19 16:00", "2026-10-21 10:00", 2 * time.Hour},
+		{"reversed", officeCalendar(), "2026-10-19 11:30", "2026-10-19 10:30", -time.Hour},
+		{"end time of 24:00", lateShiftCalendar(), "2026-10-17 00:00", "2026-10-19 00:00", 8 * time.Hour},
+		{"spring DST change", roundTheClockCalendar(), "2026-03-29 00:00", "2026-03-30 00:00", 23 * time.Hour},
+		{"autumn DST change", roundTheClockCalendar(), "2026-10-25 00:00", "2026-10-26 00:00", 25 * time.Hour},
+		{"nil calendar", nil, "2026-10-17 12:00", "2026-10-17 13:00", time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.calendar.BusinessDuration(berlin(t, tt.from), berlin(t, tt.to)); got != tt.want {
+				t.Errorf("BusinessDuration(%s, %s) = %s, want %s", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkingIntervalsJoinsOverlaps(t *testing.T) {
+	calendar := &BusinessCalendar{
+		Timezone: "Europe/Berlin",
+		Hours: []BusinessHours{
+			{Weekday: 1, StartTime: "12:00", EndTime: "17:00"},
+			{Weekday: 1, StartTime: "09:00", EndTime: "13:00"},
+		},
+	}
+	got := calendar.BusinessDuration(berlin(t, "2026-10-19 00:00"), berlin(t, "2026-10-20 00:00"))
+	if got != 8*time.Hour {
+		t.Errorf("BusinessDuration() = %s, want 8h0m0s", got)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		valid bool
+	}{
+		{"00:00", 0, true},
+		{"09:30", 570, true},
+		{"24:00", 1440, true},
+		{"24:30", 0, false},
+		{"12:60", 0, false},
+		{"9:30", 0, false},
+		{"noon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseClock(tt.value)
+			if (err == nil) != tt.valid || got != tt.want {
+				t.Errorf("parseClock(%q) = %d, %v", tt.value, got, err)
+			}
+		})
+	}
+}
+
+func TestValidateBusinessCalendar(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours []BusinessHours
+		want  error
+	}{
+		{"split day", []BusinessHours{{Weekday: 1, StartTime: "13:00", EndTime: "17:00"}, {Weekday: 1, StartTime: "08:00", EndTime: "12:00"}}, nil},
+		{"same hours on other days", []BusinessHours{{Weekday: 1, StartTime: "09:00", EndTime: "17:00"}, {Weekday: 2, StartTime: "09:00", EndTime: "17:00"}}, nil},
+		{"until midnight", []BusinessHours{{Weekday: 5, StartTime: "18:00", EndTime: "24:00"}}, nil},
+		{"overlapping", []BusinessHours{{Weekday: 1, StartTime: "09:00", EndTime: "13:00"}, {Weekday: 1, StartTime: "12:00", EndTime: "17:00"}}, ErrOverlappingHours},
+		{"touching", []BusinessHours{{Weekday: 1, StartTime: "09:00", EndTime: "12:00"}, {Weekday: 1, StartTime: "12:00", EndTime: "17:00"}}, ErrOverlappingHours},
+		{"end before start", []BusinessHours{{Weekday: 1, StartTime: "17:00", EndTime: "09:00"}}, ErrInvalidBusinessHours},
+		{"invalid weekday", []BusinessHours{{Weekday: 7, StartTime: "09:00", EndTime: "17:00"}}, ErrInvalidBusinessHours},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := BusinessCalendarRequest{Name: "Office", Timezone: "Europe/Berlin", Hours: tt.hours}
+			if err := validateBusinessCalendar(req); err != tt.want {
+				t.Errorf("validateBusinessCalendar() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteBusinessCalendarInUse(t *testing.T) {
+	useTestDB(t)
+	calendar := BusinessCalendar{Name: fmt.Sprintf("Office %d", time.Now().UnixNano()), Timezone: "Europe/Berlin"}
+	if err := DB.Create(&calendar).Error; err != nil {
+		t.Fatalf("creating calendar: %v", err)
+	}
+	rule := EscalationRule{
+		Name:             "Unresolved after a business day",
+		Trigger:          EscalationTriggerUnresolved,
+		ThresholdMinutes: 8 * 60,
+		CalendarID:       &calendar.ID,
+		RaisePriority:    true,
+		Active:           true,
+	}
+	if err := DB.Create(&rule).Error; err != nil {
+		t.Fatalf("creating rule: %v", err)
+	}
+
+	if err := DeleteBusinessCalendar(calendar.ID); !errors.Is(err, ErrCalendarInUse) {
+		t.Fatalf("DeleteBusinessCalendar() error = %v, want ErrCalendarInUse", err)
+	}
+
+	if err := DeleteEscalationRule(rule.ID); err != nil {
+		t.Fatalf("DeleteEscalationRule() error = %v", err)
+	}
+	if err := DeleteBusinessCalendar(calendar.ID); err != nil {
+		t.Fatalf("DeleteBusinessCalendar() error = %v", err)
+	}
+	if _, err := GetBusinessCalendarByID(calendar.ID); !errors.Is(err, ErrCalendarNotFound) {
+		t.Errorf("GetBusinessCalendarByID() error = %v, want ErrCalendarNotFound", err)
+	}
+}
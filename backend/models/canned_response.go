@@ -0,0 +1,293 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+)
+
+// CannedResponse is a reusable reply text. It belongs to its owner, is
+// shared with the members of a queue, or with every agent when it has neither.
+type CannedResponse struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body" gorm:"type:text"`
+	OwnerID    *uint      `json:"owner_id"`
+	QueueID    *uint      `json:"queue_id"`
+	ArticleID  *uint      `json:"article_id"` // Used by the article placeholders
+	Article    *Task      `json:"article,omitempty" gorm:"foreignKey:ArticleID"`
+	UsageCount int64      `json:"usage_count"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CannedResponseRequest is used for creating/updating canned responses.
+// Without a queue the response is personal unless Shared is set.
+type CannedResponseRequest struct {
+	Title     string `json:"title" binding:"required"`
+	Body      string `json:"body" binding:"required"`
+	QueueID   *uint  `json:"queue_id"`
+	Shared    bool   `json:"shared"` // Shared with every agent, admins only
+	ArticleID *uint  `json:"article_id"`
+}
+
+// RenderedResponse is a canned response filled in for a ticket
+type RenderedResponse struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Placeholders lists the placeholders canned responses and macro replies may
+// use, written as {{name}}
+var Placeholders = []string{
+	"requester.name", "requester.first_name", "requester.email",
+	"ticket.number", "ticket.subject", "ticket.link",
+	"agent.name", "agent.email",
+	"article.title", "article.link",
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z_.]+)\s*\}\}`)
+
+var (
+	ErrCannedResponseNotFound = errors.New("canned response not found")
+	ErrUnknownPlaceholder     = errors.New("unknown placeholder")
+	ErrArticlePlaceholder     = errors.New("article placeholders need an article")
+	ErrSharingNotAllowed      = errors.New("not allowed to share with this queue or with everyone")
+)
+
+// usableBy limits a query on canned responses or macros to those the agent
+// may use: their own, those of their queues and those shared with everyone.
+// Admins see every shared entry.
+func usableBy(tx *gorm.DB, user *User) *gorm.DB {
+	if user.Role == "admin" {
+		return tx.Where("owner_id = ? OR owner_id IS NULL", user.ID)
+	}
+	return tx.Where("owner_id = ? OR (owner_id IS NULL AND (queue_id IS NULL OR queue_id IN (SELECT queue_id FROM queue_members WHERE user_id = ?)))", user.ID, user.ID)
+}
+
+// canShare reports whether the user may manage entries shared with the
+// queue, or with everyone when queueID is nil. Admins may share anything,
+// agents only with queues they are members of.
+func canShare(user *User, queueID *uint) (bool, error) {
+	if user.Role == "admin" {
+		return true, nil
+	}
+	if queueID == nil {
+		return false, nil
+	}
+	var count int64
+	err := DB.Table("queue_members").Where("queue_id = ? AND user_id = ?", *queueID, user.ID).Count(&count).Error
+	return count > 0, err
+}
+
+// canManageScoped reports whether the user may change an entry with the
+// given owner and queue
+func canManageScoped(user *User, ownerID, queueID *uint) (bool, error) {
+	if ownerID != nil {
+		return *ownerID == user.ID, nil
+	}
+	return canShare(user, queueID)
+}
+
+// scopeFor works out the owner and queue of a new or updated entry
+func scopeFor(user *User, queueID *uint, shared bool) (*uint, *uint, error) {
+	if queueID == nil && !shared {
+		return &user.ID, nil, nil
+	}
+	if queueID != nil {
+		if _, err := GetQueueByID(*queueID); err != nil {
+			return nil, nil, err
+		}
+	}
+	allowed, err := canShare(user, queueID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, ErrSharingNotAllowed
+	}
+	return nil, queueID, nil
+}
+
+// validateTemplate checks that a reply text only uses known placeholders
+// and that article placeholders come with an article
+func validateTemplate(body string, articleID *uint) error {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(body, -1) {
+		if !containsString(Placeholders, match[1]) {
+			return fmt.Errorf("%w: {{%s}}", ErrUnknownPlaceholder, match[1])
+		}
+		if strings.HasPrefix(match[1], "article.") && articleID == nil {
+			return ErrArticlePlaceholder
+		}
+	}
+	if articleID != nil {
+		var count int64
+		if err := DB.Model(&Task{}).Where("id = ?", *articleID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrArticleNotFound
+		}
+	}
+	return nil
+}
+
+// renderTemplate fills in the placeholders of a reply text for a ticket
+func renderTemplate(body string, ticket *Ticket, agent *User, article *Task) string {
+	values := map[string]string{
+		"requester.name":       displayName(&ticket.Requester),
+		"requester.first_name": ticket.Requester.GivenName,
+		"requester.email":      ticket.Requester.Email,
+		"ticket.number":        ticket.Reference(),
+		"ticket.subject":       ticket.Subject,
+		"ticket.link":          mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID)),
+		"agent.name":           displayName(agent),
+		"agent.email":          agent.Email,
+	}
+	if values["requester.first_name"] == "" {
+		values["requester.first_name"] = values["requester.name"]
+	}
+	if article != nil {
+		values["article.title"] = article.Title
+		values["article.link"] = mailer.Link(fmt.Sprintf("/dashboard/%s?article=%d", article.Category, article.ID))
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(body, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// GetCannedResponses lists the canned responses the agent may use,
+// optionally only those shared with a queue
+func GetCannedResponses(user *User, queueID uint) ([]CannedResponse, error) {
+	var responses []CannedResponse
+	query := usableBy(DB.Preload("Article"), user)
+	if queueID != 0 {
+		query = query.Where("queue_id = ?", queueID)
+	}
+	err := query.Order("title").Find(&responses).Error
+	return responses, err
+}
+
+// GetCannedResponse retrieves a canned response the agent may use
+func GetCannedResponse(id uint, user *User) (*CannedResponse, error) {
+	var response CannedResponse
+	if err := usableBy(DB.Preload("Article"), user).First(&response, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCannedResponseNotFound
+		}
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CreateCannedResponse creates a canned response for the agent
+func CreateCannedResponse(req CannedResponseRequest, user *User) (*CannedResponse, error) {
+	if err := validateTemplate(req.Body, req.ArticleID); err != nil {
+		return nil, err
+	}
+	ownerID, queueID, err := scopeFor(user, req.QueueID, req.Shared)
+	if err != nil {
+		return nil, err
+	}
+
+	response := CannedResponse{
+		Title:     req.Title,
+		Body:      req.Body,
+		OwnerID:   ownerID,
+		QueueID:   queueID,
+		ArticleID: req.ArticleID,
+	}
+	if err := DB.Create(&response).Error; err != nil {
+		return nil, err
+	}
+	return GetCannedResponse(response.ID, user)
+}
+
+// UpdateCannedResponse updates a canned response the agent may manage
+func UpdateCannedResponse(id uint, req CannedResponseRequest, user *User) (*CannedResponse, error) {
+	response, err := manageableCannedResponse(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTemplate(req.Body, req.ArticleID); err != nil {
+		return nil, err
+	}
+	ownerID, queueID, err := scopeFor(user, req.QueueID, req.Shared)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(response).Updates(map[string]interface{}{
+		"title":      req.Title,
+		"body":       req.Body,
+		"owner_id":   ownerID,
+		"queue_id":   queueID,
+		"article_id": req.ArticleID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetCannedResponse(id, user)
+}
+
+// DeleteCannedResponse deletes a canned response the agent may manage
+func DeleteCannedResponse(id uint, user *User) error {
+	response, err := manageableCannedResponse(id, user)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(response).Error
+}
+
+// manageableCannedResponse loads a canned response the agent may change.
+// Responses the agent cannot even see are reported as not found.
+func manageableCannedResponse(id uint, user *User) (*CannedResponse, error) {
+	response, err := GetCannedResponse(id, user)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := canManageScoped(user, response.OwnerID, response.QueueID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrSharingNotAllowed
+	}
+	return response, nil
+}
+
+// RenderCannedResponse fills in a canned response for a ticket and counts
+// it as used
+func RenderCannedResponse(id, ticketID uint, agent *User) (*RenderedResponse, error) {
+	response, err := GetCannedResponse(id, agent)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := GetTicketByID(ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(response).UpdateColumns(map[string]interface{}{
+		"usage_count":  gorm.Expr("usage_count + 1"),
+		"last_used_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &RenderedResponse{
+		Title: response.Title,
+		Body:  renderTemplate(response.Body, ticket, agent, response.Article),
+	}, nil
+}
@@ -0,0 +1,344 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CatalogFormField is a question on the request form of a catalog item.
+// Its types are those of custom fields.
+type CatalogFormField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+	Help     string   `json:"help,omitempty"`
+}
+
+// CatalogForm is the request form of a catalog item, stored as JSON
+type CatalogForm []CatalogFormField
+
+// Value implements driver.Valuer
+func (f CatalogForm) Value() (driver.Value, error) {
+	if f == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(f)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (f *CatalogForm) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*f = CatalogForm{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into CatalogForm", value)
+	}
+	return json.Unmarshal(data, f)
+}
+
+// fields returns the questions as fields to check answers against
+func (f CatalogForm) fields() []CustomField {
+	fields := make([]CustomField, len(f))
+	for i, question := range f {
+		fields[i] = CustomField{
+			Key:      question.Key,
+			Label:    question.Label,
+			Type:     question.Type,
+			Required: question.Required,
+			Options:  question.Options,
+		}
+	}
+	return fields
+}
+
+// CatalogItem is an orderable service. Ordering it raises a fulfilment
+// ticket carrying the answers to its request form.
+type CatalogItem struct {
+	ID            uint        `json:"id" gorm:"primaryKey"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description" gorm:"type:text"`
+	Category      string      `json:"category"`
+	Form          CatalogForm `json:"form" gorm:"type:jsonb"`
+	QueueID       *uint       `json:"queue_id"` // Fulfilment queue, routing rules apply without one
+	Queue         *Queue      `json:"queue,omitempty" gorm:"foreignKey:QueueID"`
+	RequestType   string      `json:"request_type"` // Orders need the sign-off of its approval chain
+	Priority      string      `json:"priority"`
+	DeliveryHours int         `json:"delivery_hours"` // Expected delivery time once fulfilment starts
+	ArticleID     *uint       `json:"article_id"`
+	Active        bool        `json:"active"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// CatalogItemRequest is used for creating/updating catalog items
+type CatalogItemRequest struct {
+	Name          string             `json:"name" binding:"required"`
+	Description   string             `json:"description"`
+	Category      string             `json:"category"` // Defaults to request-solving
+	Form          []CatalogFormField `json:"form"`
+	QueueID       *uint              `json:"queue_id"`
+	RequestType   string             `json:"request_type"`
+	Priority      string             `json:"priority"`
+	DeliveryHours int                `json:"delivery_hours" binding:"min=0"`
+	ArticleID     *uint              `json:"article_id"`
+	Active        *bool              `json:"active"` // Defaults to true
+}
+
+// CatalogOrder is a submitted request form. Agents may order on behalf of
+// a requester.
+type CatalogOrder struct {
+	Answers      JSONMap `json:"answers"`
+	Details      string  `json:"details"`
+	CustomFields JSONMap `json:"custom_fields"`
+	RequesterID  uint    `json:"requester_id"`
+}
+
+// CatalogDefaultCategory is the category of catalog items unless set otherwise
+const CatalogDefaultCategory = "request-solving"
+
+var (
+	ErrCatalogItemNotFound = errors.New("catalog item not found")
+	ErrDuplicateFormKey    = errors.New("form questions need distinct keys")
+)
+
+// validateCatalogItem checks a catalog item and fills in its defaults
+func validateCatalogItem(req *CatalogItemRequest) error {
+	if req.Category == "" {
+		req.Category = CatalogDefaultCategory
+	}
+	if !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	if req.Priority == "" {
+		req.Priority = TicketPriorityNormal
+	}
+	if !containsString(ValidTicketPriorities, req.Priority) {
+		return ErrInvalidPriority
+	}
+	if req.QueueID != nil {
+		if _, err := GetQueueByID(*req.QueueID); err != nil {
+			return err
+		}
+	}
+	req.RequestType = normalizeRequestType(req.RequestType)
+	if req.RequestType != "" {
+		chain, err := approvalChainFor(req.RequestType)
+		if err != nil {
+			return err
+		}
+		if chain == nil {
+			return fmt.Errorf("%w for request type %q", ErrApprovalChainNotFound, req.RequestType)
+		}
+	}
+	if req.ArticleID != nil {
+		var count int64
+		if err := DB.Model(&Task{}).Where("id = ?", *req.ArticleID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrArticleNotFound
+		}
+	}
+
+	var keys []string
+	for i := range req.Form {
+		question := &req.Form[i]
+		options, err := validateFieldShape(question.Key, question.Type, question.Options)
+		if err != nil {
+			return fmt.Errorf("question %d: %w", i+1, err)
+		}
+		if containsString(keys, question.Key) {
+			return ErrDuplicateFormKey
+		}
+		keys = append(keys, question.Key)
+		question.Options = options
+		if question.Label = strings.TrimSpace(question.Label); question.Label == "" {
+			question.Label = question.Key
+		}
+	}
+	return nil
+}
+
+// GetCatalogItems lists the catalog by name, only the orderable items
+// unless includeInactive is set
+func GetCatalogItems(includeInactive bool) ([]CatalogItem, error) {
+	var items []CatalogItem
+	query := DB.Preload("Queue").Order("name")
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+	err := query.Find(&items).Error
+	return items, err
+}
+
+// GetCatalogItemByID retrieves a catalog item. Inactive items are only
+// found when includeInactive is set.
+func GetCatalogItemByID(id uint, includeInactive bool) (*CatalogItem, error) {
+	var item CatalogItem
+	query := DB.Preload("Queue")
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCatalogItemNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CreateCatalogItem adds an item to the service catalog
+func CreateCatalogItem(req CatalogItemRequest) (*CatalogItem, error) {
+	if err := validateCatalogItem(&req); err != nil {
+		return nil, err
+	}
+
+	item := CatalogItem{
+		Name:          req.Name,
+		Description:   req.Description,
+		Category:      req.Category,
+		Form:          CatalogForm(req.Form),
+		QueueID:       req.QueueID,
+		RequestType:   req.RequestType,
+		Priority:      req.Priority,
+		DeliveryHours: req.DeliveryHours,
+		ArticleID:     req.ArticleID,
+		Active:        req.Active == nil || *req.Active,
+	}
+	if err := DB.Create(&item).Error; err != nil {
+		return nil, err
+	}
+	return GetCatalogItemByID(item.ID, true)
+}
+
+// UpdateCatalogItem updates a catalog item. Orders already placed keep the
+// answers they were given.
+func UpdateCatalogItem(id uint, req CatalogItemRequest) (*CatalogItem, error) {
+	item, err := GetCatalogItemByID(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCatalogItem(&req); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(item).Updates(map[string]interface{}{
+		"name":           req.Name,
+		"description":    req.Description,
+		"category":       req.Category,
+		"form":           CatalogForm(req.Form),
+		"queue_id":       req.QueueID,
+		"request_type":   req.RequestType,
+		"priority":       req.Priority,
+		"delivery_hours": req.DeliveryHours,
+		"article_id":     req.ArticleID,
+		"active":         req.Active == nil || *req.Active,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetCatalogItemByID(id, true)
+}
+
+// DeleteCatalogItem removes an item from the catalog. Its orders keep their
+// answers but no longer point at the item.
+func DeleteCatalogItem(id uint) error {
+	item, err := GetCatalogItemByID(id, true)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Ticket{}).Where("catalog_item_id = ?", id).Update("catalog_item_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(item).Error
+	})
+}
+
+// OrderCatalogItem checks the answers to an item's form and raises the
+// fulfilment ticket for the requester
+func OrderCatalogItem(id uint, order CatalogOrder, requesterID uint) (*Ticket, error) {
+	item, err := GetCatalogItemByID(id, false)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := normaliseValues(item.Form.fields(), order.Answers, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateTicket(TicketRequest{
+		Subject:       item.Name,
+		Description:   orderDescription(item, answers, order.Details),
+		Priority:      item.Priority,
+		Category:      item.Category,
+		CustomFields:  order.CustomFields,
+		RequestType:   item.RequestType,
+		CatalogItemID: &item.ID,
+		FormAnswers:   answers,
+	}, requesterID)
+}
+
+// orderDescription writes the answers of an order out for the ticket description
+func orderDescription(item *CatalogItem, answers JSONMap, details string) string {
+	var b strings.Builder
+	if details = strings.TrimSpace(details); details != "" {
+		b.WriteString(details)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "Ordered from the service catalog: %s\n", item.Name)
+	for _, question := range item.Form {
+		if value, ok := answers[question.Key]; ok {
+			fmt.Fprintf(&b, "\n%s: %s", question.Label, customFieldText(value))
+		}
+	}
+	return b.String()
+}
+
+// routeCatalogOrder sends a catalog order to its item's fulfilment queue
+// and sets the expected delivery. It reports whether the order was routed;
+// items without a queue leave it to the routing rules.
+func routeCatalogOrder(tx *gorm.DB, ticket *Ticket) (bool, error) {
+	var item CatalogItem
+	if err := tx.First(&item, *ticket.CatalogItemID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	updates := map[string]interface{}{}
+	if item.DeliveryHours > 0 {
+		expectedBy := time.Now().Add(time.Duration(item.DeliveryHours) * time.Hour)
+		ticket.ExpectedBy = &expectedBy
+		updates["expected_by"] = expectedBy
+	}
+	if item.QueueID != nil {
+		ticket.QueueID = item.QueueID
+		updates["queue_id"] = item.QueueID
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+			return false, err
+		}
+	}
+	if item.QueueID == nil {
+		return false, nil
+	}
+	return true, autoAssignTicket(tx, ticket)
+}
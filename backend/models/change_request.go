@@ -0,0 +1,460 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChangeRequest is a planned change to a service, carried out in its
+// window once the change advisory board (CAB) approved it
+type ChangeRequest struct {
+	ID                 uint            `json:"id" gorm:"primaryKey"`
+	Title              string          `json:"title"`
+	Description        string          `json:"description"`
+	Service            string          `json:"service"`
+	Risk               string          `json:"risk"`
+	Impact             string          `json:"impact"`
+	ImplementationPlan string          `json:"implementation_plan"`
+	BackoutPlan        string          `json:"backout_plan"`
+	WindowStart        time.Time       `json:"window_start"`
+	WindowEnd          time.Time       `json:"window_end"`
+	Status             string          `json:"status"`
+	RequesterID        uint            `json:"requester_id"`
+	Requester          User            `json:"requester" gorm:"foreignKey:RequesterID"`
+	CABDecidedByID     *uint           `json:"cab_decided_by_id"`
+	CABDecidedBy       *User           `json:"cab_decided_by,omitempty" gorm:"foreignKey:CABDecidedByID"`
+	CABDecidedAt       *time.Time      `json:"cab_decided_at"`
+	CABNote            string          `json:"cab_note"`
+	Assets             []Asset         `json:"assets,omitempty" gorm:"many2many:change_request_assets"`
+	Conflicts          []ChangeRequest `json:"conflicts,omitempty" gorm:"-"` // Overlapping changes to the same service
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// ChangeRequestRequest is used for creating/updating change requests
+type ChangeRequestRequest struct {
+	Title              string    `json:"title" binding:"required"`
+	Description        string    `json:"description"`
+	Service            string    `json:"service" binding:"required"`
+	Risk               string    `json:"risk"`   // Defaults to low
+	Impact             string    `json:"impact"` // Defaults to low
+	ImplementationPlan string    `json:"implementation_plan" binding:"required"`
+	BackoutPlan        string    `json:"backout_plan" binding:"required"`
+	WindowStart        time.Time `json:"window_start" binding:"required"`
+	WindowEnd          time.Time `json:"window_end" binding:"required"`
+}
+
+// ChangeStatusChange moves a change request to a new status
+type ChangeStatusChange struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// CABDecision is the change advisory board's verdict on a submitted change
+type CABDecision struct {
+	Note string `json:"note" binding:"max=5000"`
+}
+
+// Change request statuses
+const (
+	ChangeStatusDraft       = "draft"
+	ChangeStatusSubmitted   = "submitted" // Awaiting the CAB
+	ChangeStatusApproved    = "approved"
+	ChangeStatusRejected    = "rejected"
+	ChangeStatusImplemented = "implemented"
+	ChangeStatusFailed      = "failed" // Backed out
+	ChangeStatusCancelled   = "cancelled"
+)
+
+// Change risk and impact levels
+const (
+	ChangeLevelLow    = "low"
+	ChangeLevelMedium = "medium"
+	ChangeLevelHigh   = "high"
+)
+
+var (
+	ValidChangeStatuses = []string{
+		ChangeStatusDraft, ChangeStatusSubmitted, ChangeStatusApproved, ChangeStatusRejected,
+		ChangeStatusImplemented, ChangeStatusFailed, ChangeStatusCancelled,
+	}
+	ValidChangeLevels = []string{ChangeLevelLow, ChangeLevelMedium, ChangeLevelHigh}
+
+	// changeTransitions lists the statuses the requester may move a change to.
+	// Approval and rejection are CAB decisions.
+	changeTransitions = map[string][]string{
+		ChangeStatusDraft:     {ChangeStatusSubmitted, ChangeStatusCancelled},
+		ChangeStatusSubmitted: {ChangeStatusDraft, ChangeStatusCancelled},
+		ChangeStatusApproved:  {ChangeStatusImplemented, ChangeStatusFailed, ChangeStatusCancelled},
+		ChangeStatusRejected:  {ChangeStatusDraft},
+	}
+
+	// scheduledChangeStatuses are the statuses whose windows are booked
+	scheduledChangeStatuses = []string{ChangeStatusSubmitted, ChangeStatusApproved}
+)
+
+var (
+	ErrChangeNotFound      = errors.New("change request not found")
+	ErrInvalidChangeStatus = errors.New("invalid change status")
+	ErrInvalidChangeLevel  = errors.New("invalid risk or impact, expected low, medium or high")
+	ErrInvalidChangeWindow = errors.New("the change window must end after it starts")
+	ErrChangeLocked        = errors.New("only draft or rejected changes can be edited")
+	ErrChangeNotSubmitted  = errors.New("change request is not awaiting the CAB")
+	ErrChangeConflict      = errors.New("change window overlaps an approved change to the same service")
+	ErrNotCABMember        = errors.New("only CAB members can decide change requests")
+	ErrChangeForbidden     = errors.New("only the requester or an admin can change this request")
+	ErrChangeModified      = errors.New("change request was changed by someone else, try again")
+)
+
+// Reference returns the human-readable change number
+func (c *ChangeRequest) Reference() string {
+	return fmt.Sprintf("CHG-%d", c.ID)
+}
+
+// IsCABMember reports whether a user sits on the change advisory board:
+// admins and the members of the group named by CAB_GROUP (default "CAB")
+func IsCABMember(user *User) (bool, error) {
+	if user.Role == "admin" {
+		return true, nil
+	}
+	name := os.Getenv("CAB_GROUP")
+	if name == "" {
+		name = "CAB"
+	}
+	var count int64
+	err := DB.Table("group_members").
+		Joins("JOIN groups ON groups.id = group_members.group_id").
+		Where("group_members.user_id = ? AND LOWER(groups.display_name) = LOWER(?)", user.ID, name).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// preloadChange loads the requester, CAB decider and assets of change requests
+func preloadChange(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Requester").Preload("CABDecidedBy").Preload("Assets")
+}
+
+// GetChangeRequests lists change requests by window, optionally by status
+// and service
+func GetChangeRequests(status, service string) ([]ChangeRequest, error) {
+	var changes []ChangeRequest
+	query := preloadChange(DB).Order("window_start, id")
+	if status != "" {
+		query = query.Where("status IN ?", strings.Split(status, ","))
+	}
+	if service != "" {
+		query = query.Where("LOWER(service) = LOWER(?)", service)
+	}
+	err := query.Find(&changes).Error
+	return changes, err
+}
+
+// GetChangeCalendar lists the changes whose windows overlap the period,
+// leaving out drafts, rejected and cancelled changes
+func GetChangeCalendar(from, to time.Time, service string) ([]ChangeRequest, error) {
+	var changes []ChangeRequest
+	query := preloadChange(DB).
+		Where("window_start < ? AND window_end > ?", to, from).
+		Where("status IN ?", []string{ChangeStatusSubmitted, ChangeStatusApproved, ChangeStatusImplemented, ChangeStatusFailed}).
+		Order("window_start, id")
+	if service != "" {
+		query = query.Where("LOWER(service) = LOWER(?)", service)
+	}
+	err := query.Find(&changes).Error
+	return changes, err
+}
+
+// GetChangeRequestByID retrieves a change request with the changes its
+// window conflicts with
+func GetChangeRequestByID(id uint) (*ChangeRequest, error) {
+	var change ChangeRequest
+	if err := preloadChange(DB).First(&change, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChangeNotFound
+		}
+		return nil, err
+	}
+	conflicts, err := FindChangeConflicts(change.Service, change.WindowStart, change.WindowEnd, change.ID)
+	if err != nil {
+		return nil, err
+	}
+	change.Conflicts = conflicts
+	return &change, nil
+}
+
+// FindChangeConflicts lists the submitted and approved changes to the same
+// service whose windows overlap the given window. exceptID leaves out the
+// change being checked.
+func FindChangeConflicts(service string, start, end time.Time, exceptID uint) ([]ChangeRequest, error) {
+	var conflicts []ChangeRequest
+	err := preloadChange(DB).
+		Where("LOWER(service) = LOWER(?) AND id <> ? AND status IN ?", service, exceptID, scheduledChangeStatuses).
+		Where("window_start < ? AND window_end > ?", end, start).
+		Order("window_start, id").
+		Find(&conflicts).Error
+	return conflicts, err
+}
+
+// validateChangeRequest checks the levels and window of a change request
+// and fills in the defaults
+func validateChangeRequest(req *ChangeRequestRequest) error {
+	req.Service = strings.TrimSpace(req.Service)
+	if req.Risk == "" {
+		req.Risk = ChangeLevelLow
+	}
+	if req.Impact == "" {
+		req.Impact = ChangeLevelLow
+	}
+	if !containsString(ValidChangeLevels, req.Risk) || !containsString(ValidChangeLevels, req.Impact) {
+		return ErrInvalidChangeLevel
+	}
+	if !req.WindowEnd.After(req.WindowStart) {
+		return ErrInvalidChangeWindow
+	}
+	return nil
+}
+
+// CreateChangeRequest records a draft change
+func CreateChangeRequest(req ChangeRequestRequest, requester *User) (*ChangeRequest, error) {
+	if err := validateChangeRequest(&req); err != nil {
+		return nil, err
+	}
+
+	change := ChangeRequest{
+		Title:              req.Title,
+		Description:        req.Description,
+		Service:            req.Service,
+		Risk:               req.Risk,
+		Impact:             req.Impact,
+		ImplementationPlan: req.ImplementationPlan,
+		BackoutPlan:        req.BackoutPlan,
+		WindowStart:        req.WindowStart,
+		WindowEnd:          req.WindowEnd,
+		Status:             ChangeStatusDraft,
+		RequesterID:        requester.ID,
+	}
+	if err := DB.Create(&change).Error; err != nil {
+		return nil, err
+	}
+	return GetChangeRequestByID(change.ID)
+}
+
+// editableChange loads a change request the user may change
+func editableChange(id uint, user *User) (*ChangeRequest, error) {
+	change, err := GetChangeRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if change.RequesterID != user.ID && user.Role != "admin" {
+		return nil, ErrChangeForbidden
+	}
+	return change, nil
+}
+
+// UpdateChangeRequest edits a draft or rejected change. A rejected change
+// goes back to draft, to be submitted again.
+func UpdateChangeRequest(id uint, req ChangeRequestRequest, user *User) (*ChangeRequest, error) {
+	change, err := editableChange(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if change.Status != ChangeStatusDraft && change.Status != ChangeStatusRejected {
+		return nil, ErrChangeLocked
+	}
+	if err := validateChangeRequest(&req); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(&ChangeRequest{ID: id}).Updates(map[string]interface{}{
+		"title":               req.Title,
+		"description":         req.Description,
+		"service":             req.Service,
+		"risk":                req.Risk,
+		"impact":              req.Impact,
+		"implementation_plan": req.ImplementationPlan,
+		"backout_plan":        req.BackoutPlan,
+		"window_start":        req.WindowStart,
+		"window_end":          req.WindowEnd,
+		"status":              ChangeStatusDraft,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetChangeRequestByID(id)
+}
+
+// ChangeChangeStatus moves a change request on for its requester: submitting
+// it to the CAB, withdrawing or cancelling it, and recording the outcome of
+// an approved change
+func ChangeChangeStatus(id uint, change ChangeStatusChange, user *User) (*ChangeRequest, error) {
+	if !containsString(ValidChangeStatuses, change.Status) {
+		return nil, ErrInvalidChangeStatus
+	}
+	current, err := editableChange(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(changeTransitions[current.Status], change.Status) {
+		return nil, ErrInvalidTransition
+	}
+
+	result := DB.Model(&ChangeRequest{}).Where("id = ? AND status = ?", id, current.Status).Update("status", change.Status)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidTransition
+	}
+	return GetChangeRequestByID(id)
+}
+
+// DecideChangeRequest records the CAB's decision on a submitted change.
+// Requesters cannot decide their own changes, and a change is not approved
+// while its window overlaps an approved change to the same service.
+func DecideChangeRequest(id uint, approve bool, decision CABDecision, actor *User) (*ChangeRequest, error) {
+	member, err := IsCABMember(actor)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrNotCABMember
+	}
+
+	var change ChangeRequest
+	if err := DB.First(&change, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChangeNotFound
+		}
+		return nil, err
+	}
+	if change.RequesterID == actor.ID {
+		return nil, ErrSelfApproval
+	}
+
+	now := time.Now()
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the change with every scheduled change overlapping it, in ID
+		// order, so decisions on overlapping changes run one after the other
+		var locked []ChangeRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? OR (LOWER(service) = LOWER(?) AND status IN ? AND window_start < ? AND window_end > ?)",
+				id, change.Service, scheduledChangeStatuses, change.WindowEnd, change.WindowStart).
+			Order("id").
+			Find(&locked).Error; err != nil {
+			return err
+		}
+
+		var current *ChangeRequest
+		approved := false
+		for i := range locked {
+			if locked[i].ID == id {
+				current = &locked[i]
+			} else if locked[i].Status == ChangeStatusApproved {
+				approved = true
+			}
+		}
+		if current == nil {
+			return ErrChangeNotFound
+		}
+		if current.Status != ChangeStatusSubmitted {
+			return ErrChangeNotSubmitted
+		}
+		// Withdrawn, edited and resubmitted meanwhile: the locked set may be stale
+		if !strings.EqualFold(current.Service, change.Service) ||
+			!current.WindowStart.Equal(change.WindowStart) || !current.WindowEnd.Equal(change.WindowEnd) {
+			return ErrChangeModified
+		}
+
+		status := ChangeStatusRejected
+		if approve {
+			if approved {
+				return ErrChangeConflict
+			}
+			status = ChangeStatusApproved
+		}
+		return tx.Model(current).Updates(map[string]interface{}{
+			"status":            status,
+			"cab_decided_by_id": actor.ID,
+			"cab_decided_at":    now,
+			"cab_note":          decision.Note,
+		}).Error
+	}); err != nil {
+		return nil, err
+	}
+	return GetChangeRequestByID(id)
+}
+
+// DeleteChangeRequest removes a change request
+func DeleteChangeRequest(id uint) error {
+	if _, err := GetChangeRequestByID(id); err != nil {
+		return err
+	}
+	return DB.Delete(&ChangeRequest{}, id).Error
+}
+
+// changeEventStatus maps a change status to the iCalendar event status
+func changeEventStatus(status string) string {
+	switch status {
+	case ChangeStatusApproved, ChangeStatusImplemented, ChangeStatusFailed:
+		return "CONFIRMED"
+	case ChangeStatusCancelled, ChangeStatusRejected:
+		return "CANCELLED"
+	default:
+		return "TENTATIVE"
+	}
+}
+
+// icsEscaper escapes TEXT values as required by RFC 5545, which allows
+// no bare CR: every line break, CRLF, CR or LF, becomes \n
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+
+// writeICSLine writes a content line, folded at 75 octets without
+// splitting UTF-8 sequences
+func writeICSLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// ChangeCalendarICS renders change requests as an iCalendar feed
+func ChangeCalendarICS(changes []ChangeRequest) string {
+	const stamp = "20060102T150405Z"
+
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//SupportDesk//Change Calendar//EN")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "X-WR-CALNAME:Change calendar")
+	for _, change := range changes {
+		description := fmt.Sprintf("Service: %s\nRisk: %s\nImpact: %s\nStatus: %s\n\n%s",
+			change.Service, change.Risk, change.Impact, change.Status, change.Description)
+
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, fmt.Sprintf("UID:change-%d@supportdesk", change.ID))
+		writeICSLine(&b, "DTSTAMP:"+change.UpdatedAt.UTC().Format(stamp))
+		writeICSLine(&b, "DTSTART:"+change.WindowStart.UTC().Format(stamp))
+		writeICSLine(&b, "DTEND:"+change.WindowEnd.UTC().Format(stamp))
+		writeICSLine(&b, "SUMMARY:"+icsEscaper.Replace(fmt.Sprintf("%s %s (%s)", change.Reference(), change.Title, change.Service)))
+		writeICSLine(&b, "DESCRIPTION:"+icsEscaper.Replace(strings.TrimSpace(description)))
+		writeICSLine(&b, "CATEGORIES:"+icsEscaper.Replace(change.Service))
+		writeICSLine(&b, "STATUS:"+changeEventStatus(change.Status))
+		writeICSLine(&b, "END:VEVENT")
+	}
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.String()
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CSATSurvey asks the requester of a resolved ticket how satisfied they
+// were. The agent, queue and category are kept as they were at resolution.
+type CSATSurvey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TicketID    uint       `json:"ticket_id"`
+	Ticket      *Ticket    `json:"ticket,omitempty" gorm:"foreignKey:TicketID"`
+	TokenHash   string     `json:"-"`
+	RequesterID uint       `json:"requester_id"`
+	AgentID     *uint      `json:"agent_id"`
+	QueueID     *uint      `json:"queue_id"`
+	Category    string     `json:"category"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Score       *int       `json:"score"`
+	Comment     string     `json:"comment"`
+	RespondedAt *time.Time `json:"responded_at"`
+	FollowUp    string     `json:"follow_up,omitempty"` // What was done about a low score
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// CSATResponse is the requester's answer to a survey
+type CSATResponse struct {
+	Score   int    `json:"score" binding:"required,min=1,max=5"`
+	Comment string `json:"comment" binding:"max=2000"`
+}
+
+// CSATStat aggregates the survey responses of one group in one period.
+// CSAT is the share of responses scoring 4 or 5, in percent.
+type CSATStat struct {
+	GroupID   *uint     `json:"group_id"` // Agent or queue ID; null for categories and unassigned tickets
+	Group     string    `json:"group"`
+	Period    time.Time `json:"period"`
+	Responses int64     `json:"responses"`
+	Average   float64   `json:"average"`
+	Satisfied int64     `json:"satisfied"`
+	CSAT      float64   `json:"csat" gorm:"-"`
+}
+
+// CSAT report groupings
+const (
+	CSATGroupAgent    = "agent"
+	CSATGroupQueue    = "queue"
+	CSATGroupCategory = "category"
+)
+
+var (
+	ValidCSATGroups    = []string{CSATGroupAgent, CSATGroupQueue, CSATGroupCategory}
+	ValidCSATIntervals = []string{"day", "week", "month"}
+)
+
+var (
+	ErrSurveyNotFound      = errors.New("survey not found")
+	ErrSurveyAnswered      = errors.New("survey has already been answered")
+	ErrSurveyExpired       = errors.New("survey has expired")
+	ErrInvalidCSATGroup    = errors.New("invalid grouping, expected agent, queue or category")
+	ErrInvalidCSATInterval = errors.New("invalid interval, expected day, week or month")
+)
+
+// csatSurveyTTL returns how long a survey link stays valid
+func csatSurveyTTL() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("CSAT_SURVEY_TTL_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return 14 * 24 * time.Hour
+}
+
+// csatLowScore returns the highest score that counts as a low score
+func csatLowScore() int {
+	if score, err := strconv.Atoi(os.Getenv("CSAT_LOW_SCORE")); err == nil && score >= 1 && score <= 5 {
+		return score
+	}
+	return 2
+}
+
+// sendCSATSurvey creates the survey of a resolved ticket and mails the link
+// to the requester. Each ticket is surveyed once, however often it is resolved.
+func sendCSATSurvey(ticket *Ticket) {
+	if os.Getenv("CSAT_SURVEYS_ENABLED") == "false" {
+		return
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Warning: Could not create CSAT survey for %s: %v", ticket.Reference(), err)
+		return
+	}
+	survey := CSATSurvey{
+		TicketID:    ticket.ID,
+		TokenHash:   tokenHash,
+		RequesterID: ticket.RequesterID,
+		AgentID:     ticket.AssigneeID,
+		QueueID:     ticket.QueueID,
+		Category:    ticket.Category,
+		ExpiresAt:   time.Now().Add(csatSurveyTTL()),
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&survey)
+	if result.Error != nil {
+		log.Printf("Warning: Could not create CSAT survey for %s: %v", ticket.Reference(), result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	subject := fmt.Sprintf("[%s] How did we do?", ticket.Reference())
+	body := fmt.Sprintf(
+		"Your ticket %s \"%s\" has been resolved.\n\nHow satisfied are you with the help you received? Rate us from 1 to 5 here:\n%s\n\nThis link expires on %s.",
+		ticket.Reference(), ticket.Subject, mailer.Link("/survey/"+token), survey.ExpiresAt.Format("2006-01-02"),
+	)
+	if err := mailer.Send(ticket.Requester.Email, subject, body); err != nil {
+		log.Printf("Warning: Could not send CSAT survey of %s to %s: %v", ticket.Reference(), ticket.Requester.Email, err)
+	}
+}
+
+// GetCSATSurveyByToken retrieves a survey by its plain token
+func GetCSATSurveyByToken(token string) (*CSATSurvey, error) {
+	var survey CSATSurvey
+	if err := DB.Preload("Ticket").Where("token_hash = ?", hashToken(token)).First(&survey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSurveyNotFound
+		}
+		return nil, err
+	}
+	return &survey, nil
+}
+
+// GetTicketCSATSurvey retrieves the survey sent for a ticket
+func GetTicketCSATSurvey(ticketID uint) (*CSATSurvey, error) {
+	var survey CSATSurvey
+	if err := DB.Where("ticket_id = ?", ticketID).First(&survey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSurveyNotFound
+		}
+		return nil, err
+	}
+	return &survey, nil
+}
+
+// SubmitCSATResponse records the answer to a survey. Only the first answer
+// counts. A low score is followed up as configured.
+func SubmitCSATResponse(token string, response CSATResponse) (*CSATSurvey, error) {
+	survey, err := GetCSATSurveyByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if survey.RespondedAt != nil {
+		return nil, ErrSurveyAnswered
+	}
+	now := time.Now()
+	if now.After(survey.ExpiresAt) {
+		return nil, ErrSurveyExpired
+	}
+
+	// The responded_at condition keeps a concurrent second answer out
+	result := DB.Model(&CSATSurvey{}).Where("id = ? AND responded_at IS NULL", survey.ID).Updates(map[string]interface{}{
+		"score":        response.Score,
+		"comment":      strings.TrimSpace(response.Comment),
+		"responded_at": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSurveyAnswered
+	}
+
+	if response.Score <= csatLowScore() {
+		survey.Score, survey.Comment = &response.Score, strings.TrimSpace(response.Comment)
+		followUpLowScore(survey)
+	}
+	return GetCSATSurveyByToken(token)
+}
+
+// followUpLowScore reopens the ticket when CSAT_LOW_SCORE_REOPEN is "true"
+// and mails the addresses in CSAT_SUPERVISOR_EMAIL
+func followUpLowScore(survey *CSATSurvey) {
+	ticket := survey.Ticket
+	var actions []string
+
+	if os.Getenv("CSAT_LOW_SCORE_REOPEN") == "true" && ticket.Status == TicketStatusResolved {
+		requester, err := GetUserByID(survey.RequesterID)
+		if err == nil {
+			_, err = ChangeTicketStatus(ticket.ID, TicketStatusChange{Status: TicketStatusOpen}, requester)
+		}
+		if err != nil {
+			log.Printf("Warning: Could not reopen %s after a low CSAT score: %v", ticket.Reference(), err)
+		} else {
+			actions = append(actions, "reopened")
+		}
+	}
+
+	supervisors := envAddresses("CSAT_SUPERVISOR_EMAIL")
+	if len(supervisors) > 0 {
+		subject := fmt.Sprintf("[%s] Low satisfaction score: %d/5", ticket.Reference(), *survey.Score)
+		body := fmt.Sprintf("The requester of %s \"%s\" rated the support %d out of 5.\n", ticket.Reference(), ticket.Subject, *survey.Score)
+		if survey.Comment != "" {
+			body += fmt.Sprintf("\nComment:\n%s\n", survey.Comment)
+		}
+		if len(actions) > 0 {
+			body += "\nThe ticket was reopened.\n"
+		}
+		body += "\n" + mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID))
+
+		for _, to := range supervisors {
+			if err := mailer.Send(to, subject, body); err != nil {
+				log.Printf("Warning: Could not send low CSAT score of %s to %s: %v", ticket.Reference(), to, err)
+			}
+		}
+		actions = append(actions, "supervisor notified")
+	}
+
+	if len(actions) > 0 {
+		if err := DB.Model(survey).Update("follow_up", strings.Join(actions, ", ")).Error; err != nil {
+			log.Printf("Warning: Could not record CSAT follow-up of %s: %v", ticket.Reference(), err)
+		}
+	}
+}
+
+// csatGroupings are the groupings of the CSAT report
+var csatGroupings = map[string]reportGrouping{
+	CSATGroupAgent:    {"s.agent_id", "COALESCE(NULLIF(u.name, ''), u.email, 'Unassigned')", "LEFT JOIN users u ON u.id = s.agent_id"},
+	CSATGroupQueue:    {"s.queue_id", "COALESCE(q.name, 'Unqueued')", "LEFT JOIN queues q ON q.id = s.queue_id"},
+	CSATGroupCategory: {"NULL::bigint", "s.category", ""},
+}
+
+// GetCSATReport aggregates the survey responses received since the given
+// time per group (agent, queue or category) and per day, week or month
+func GetCSATReport(group, interval string, since time.Time) ([]CSATStat, error) {
+	grouping, ok := csatGroupings[group]
+	if !ok {
+		return nil, ErrInvalidCSATGroup
+	}
+	if !containsString(ValidCSATIntervals, interval) {
+		return nil, ErrInvalidCSATInterval
+	}
+
+	var stats []CSATStat
+	query := groupedReport("csat_surveys s", "s.responded_at", interval, grouping,
+		`COUNT(*) AS responses,
+			AVG(s.score) AS average,
+			COUNT(*) FILTER (WHERE s.score >= 4) AS satisfied`).
+		Where("s.responded_at >= ?", since)
+	if err := scanGroupedReport(query, &stats); err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		stats[i].Average = math.Round(stats[i].Average*100) / 100
+		if stats[i].Responses > 0 {
+			stats[i].CSAT = math.Round(float64(stats[i].Satisfied)*1000/float64(stats[i].Responses)) / 10
+		}
+	}
+	return stats, nil
+}
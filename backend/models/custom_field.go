@@ -0,0 +1,422 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// JSONMap is a JSON object stored in a jsonb column
+type JSONMap map[string]interface{}
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = JSONMap{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", value)
+	}
+	result := JSONMap{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*m = result
+	return nil
+}
+
+// CustomField is an admin-defined field that tickets or articles of a
+// category carry besides their built-in ones
+type CustomField struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Entity    string         `json:"entity"`
+	Category  string         `json:"category"`
+	Key       string         `json:"key"`
+	Label     string         `json:"label"`
+	Type      string         `json:"type"`
+	Required  bool           `json:"required"`
+	Options   pq.StringArray `json:"options" gorm:"type:text[]"`
+	Position  int            `json:"position"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// CustomFieldRequest is used for creating/updating custom fields. The
+// entity, category and key of a field cannot change once it is created.
+type CustomFieldRequest struct {
+	Entity   string   `json:"entity" binding:"required"`
+	Category string   `json:"category" binding:"required"`
+	Key      string   `json:"key" binding:"required"`
+	Label    string   `json:"label" binding:"required"`
+	Type     string   `json:"type" binding:"required"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+	Position int      `json:"position"`
+}
+
+// Entities custom fields belong to
+const (
+	CustomFieldEntityTicket  = "ticket"
+	CustomFieldEntityArticle = "article"
+)
+
+// Custom field types. User fields hold the ID of a user.
+const (
+	FieldTypeText        = "text"
+	FieldTypeNumber      = "number"
+	FieldTypeDate        = "date"
+	FieldTypeSelect      = "select"
+	FieldTypeMultiSelect = "multi_select"
+	FieldTypeUser        = "user"
+)
+
+var (
+	ValidCustomFieldEntities = []string{CustomFieldEntityTicket, CustomFieldEntityArticle}
+	ValidFieldTypes          = []string{FieldTypeText, FieldTypeNumber, FieldTypeDate, FieldTypeSelect, FieldTypeMultiSelect, FieldTypeUser}
+)
+
+// fieldKeyPattern is what a custom field key looks like
+var fieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// maxFieldTextLength bounds the value of a text field
+const maxFieldTextLength = 1000
+
+var (
+	ErrCustomFieldNotFound  = errors.New("custom field not found")
+	ErrInvalidFieldEntity   = errors.New("invalid entity, expected ticket or article")
+	ErrInvalidFieldType     = errors.New("invalid field type")
+	ErrInvalidFieldKey      = errors.New("field key must be lower case letters, digits and underscores, starting with a letter")
+	ErrFieldOptionsRequired = errors.New("select fields need at least one option")
+	ErrFieldKeyTaken        = errors.New("a field with this key already exists for the category")
+	ErrFieldImmutable       = errors.New("the entity, category and key of a field cannot change")
+	ErrInvalidFieldValue    = errors.New("invalid field value")
+)
+
+// validateCustomField checks a custom field definition
+func validateCustomField(req *CustomFieldRequest) error {
+	if !containsString(ValidCustomFieldEntities, req.Entity) {
+		return ErrInvalidFieldEntity
+	}
+	if !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	options, err := validateFieldShape(req.Key, req.Type, req.Options)
+	if err != nil {
+		return err
+	}
+	req.Options = options
+	return nil
+}
+
+// validateFieldShape checks the key and type of a field and returns its
+// cleaned up options, which only select fields keep
+func validateFieldShape(key, fieldType string, options []string) ([]string, error) {
+	if !fieldKeyPattern.MatchString(key) {
+		return nil, ErrInvalidFieldKey
+	}
+	if !containsString(ValidFieldTypes, fieldType) {
+		return nil, ErrInvalidFieldType
+	}
+	if fieldType != FieldTypeSelect && fieldType != FieldTypeMultiSelect {
+		return nil, nil
+	}
+
+	var cleaned []string
+	for _, option := range options {
+		if option = strings.TrimSpace(option); option != "" && !containsString(cleaned, option) {
+			cleaned = append(cleaned, option)
+		}
+	}
+	if len(cleaned) == 0 {
+		return nil, ErrFieldOptionsRequired
+	}
+	return cleaned, nil
+}
+
+// GetCustomFields lists the custom fields of an entity, optionally of one
+// category only, in form order
+func GetCustomFields(entity, category string) ([]CustomField, error) {
+	var fields []CustomField
+	query := DB.Order("category, position, id")
+	if entity != "" {
+		query = query.Where("entity = ?", entity)
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	err := query.Find(&fields).Error
+	return fields, err
+}
+
+// GetCustomFieldByID retrieves a custom field
+func GetCustomFieldByID(id uint) (*CustomField, error) {
+	var field CustomField
+	if err := DB.First(&field, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCustomFieldNotFound
+		}
+		return nil, err
+	}
+	return &field, nil
+}
+
+// CreateCustomField adds a custom field to a category
+func CreateCustomField(req CustomFieldRequest) (*CustomField, error) {
+	if err := validateCustomField(&req); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := DB.Model(&CustomField{}).Where("entity = ? AND category = ? AND key = ?", req.Entity, req.Category, req.Key).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrFieldKeyTaken
+	}
+
+	field := CustomField{
+		Entity:   req.Entity,
+		Category: req.Category,
+		Key:      req.Key,
+		Label:    req.Label,
+		Type:     req.Type,
+		Required: req.Required,
+		Options:  req.Options,
+		Position: req.Position,
+	}
+	if err := DB.Create(&field).Error; err != nil {
+		return nil, err
+	}
+	return &field, nil
+}
+
+// UpdateCustomField changes the label, type, options, position and
+// whether a field is required. Stored values are not converted.
+func UpdateCustomField(id uint, req CustomFieldRequest) (*CustomField, error) {
+	field, err := GetCustomFieldByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Entity != field.Entity || req.Category != field.Category || req.Key != field.Key {
+		return nil, ErrFieldImmutable
+	}
+	if err := validateCustomField(&req); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(field).Updates(map[string]interface{}{
+		"label":    req.Label,
+		"type":     req.Type,
+		"required": req.Required,
+		"options":  pq.StringArray(req.Options),
+		"position": req.Position,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetCustomFieldByID(id)
+}
+
+// DeleteCustomField removes a custom field along with its stored values
+func DeleteCustomField(id uint) error {
+	field, err := GetCustomFieldByID(id)
+	if err != nil {
+		return err
+	}
+
+	table := "tickets"
+	if field.Entity == CustomFieldEntityArticle {
+		table = "tasks"
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE "+table+" SET custom_fields = custom_fields - ? WHERE category = ?", field.Key, field.Category).Error; err != nil {
+			return err
+		}
+		return tx.Delete(field).Error
+	})
+}
+
+// ValidateCustomFields checks the custom field values of a ticket or
+// article against the fields of its category and returns them normalised.
+// Missing required fields are only reported when requireAll is set.
+func ValidateCustomFields(entity, category string, values JSONMap, requireAll bool) (JSONMap, error) {
+	fields, err := GetCustomFields(entity, category)
+	if err != nil {
+		return nil, err
+	}
+	return normaliseValues(fields, values, requireAll)
+}
+
+// normaliseValues checks values against a set of fields and returns them
+// normalised, leaving out empty ones
+func normaliseValues(fields []CustomField, values JSONMap, requireAll bool) (JSONMap, error) {
+	byKey := make(map[string]*CustomField, len(fields))
+	for i := range fields {
+		byKey[fields[i].Key] = &fields[i]
+	}
+	for key := range values {
+		if _, ok := byKey[key]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidFieldValue, key)
+		}
+	}
+
+	normalised := JSONMap{}
+	for i := range fields {
+		field := &fields[i]
+		value, err := field.normalise(values[field.Key])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrInvalidFieldValue, field.Key, err)
+		}
+		if value == nil {
+			if field.Required && requireAll {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidFieldValue, field.Key)
+			}
+			continue
+		}
+		normalised[field.Key] = value
+	}
+	return normalised, nil
+}
+
+// normalise checks a value against the field type. Empty values come back
+// as nil.
+func (f *CustomField) normalise(value interface{}) (interface{}, error) {
+	if text, ok := value.(string); ok {
+		value = strings.TrimSpace(text)
+		if value == "" {
+			return nil, nil
+		}
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch f.Type {
+	case FieldTypeText:
+		text, ok := value.(string)
+		if !ok {
+			return nil, errors.New("must be text")
+		}
+		if len([]rune(text)) > maxFieldTextLength {
+			return nil, fmt.Errorf("must be at most %d characters", maxFieldTextLength)
+		}
+		return text, nil
+
+	case FieldTypeNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, errors.New("must be a number")
+		}
+		return number, nil
+
+	case FieldTypeDate:
+		text, ok := value.(string)
+		if !ok {
+			return nil, errors.New("must be a date such as 2024-01-31")
+		}
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return nil, errors.New("must be a date such as 2024-01-31")
+		}
+		return text, nil
+
+	case FieldTypeSelect:
+		text, ok := value.(string)
+		if !ok || !containsString(f.Options, text) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+		}
+		return text, nil
+
+	case FieldTypeMultiSelect:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.New("must be a list of options")
+		}
+		var chosen []string
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok || !containsString(f.Options, text) {
+				return nil, fmt.Errorf("must only contain %s", strings.Join(f.Options, ", "))
+			}
+			if !containsString(chosen, text) {
+				chosen = append(chosen, text)
+			}
+		}
+		if len(chosen) == 0 {
+			return nil, nil
+		}
+		return chosen, nil
+
+	case FieldTypeUser:
+		number, ok := value.(float64)
+		if !ok || number < 1 || number != math.Trunc(number) {
+			return nil, errors.New("must be a user ID")
+		}
+		if _, err := GetUserByID(uint(number)); err != nil {
+			return nil, errors.New("must be an existing user")
+		}
+		return uint(number), nil
+	}
+	return nil, ErrInvalidFieldType
+}
+
+// FilterCustomFields narrows a query on tickets or articles to those whose
+// custom fields hold the given values. A multi-select field matches when
+// the value is one of its choices.
+func FilterCustomFields(query *gorm.DB, filters map[string]string) *gorm.DB {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := filters[key]
+		query = query.Where("(custom_fields->>? = ? OR custom_fields->? @> to_jsonb(?::text))", key, value, key, value)
+	}
+	return query
+}
+
+// customFieldText formats a custom field value for an export
+func customFieldText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = customFieldText(item)
+		}
+		return strings.Join(items, "; ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
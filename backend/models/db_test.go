@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"supportdesk/migrations"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	testDBOnce sync.Once
+	testDB     *gorm.DB
+	testDBErr  error
+)
+
+// useTestDB points the models at the database in TEST_DATABASE_URL for the
+// rest of the test. Everything the test writes is rolled back when it ends.
+// Tests using it are skipped when the variable is not set.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	testDBOnce.Do(func() {
+		testDB, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr == nil {
+			testDBErr = migrations.RunMigrations(testDB)
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("preparing the test database: %v", testDBErr)
+	}
+
+	tx := testDB.Begin()
+	previous := DB
+	DB = tx
+	t.Cleanup(func() {
+		tx.Rollback()
+		DB = previous
+	})
+}
+
+// createTestUser creates an active user with the role
+func createTestUser(t *testing.T, role string) *User {
+	t.Helper()
+	user := User{
+		Email:    fmt.Sprintf("%s-%d@test.example", role, time.Now().UnixNano()),
+		Password: "unusable",
+		Role:     role,
+		Active:   true,
+	}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatalf("creating %s: %v", role, err)
+	}
+	return &user
+}
+
+// createTestTicket creates an open ticket of the requester, changed by
+// modify before it is saved
+func createTestTicket(t *testing.T, requester *User, modify func(*Ticket)) *Ticket {
+	t.Helper()
+	ticket := Ticket{
+		Subject:     "Printer on the second floor is jammed",
+		Description: "It shows a paper jam but there is no paper stuck.",
+		RequesterID: requester.ID,
+		Priority:    "P3",
+		Category:    "request-solving",
+		Status:      TicketStatusOpen,
+		Source:      SourceWeb,
+	}
+	if modify != nil {
+		modify(&ticket)
+	}
+	if err := DB.Create(&ticket).Error; err != nil {
+		t.Fatalf("creating ticket: %v", err)
+	}
+	return &ticket
+}
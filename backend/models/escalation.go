@@ -0,0 +1,478 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EscalationRule fires its actions on tickets that stayed too long in a
+// state, e.g. "P1 unassigned after 15 minutes"
+type EscalationRule struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Name             string         `json:"name" gorm:"not null"`
+	Position         int            `json:"position"`
+	Trigger          string         `json:"trigger" gorm:"not null"`
+	ThresholdMinutes int            `json:"threshold_minutes"`
+	CalendarID       *uint          `json:"calendar_id"` // Count the threshold in business hours
+	Priority         string         `json:"priority"`    // Conditions; empty matches every ticket
+	Category         string         `json:"category"`
+	QueueID          *uint          `json:"queue_id"`
+	ReassignToID     *uint          `json:"reassign_to_id"` // Actions
+	ReassignQueueID  *uint          `json:"reassign_queue_id"`
+	RaisePriority    bool           `json:"raise_priority"`
+	NotifyUserID     *uint          `json:"notify_user_id"`
+	WatcherID        *uint          `json:"watcher_id"`
+	Active           bool           `json:"active" gorm:"not null"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// EscalationRuleRequest is used for creating/updating escalation rules
+type EscalationRuleRequest struct {
+	Name             string `json:"name" binding:"required"`
+	Position         int    `json:"position"`
+	Trigger          string `json:"trigger" binding:"required"`
+	ThresholdMinutes int    `json:"threshold_minutes" binding:"min=1"`
+	CalendarID       *uint  `json:"calendar_id"`
+	Priority         string `json:"priority"`
+	Category         string `json:"category"`
+	QueueID          *uint  `json:"queue_id"`
+	ReassignToID     *uint  `json:"reassign_to_id"`
+	ReassignQueueID  *uint  `json:"reassign_queue_id"`
+	RaisePriority    bool   `json:"raise_priority"`
+	NotifyUserID     *uint  `json:"notify_user_id"`
+	WatcherID        *uint  `json:"watcher_id"`
+	Active           *bool  `json:"active"`
+}
+
+// EscalationLog records a rule firing on a ticket. Anchor is the moment the
+// rule measured from; a rule fires at most once per ticket and anchor.
+type EscalationLog struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	RuleID    uint            `json:"rule_id"`
+	Rule      *EscalationRule `json:"rule,omitempty" gorm:"foreignKey:RuleID"`
+	TicketID  uint            `json:"ticket_id" gorm:"index"`
+	Anchor    time.Time       `json:"anchor"`
+	Actions   string          `json:"actions"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Escalation triggers
+const (
+	EscalationTriggerUnassigned   = "unassigned"     // No assignee since the ticket was raised
+	EscalationTriggerNoAgentReply = "no_agent_reply" // No agent action since the last one, or since the ticket was raised
+	EscalationTriggerUnresolved   = "unresolved"     // Still open since the ticket was raised
+)
+
+var ValidEscalationTriggers = []string{EscalationTriggerUnassigned, EscalationTriggerNoAgentReply, EscalationTriggerUnresolved}
+
+var (
+	ErrEscalationRuleNotFound = errors.New("escalation rule not found")
+	ErrInvalidTrigger         = errors.New("invalid escalation trigger")
+	ErrNoEscalationAction     = errors.New("an escalation rule needs at least one action")
+)
+
+// hasAction reports whether the request configures any action
+func (r EscalationRuleRequest) hasAction() bool {
+	return r.ReassignToID != nil || r.ReassignQueueID != nil || r.RaisePriority || r.NotifyUserID != nil || r.WatcherID != nil
+}
+
+// validateEscalationRule checks the trigger, conditions and action targets of a rule request
+func validateEscalationRule(req EscalationRuleRequest) error {
+	if !containsString(ValidEscalationTriggers, req.Trigger) {
+		return ErrInvalidTrigger
+	}
+	if !req.hasAction() {
+		return ErrNoEscalationAction
+	}
+	if req.Priority != "" && !containsString(ValidTicketPriorities, req.Priority) {
+		return ErrInvalidPriority
+	}
+	if req.Category != "" && !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	if req.CalendarID != nil {
+		if _, err := GetBusinessCalendarByID(*req.CalendarID); err != nil {
+			return err
+		}
+	}
+	for _, queueID := range []*uint{req.QueueID, req.ReassignQueueID} {
+		if queueID != nil {
+			if _, err := GetQueueByID(*queueID); err != nil {
+				return err
+			}
+		}
+	}
+	if req.ReassignToID != nil {
+		agent, err := GetUserByID(*req.ReassignToID)
+		if err != nil || !agent.IsAgent() {
+			return ErrInvalidAssignee
+		}
+	}
+	for _, userID := range []*uint{req.NotifyUserID, req.WatcherID} {
+		if userID != nil {
+			if _, err := GetUserByID(*userID); err != nil {
+				return ErrUserNotFound
+			}
+		}
+	}
+	return nil
+}
+
+// GetEscalationRules lists escalation rules in evaluation order
+func GetEscalationRules() ([]EscalationRule, error) {
+	var rules []EscalationRule
+	err := DB.Order("position, id").Find(&rules).Error
+	return rules, err
+}
+
+// GetEscalationRuleByID retrieves a single escalation rule
+func GetEscalationRuleByID(id uint) (*EscalationRule, error) {
+	var rule EscalationRule
+	if err := DB.First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEscalationRuleNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateEscalationRule creates an escalation rule
+func CreateEscalationRule(req EscalationRuleRequest) (*EscalationRule, error) {
+	if err := validateEscalationRule(req); err != nil {
+		return nil, err
+	}
+
+	rule := EscalationRule{
+		Name:             req.Name,
+		Position:         req.Position,
+		Trigger:          req.Trigger,
+		ThresholdMinutes: req.ThresholdMinutes,
+		CalendarID:       req.CalendarID,
+		Priority:         req.Priority,
+		Category:         req.Category,
+		QueueID:          req.QueueID,
+		ReassignToID:     req.ReassignToID,
+		ReassignQueueID:  req.ReassignQueueID,
+		RaisePriority:    req.RaisePriority,
+		NotifyUserID:     req.NotifyUserID,
+		WatcherID:        req.WatcherID,
+		Active:           req.Active == nil || *req.Active,
+	}
+	if err := DB.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateEscalationRule updates an escalation rule
+func UpdateEscalationRule(id uint, req EscalationRuleRequest) (*EscalationRule, error) {
+	rule, err := GetEscalationRuleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEscalationRule(req); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":              req.Name,
+		"position":          req.Position,
+		"trigger":           req.Trigger,
+		"threshold_minutes": req.ThresholdMinutes,
+		"calendar_id":       req.CalendarID,
+		"priority":          req.Priority,
+		"category":          req.Category,
+		"queue_id":          req.QueueID,
+		"reassign_to_id":    req.ReassignToID,
+		"reassign_queue_id": req.ReassignQueueID,
+		"raise_priority":    req.RaisePriority,
+		"notify_user_id":    req.NotifyUserID,
+		"watcher_id":        req.WatcherID,
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if err := DB.Model(rule).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetEscalationRuleByID(id)
+}
+
+// DeleteEscalationRule deletes an escalation rule. Its log entries are kept.
+func DeleteEscalationRule(id uint) error {
+	if _, err := GetEscalationRuleByID(id); err != nil {
+		return err
+	}
+	return DB.Delete(&EscalationRule{}, id).Error
+}
+
+// GetTicketEscalations lists the escalations of a ticket, oldest first
+func GetTicketEscalations(ticketID uint) ([]EscalationLog, error) {
+	var logs []EscalationLog
+	err := DB.Preload("Rule", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Where("ticket_id = ?", ticketID).Order("created_at, id").Find(&logs).Error
+	return logs, err
+}
+
+// escalationCandidate is a ticket a rule may fire on
+type escalationCandidate struct {
+	ID     uint
+	Anchor time.Time
+}
+
+// candidates returns the tickets in the rule's trigger state for at least
+// the threshold in wall-clock time, with the moment the state began.
+// Requests awaiting approval are not worked yet and never escalate.
+func (r *EscalationRule) candidates(now time.Time) ([]escalationCandidate, error) {
+	anchor := "created_at"
+	query := DB.Model(&Ticket{}).Where("status IN ?", openTicketStatuses).
+		Where("approval_status IS DISTINCT FROM ?", ApprovalPending)
+
+	switch r.Trigger {
+	case EscalationTriggerUnassigned:
+		query = query.Where("assignee_id IS NULL")
+	case EscalationTriggerNoAgentReply:
+		// Tickets waiting on the requester are not waiting on an agent
+		query = query.Where("status IN ?", []string{TicketStatusNew, TicketStatusOpen})
+		anchor = "COALESCE(last_agent_reply_at, created_at)"
+	}
+
+	if r.Priority != "" {
+		query = query.Where("priority = ?", r.Priority)
+	}
+	if r.Category != "" {
+		query = query.Where("category = ?", r.Category)
+	}
+	if r.QueueID != nil {
+		query = query.Where("queue_id = ?", *r.QueueID)
+	}
+
+	// Business time never exceeds wall-clock time, so this bound is safe to pre-filter on
+	threshold := time.Duration(r.ThresholdMinutes) * time.Minute
+	var candidates []escalationCandidate
+	err := query.Select("id, "+anchor+" AS anchor").
+		Where(anchor+" <= ?", now.Add(-threshold)).
+		Scan(&candidates).Error
+	return candidates, err
+}
+
+// raisedPriority returns the next more urgent priority
+func raisedPriority(priority string) string {
+	for i, p := range ValidTicketPriorities {
+		if p == priority && i > 0 {
+			return ValidTicketPriorities[i-1]
+		}
+	}
+	return priority
+}
+
+// apply runs the rule's actions on a ticket and returns what was done
+func (r *EscalationRule) apply(tx *gorm.DB, ticket *Ticket) ([]string, error) {
+	var done []string
+	updates := map[string]interface{}{}
+
+	if r.ReassignQueueID != nil && (ticket.QueueID == nil || *ticket.QueueID != *r.ReassignQueueID) {
+		updates["queue_id"] = *r.ReassignQueueID
+		done = append(done, fmt.Sprintf("moved to queue %d", *r.ReassignQueueID))
+	}
+	if r.ReassignToID != nil {
+		agent, err := GetUserByID(*r.ReassignToID)
+		if err == nil && agent.IsAgent() && agent.Active {
+			updates["assignee_id"] = agent.ID
+			if ticket.Status == TicketStatusNew {
+				updates["status"] = TicketStatusOpen
+			}
+			done = append(done, "reassigned to "+agent.Email)
+		}
+	}
+	if r.RaisePriority {
+		if raised := raisedPriority(ticket.Priority); raised != ticket.Priority {
+			updates["priority"] = raised
+			done = append(done, fmt.Sprintf("priority raised from %s to %s", ticket.Priority, raised))
+		}
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// A ticket moved to another queue without a new assignee is picked up by that queue
+	if _, moved := updates["queue_id"]; moved && r.ReassignToID == nil {
+		if err := tx.Model(ticket).Update("assignee_id", nil).Error; err != nil {
+			return nil, err
+		}
+		ticket.AssigneeID = nil
+		if err := autoAssignTicket(tx, ticket); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.WatcherID != nil {
+		added, err := addTicketWatcher(tx, ticket.ID, *r.WatcherID)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			done = append(done, fmt.Sprintf("watcher %d added", *r.WatcherID))
+		}
+	}
+
+	if err := syncTicketSLA(tx, ticket.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// notify emails the rule's notify user and the ticket's watchers about an escalation
+func (r *EscalationRule) notify(ticket *Ticket, actions []string) {
+	recipients := make([]string, 0, len(ticket.Watchers)+1)
+	if r.NotifyUserID != nil {
+		if user, err := GetUserByID(*r.NotifyUserID); err == nil {
+			recipients = append(recipients, user.Email)
+		}
+	}
+	for _, watcher := range ticket.Watchers {
+		if !containsString(recipients, watcher.Email) {
+			recipients = append(recipients, watcher.Email)
+		}
+	}
+
+	subject := fmt.Sprintf("[%s] Escalated: %s", ticket.Reference(), ticket.Subject)
+	body := fmt.Sprintf("Ticket %s (%s, %s) was escalated by rule %q.\n", ticket.Reference(), ticket.Priority, ticket.Status, r.Name)
+	if len(actions) > 0 {
+		body += "Actions: " + strings.Join(actions, "; ") + "\n"
+	}
+	body += "\n" + mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID))
+
+	for _, to := range recipients {
+		if err := mailer.Send(to, subject, body); err != nil {
+			log.Printf("Warning: Could not send escalation of %s to %s: %v", ticket.Reference(), to, err)
+		}
+	}
+}
+
+// fire escalates a ticket once for the given anchor. It reports false when
+// the rule already fired for that anchor or the ticket awaits approval.
+func (r *EscalationRule) fire(candidate escalationCandidate) (bool, error) {
+	var actions []string
+	fired := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var ticket Ticket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ticket, candidate.ID).Error; err != nil {
+			return err
+		}
+		// An approval chain may have started since the candidates were picked
+		if ticket.ApprovalStatus == ApprovalPending {
+			return nil
+		}
+
+		entry := EscalationLog{RuleID: r.ID, TicketID: candidate.ID, Anchor: candidate.Anchor}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		fired = true
+
+		var err error
+		if actions, err = r.apply(tx, &ticket); err != nil {
+			return err
+		}
+		if r.NotifyUserID != nil {
+			actions = append(actions, fmt.Sprintf("user %d notified", *r.NotifyUserID))
+		}
+		return tx.Model(&entry).Update("actions", strings.Join(actions, "; ")).Error
+	})
+	if err != nil || !fired {
+		return false, err
+	}
+
+	ticket, err := GetTicketByID(candidate.ID)
+	if err != nil {
+		return true, err
+	}
+	log.Printf("Escalation: %s fired rule %q: %s", ticket.Reference(), r.Name, strings.Join(actions, "; "))
+	r.notify(ticket, actions)
+	return true, nil
+}
+
+// CheckEscalations evaluates every active rule and fires it on the tickets
+// that reached its threshold. Rules fire at most once per ticket and anchor,
+// so running the check repeatedly is safe.
+func CheckEscalations(now time.Time) error {
+	var rules []EscalationRule
+	if err := DB.Where("active = ?", true).Order("position, id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	var calendarIDs []uint
+	for _, rule := range rules {
+		if rule.CalendarID != nil {
+			calendarIDs = append(calendarIDs, *rule.CalendarID)
+		}
+	}
+	calendars, err := loadBusinessCalendars(DB, calendarIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		candidates, err := rule.candidates(now)
+		if err != nil {
+			return err
+		}
+
+		var calendar *BusinessCalendar
+		if rule.CalendarID != nil {
+			calendar = calendars[*rule.CalendarID]
+		}
+		threshold := time.Duration(rule.ThresholdMinutes) * time.Minute
+
+		for _, candidate := range candidates {
+			if calendar.BusinessDuration(candidate.Anchor, now) < threshold {
+				continue
+			}
+			if _, err := rule.fire(candidate); err != nil {
+				log.Printf("Escalation: rule %q failed on TCK-%d: %v", rule.Name, candidate.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addTicketWatcher adds a watcher to a ticket, reporting whether they were new
+func addTicketWatcher(tx *gorm.DB, ticketID, userID uint) (bool, error) {
+	result := tx.Exec("INSERT INTO ticket_watchers (ticket_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING", ticketID, userID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// AddTicketWatcher makes a user follow a ticket
+func AddTicketWatcher(ticketID, userID uint) error {
+	if _, err := GetUserByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+	_, err := addTicketWatcher(DB, ticketID, userID)
+	return err
+}
+
+// RemoveTicketWatcher stops a user following a ticket
+func RemoveTicketWatcher(ticketID, userID uint) error {
+	return DB.Exec("DELETE FROM ticket_watchers WHERE ticket_id = ? AND user_id = ?", ticketID, userID).Error
+}
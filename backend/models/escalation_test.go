@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEscalationSkipsTicketsAwaitingApproval(t *testing.T) {
+	useTestDB(t)
+	requester := createTestUser(t, "user")
+	raised := time.Now().Add(-2 * time.Hour)
+	waiting := createTestTicket(t, requester, func(ticket *Ticket) {
+		ticket.CreatedAt = raised
+		ticket.ApprovalStatus = ApprovalPending
+	})
+	approved := createTestTicket(t, requester, func(ticket *Ticket) {
+		ticket.CreatedAt = raised
+		ticket.ApprovalStatus = ApprovalApproved
+	})
+	plain := createTestTicket(t, requester, func(ticket *Ticket) {
+		ticket.CreatedAt = raised
+	})
+
+	rule := EscalationRule{
+		Name:             "Unassigned after 15 minutes",
+		Trigger:          EscalationTriggerUnassigned,
+		ThresholdMinutes: 15,
+		RaisePriority:    true,
+		Active:           true,
+	}
+	if err := DB.Create(&rule).Error; err != nil {
+		t.Fatalf("creating rule: %v", err)
+	}
+
+	candidates, err := rule.candidates(time.Now())
+	if err != nil {
+		t.Fatalf("candidates() error = %v", err)
+	}
+	found := map[uint]bool{}
+	for _, candidate := range candidates {
+		found[candidate.ID] = true
+	}
+	if found[waiting.ID] {
+		t.Error("ticket awaiting approval is a candidate")
+	}
+	if !found[approved.ID] || !found[plain.ID] {
+		t.Errorf("approved ticket found: %v, ticket without approval found: %v, want both", found[approved.ID], found[plain.ID])
+	}
+
+	// A ticket whose approval started after the candidates were picked is left alone
+	fired, err := rule.fire(escalationCandidate{ID: waiting.ID, Anchor: raised})
+	if err != nil {
+		t.Fatalf("fire() error = %v", err)
+	}
+	if fired {
+		t.Error("rule fired on a ticket awaiting approval")
+	}
+	unchanged, err := GetTicketByID(waiting.ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID() error = %v", err)
+	}
+	if unchanged.Priority != "P3" {
+		t.Errorf("Priority = %s, want P3", unchanged.Priority)
+	}
+}
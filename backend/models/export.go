@@ -0,0 +1,138 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportTime formats an optional timestamp for an export
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// exportFieldColumns lists the custom fields exported as columns, those of
+// the category or of every category, each key once
+func exportFieldColumns(entity, category string) ([]CustomField, error) {
+	fields, err := GetCustomFields(entity, category)
+	if err != nil {
+		return nil, err
+	}
+	var columns []CustomField
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if !seen[field.Key] {
+			seen[field.Key] = true
+			columns = append(columns, field)
+		}
+	}
+	return columns, nil
+}
+
+// appendCustomFields adds the custom field columns of a row
+func appendCustomFields(row []string, columns []CustomField, values JSONMap) []string {
+	for _, field := range columns {
+		row = append(row, customFieldText(values[field.Key]))
+	}
+	return row
+}
+
+// ExportTickets lays out the tickets matching the filter as CSV records, the
+// first being the header. Custom fields follow the built-in columns, named
+// "cf.<key>".
+func ExportTickets(filter TicketFilter) ([][]string, error) {
+	tickets, err := GetTickets(filter)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := exportFieldColumns(CustomFieldEntityTicket, filter.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []string{
+		"reference", "subject", "status", "priority", "category", "queue", "requester", "assignee",
+		"tags", "source", "request_type", "approval_status", "created_at", "first_responded_at", "resolved_at", "closed_at",
+		"close_reason", "merged_into", "expected_by",
+	}
+	for _, field := range columns {
+		header = append(header, "cf."+field.Key)
+	}
+
+	records := [][]string{header}
+	for i := range tickets {
+		ticket := &tickets[i]
+		queue, assignee, mergedInto := "", "", ""
+		if ticket.Queue != nil {
+			queue = ticket.Queue.Name
+		}
+		if ticket.Assignee != nil {
+			assignee = ticket.Assignee.Email
+		}
+		if ticket.MergedIntoID != nil {
+			mergedInto = (&Ticket{ID: *ticket.MergedIntoID}).Reference()
+		}
+		row := []string{
+			ticket.Reference(), ticket.Subject, ticket.Status, ticket.Priority, ticket.Category, queue,
+			ticket.Requester.Email, assignee, strings.Join(ticket.Tags, "; "), ticket.Source, ticket.RequestType, ticket.ApprovalStatus,
+			exportTime(&ticket.CreatedAt), exportTime(ticket.FirstRespondedAt), exportTime(ticket.ResolvedAt),
+			exportTime(ticket.ClosedAt), ticket.CloseReason, mergedInto, exportTime(ticket.ExpectedBy),
+		}
+		records = append(records, appendCustomFields(row, columns, ticket.CustomFields))
+	}
+	return records, nil
+}
+
+// ExportArticles lays out the knowledge articles of a category, or of all
+// categories, as CSV records the way ExportTickets does
+func ExportArticles(category, status string) ([][]string, error) {
+	var tasks []Task
+	query := DB.Preload("User").Order("category, id")
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	columns, err := exportFieldColumns(CustomFieldEntityArticle, category)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []string{"id", "title", "type", "category", "status", "rating", "keywords", "solved_count", "author", "created_at", "updated_at"}
+	for _, field := range columns {
+		header = append(header, "cf."+field.Key)
+	}
+
+	records := [][]string{header}
+	for i := range tasks {
+		task := &tasks[i]
+		row := []string{
+			strconv.FormatUint(uint64(task.ID), 10), task.Title, task.Type, task.Category, task.Status,
+			strconv.FormatFloat(task.Rating, 'f', -1, 64), strings.Join(task.Keywords, "; "),
+			strconv.Itoa(task.SolvedCount), task.User.Email, exportTime(&task.CreatedAt), exportTime(&task.UpdatedAt),
+		}
+		records = append(records, appendCustomFields(row, columns, task.CustomFields))
+	}
+	return records, nil
+}
+
+// ExportTimeReport lays out a time report as CSV records, the first being
+// the header
+func ExportTimeReport(group string, stats []TimeStat) [][]string {
+	records := [][]string{{group, "period", "entries", "minutes", "billable_minutes", "hours", "billable_hours"}}
+	for _, stat := range stats {
+		records = append(records, []string{
+			stat.Group, stat.Period.UTC().Format("2006-01-02"), strconv.FormatInt(stat.Entries, 10),
+			strconv.FormatInt(stat.Minutes, 10), strconv.FormatInt(stat.BillableMinutes, 10),
+			strconv.FormatFloat(stat.Hours, 'f', 2, 64), strconv.FormatFloat(stat.BillableHours, 'f', 2, 64),
+		})
+	}
+	return records
+}
@@ -0,0 +1,317 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Group represents a group of users provisioned from an external directory
+type Group struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	DisplayName string    `json:"display_name" gorm:"uniqueIndex;not null"`
+	ExternalID  string    `json:"external_id,omitempty" gorm:"index"`
+	Role        string    `json:"role,omitempty"` // Role granted to members, if any
+	Members     []User    `json:"members,omitempty" gorm:"many2many:group_members"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	ErrGroupExists   = errors.New("a group with this name already exists")
+)
+
+// GroupRoleFor returns the role granted by a group with the given name.
+// Only groups listed in SCIM_GROUP_ROLES ("Support Admins=admin,Staff=user")
+// grant a role; a group's name alone never does.
+func GroupRoleFor(displayName string) string {
+	for _, pair := range strings.Split(os.Getenv("SCIM_GROUP_ROLES"), ",") {
+		name, role, found := strings.Cut(pair, "=")
+		if found && strings.EqualFold(strings.TrimSpace(name), displayName) && ValidateRole(strings.TrimSpace(role)) {
+			return strings.TrimSpace(role)
+		}
+	}
+	return ""
+}
+
+// GetGroupByID retrieves a group with its members
+func GetGroupByID(id uint) (*Group, error) {
+	var group Group
+	if err := DB.Preload("Members").First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup creates a group with the given members
+func CreateGroup(displayName, externalID string, memberIDs []uint) (*Group, error) {
+	group := Group{
+		DisplayName: displayName,
+		ExternalID:  externalID,
+		Role:        GroupRoleFor(displayName),
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&Group{}).Where("display_name = ?", displayName).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrGroupExists
+		}
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		if err := setGroupMembers(tx, &group, memberIDs); err != nil {
+			return err
+		}
+		if group.Role == "" {
+			return nil
+		}
+		return syncGroupRoles(tx, memberIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetGroupByID(group.ID)
+}
+
+// GroupEdit changes a group inside the transaction of EditGroup
+type GroupEdit struct {
+	tx    *gorm.DB
+	group *Group
+}
+
+// EditGroup applies a series of changes to a group in one transaction, so
+// they are saved all together or not at all
+func EditGroup(id uint, edit func(*GroupEdit) error) (*Group, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var group Group
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Members").First(&group, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrGroupNotFound
+			}
+			return err
+		}
+		return edit(&GroupEdit{tx: tx, group: &group})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetGroupByID(id)
+}
+
+// ReplaceGroup overwrites a group's attributes and members
+func ReplaceGroup(id uint, displayName, externalID string, memberIDs []uint) (*Group, error) {
+	return EditGroup(id, func(edit *GroupEdit) error {
+		if err := edit.SetAttributes(displayName, externalID); err != nil {
+			return err
+		}
+		return edit.ReplaceMembers(memberIDs)
+	})
+}
+
+// Group returns the group with the changes made so far
+func (e *GroupEdit) Group() *Group {
+	return e.group
+}
+
+// AddMembers adds users to the group
+func (e *GroupEdit) AddMembers(userIDs []uint) error {
+	users, err := usersByIDs(e.tx, userIDs)
+	if err != nil {
+		return err
+	}
+	if err := e.tx.Model(e.group).Association("Members").Append(users); err != nil {
+		return err
+	}
+	if e.group.Role == "" {
+		return nil
+	}
+	return syncGroupRoles(e.tx, userIDs)
+}
+
+// RemoveMembers removes users from the group
+func (e *GroupEdit) RemoveMembers(userIDs []uint) error {
+	users, err := usersByIDs(e.tx, userIDs)
+	if err != nil {
+		return err
+	}
+	if err := e.tx.Model(e.group).Association("Members").Delete(users); err != nil {
+		return err
+	}
+	if e.group.Role == "" {
+		return nil
+	}
+	return syncGroupRoles(e.tx, userIDs)
+}
+
+// ReplaceMembers overwrites the members of the group
+func (e *GroupEdit) ReplaceMembers(userIDs []uint) error {
+	previous := memberIDsOf(e.group)
+	if err := setGroupMembers(e.tx, e.group, userIDs); err != nil {
+		return err
+	}
+	if e.group.Role == "" {
+		return nil
+	}
+	return syncGroupRoles(e.tx, append(previous, userIDs...))
+}
+
+// SetAttributes changes the group's name and external ID. The name decides
+// the role the group grants.
+func (e *GroupEdit) SetAttributes(displayName, externalID string) error {
+	if err := ensureGroupNameAvailable(e.tx, e.group.ID, displayName); err != nil {
+		return err
+	}
+	previousRole, role := e.group.Role, GroupRoleFor(displayName)
+	if err := e.tx.Model(e.group).Updates(map[string]interface{}{
+		"display_name": displayName,
+		"external_id":  externalID,
+		"role":         role,
+	}).Error; err != nil {
+		return err
+	}
+	e.group.DisplayName, e.group.ExternalID, e.group.Role = displayName, externalID, role
+	if previousRole == "" && role == "" {
+		return nil
+	}
+	return syncGroupRoles(e.tx, memberIDsOf(e.group))
+}
+
+// DeleteGroup deletes a group and recalculates its members' roles
+func DeleteGroup(id uint) error {
+	group, err := GetGroupByID(id)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		members := memberIDsOf(group)
+		if err := tx.Model(group).Association("Members").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Delete(group).Error; err != nil {
+			return err
+		}
+		if group.Role == "" {
+			return nil
+		}
+		return syncGroupRoles(tx, members)
+	})
+}
+
+// ensureGroupNameAvailable checks that no other group uses the name
+func ensureGroupNameAvailable(tx *gorm.DB, id uint, displayName string) error {
+	var existing int64
+	if err := tx.Model(&Group{}).Where("display_name = ? AND id <> ?", displayName, id).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrGroupExists
+	}
+	return nil
+}
+
+// setGroupMembers replaces the member list of a group
+func setGroupMembers(tx *gorm.DB, group *Group, memberIDs []uint) error {
+	users, err := usersByIDs(tx, memberIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Model(group).Association("Members").Replace(users)
+}
+
+// syncGroupRoles sets each user's role to the most privileged role granted
+// by their groups. It is only called after changes to role-granting groups,
+// so users that no longer belong to any of them fall back to "user".
+func syncGroupRoles(tx *gorm.DB, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	var users []User
+	if err := tx.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		var roles []string
+		if err := tx.Model(&Group{}).
+			Joins("JOIN group_members ON group_members.group_id = groups.id").
+			Where("group_members.user_id = ? AND groups.role <> ''", user.ID).
+			Pluck("groups.role", &roles).Error; err != nil {
+			return err
+		}
+
+		role := "user"
+		for _, candidate := range ValidRoles {
+			if containsString(roles, candidate) {
+				role = candidate
+				break
+			}
+		}
+
+		if user.Role != role {
+			if err := tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"role":          role,
+				"token_version": nextTokenVersion(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// usersByIDs loads users, failing if any of the IDs is unknown
+func usersByIDs(tx *gorm.DB, ids []uint) ([]User, error) {
+	if len(ids) == 0 {
+		return []User{}, nil
+	}
+	var users []User
+	if err := tx.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) != len(uniqueIDs(ids)) {
+		return nil, ErrUserNotFound
+	}
+	return users, nil
+}
+
+func memberIDsOf(group *Group) []uint {
+	ids := make([]uint, 0, len(group.Members))
+	for _, member := range group.Members {
+		ids = append(ids, member.ID)
+	}
+	return ids
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
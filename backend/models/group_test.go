@@ -0,0 +1,39 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEditGroupIsAllOrNothing(t *testing.T) {
+	useTestDB(t)
+	member := createTestUser(t, "user")
+	name := fmt.Sprintf("Field Staff %d", time.Now().UnixNano())
+	group, err := CreateGroup(name, "", nil)
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+
+	_, err = EditGroup(group.ID, func(edit *GroupEdit) error {
+		if err := edit.AddMembers([]uint{member.ID}); err != nil {
+			return err
+		}
+		if err := edit.SetAttributes(name+" (renamed)", "ext-1"); err != nil {
+			return err
+		}
+		return edit.RemoveMembers([]uint{member.ID + 1000000})
+	})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("EditGroup() error = %v, want ErrUserNotFound", err)
+	}
+
+	unchanged, err := GetGroupByID(group.ID)
+	if err != nil {
+		t.Fatalf("GetGroupByID() error = %v", err)
+	}
+	if unchanged.DisplayName != name || unchanged.ExternalID != "" || len(unchanged.Members) != 0 {
+		t.Errorf("group = %q %q with %d members, want it unchanged", unchanged.DisplayName, unchanged.ExternalID, len(unchanged.Members))
+	}
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ImpersonationSession represents an admin acting as another user
+type ImpersonationSession struct {
+	ID           uint                  `json:"id" gorm:"primaryKey"`
+	AdminID      uint                  `json:"admin_id"`
+	Admin        User                  `json:"admin" gorm:"foreignKey:AdminID"`
+	TargetUserID uint                  `json:"target_user_id"`
+	TargetUser   User                  `json:"target_user" gorm:"foreignKey:TargetUserID"`
+	Reason       string                `json:"reason"`
+	ExpiresAt    time.Time             `json:"expires_at"`
+	EndedAt      *time.Time            `json:"ended_at,omitempty"`
+	Actions      []ImpersonationAction `json:"actions,omitempty" gorm:"foreignKey:SessionID"`
+	CreatedAt    time.Time             `json:"created_at"`
+}
+
+// ImpersonationAction is a request made while impersonating
+type ImpersonationAction struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SessionID  uint      `json:"session_id" gorm:"index"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var (
+	ErrImpersonationNotFound   = errors.New("impersonation session not found")
+	ErrImpersonationNotAllowed = errors.New("this user cannot be impersonated")
+)
+
+// ImpersonationTTL returns how long an impersonation token is valid
+func ImpersonationTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("IMPERSONATION_TTL_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// IsActive reports whether the session can still be used
+func (s *ImpersonationSession) IsActive() bool {
+	return s.EndedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// StartImpersonation opens a time-boxed session for an admin to act as another user.
+// Admins and deactivated users cannot be impersonated.
+func StartImpersonation(adminID, targetUserID uint, reason string) (*ImpersonationSession, error) {
+	if adminID == targetUserID {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	target, err := GetUserByID(targetUserID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Role == "admin" || !target.Active {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	session := ImpersonationSession{
+		AdminID:      adminID,
+		TargetUserID: target.ID,
+		Reason:       reason,
+		ExpiresAt:    time.Now().Add(ImpersonationTTL()),
+	}
+	if err := DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return GetImpersonationSession(session.ID)
+}
+
+// GetImpersonationSession retrieves a session with the admin and target user
+func GetImpersonationSession(id uint) (*ImpersonationSession, error) {
+	var session ImpersonationSession
+	if err := DB.Preload("Admin").Preload("TargetUser").First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetImpersonationSessionWithActions retrieves a session and every request made in it
+func GetImpersonationSessionWithActions(id uint) (*ImpersonationSession, error) {
+	var session ImpersonationSession
+	err := DB.Preload("Admin").Preload("TargetUser").
+		Preload("Actions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		First(&session, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetImpersonationSessions lists sessions, optionally filtered by admin or target user
+func GetImpersonationSessions(adminID, targetUserID uint) ([]ImpersonationSession, error) {
+	var sessions []ImpersonationSession
+	query := DB.Preload("Admin").Preload("TargetUser").Order("created_at DESC")
+	if adminID != 0 {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if targetUserID != 0 {
+		query = query.Where("target_user_id = ?", targetUserID)
+	}
+	err := query.Find(&sessions).Error
+	return sessions, err
+}
+
+// EndImpersonation ends a session so its token stops working
+func EndImpersonation(id uint) error {
+	return DB.Model(&ImpersonationSession{}).
+		Where("id = ? AND ended_at IS NULL", id).
+		Update("ended_at", time.Now()).Error
+}
+
+// RecordImpersonationAction stores a request made during a session
+func RecordImpersonationAction(action ImpersonationAction) {
+	if err := DB.Create(&action).Error; err != nil {
+		log.Printf("Warning: Could not record impersonation action for session %d: %v", action.SessionID, err)
+	}
+}
@@ -0,0 +1,289 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation represents an invite sent by an admin to a new user
+type Invitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Email       string     `json:"email" gorm:"index;not null"`
+	Role        string     `json:"role" gorm:"not null;default:'user'"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	InvitedByID uint       `json:"invited_by_id"`
+	InvitedBy   User       `json:"invited_by" gorm:"foreignKey:InvitedByID"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	SentCount   int        `json:"sent_count"`
+	LastSentAt  *time.Time `json:"last_sent_at,omitempty"`
+	Status      string     `json:"status" gorm:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Invitation statuses, derived from the timestamps above
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationInvalid  = errors.New("invitation is no longer valid")
+	ErrInvitationExists   = errors.New("a pending invitation already exists for this email")
+	ErrEmailRegistered    = errors.New("email already registered")
+	ErrInvalidRole        = errors.New("invalid role")
+)
+
+// AfterFind fills in the derived status
+func (i *Invitation) AfterFind(tx *gorm.DB) error {
+	i.Status = i.currentStatus()
+	return nil
+}
+
+func (i *Invitation) currentStatus() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// invitationTTL returns how long an invitation link stays valid
+func invitationTTL() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("INVITATION_TTL_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+// newOpaqueToken returns a random token and the hash that is stored for it
+func newOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken hashes an opaque token so the plain value is never stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateInvitation creates an invitation and returns it with its plain token
+func CreateInvitation(email, role string, invitedByID uint) (*Invitation, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !ValidateRole(role) {
+		return nil, "", ErrInvalidRole
+	}
+
+	if _, err := GetUserByEmail(email); err == nil {
+		return nil, "", ErrEmailRegistered
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, "", err
+	}
+
+	var pending int64
+	if err := DB.Model(&Invitation{}).
+		Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, time.Now()).
+		Count(&pending).Error; err != nil {
+		return nil, "", err
+	}
+	if pending > 0 {
+		return nil, "", ErrInvitationExists
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	invitation := Invitation{
+		Email:       email,
+		Role:        role,
+		TokenHash:   hash,
+		ExpiresAt:   now.Add(invitationTTL()),
+		InvitedByID: invitedByID,
+		SentCount:   1,
+		LastSentAt:  &now,
+	}
+	if err := DB.Create(&invitation).Error; err != nil {
+		return nil, "", err
+	}
+
+	created, err := GetInvitationByID(invitation.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return created, token, nil
+}
+
+// GetInvitations lists invitations, optionally filtered by derived status
+func GetInvitations(status string) ([]Invitation, error) {
+	var invitations []Invitation
+	query := DB.Preload("InvitedBy").Order("created_at DESC")
+
+	now := time.Now()
+	switch status {
+	case InvitationPending:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case InvitationAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case InvitationRevoked:
+		query = query.Where("revoked_at IS NOT NULL AND accepted_at IS NULL")
+	case InvitationExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+
+	err := query.Find(&invitations).Error
+	return invitations, err
+}
+
+// GetInvitationByID retrieves a single invitation by ID
+func GetInvitationByID(id uint) (*Invitation, error) {
+	var invitation Invitation
+	if err := DB.Preload("InvitedBy").First(&invitation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetPendingInvitationByToken retrieves an invitation that can still be accepted
+func GetPendingInvitationByToken(token string) (*Invitation, error) {
+	var invitation Invitation
+	if err := DB.Where("token_hash = ?", hashToken(token)).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	if invitation.Status != InvitationPending {
+		return nil, ErrInvitationInvalid
+	}
+	return &invitation, nil
+}
+
+// ResendInvitation issues a fresh token and expiry for a pending or expired invitation
+func ResendInvitation(id uint) (*Invitation, string, error) {
+	invitation, err := GetInvitationByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if invitation.Status == InvitationAccepted || invitation.Status == InvitationRevoked {
+		return nil, "", ErrInvitationInvalid
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	if err := DB.Model(invitation).Updates(map[string]interface{}{
+		"token_hash":   hash,
+		"expires_at":   now.Add(invitationTTL()),
+		"sent_count":   gorm.Expr("sent_count + 1"),
+		"last_sent_at": now,
+	}).Error; err != nil {
+		return nil, "", err
+	}
+
+	updated, err := GetInvitationByID(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return updated, token, nil
+}
+
+// RevokeInvitation revokes an invitation that has not been accepted yet
+func RevokeInvitation(id uint) (*Invitation, error) {
+	invitation, err := GetInvitationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status == InvitationAccepted || invitation.Status == InvitationRevoked {
+		return nil, ErrInvitationInvalid
+	}
+
+	if err := DB.Model(invitation).Update("revoked_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return GetInvitationByID(id)
+}
+
+// AcceptInvitation creates the invited user with the chosen password
+func AcceptInvitation(token, password string) (*User, error) {
+	invitation, err := GetPendingInvitationByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Email:    invitation.Email,
+		Password: hashedPassword,
+		Role:     invitation.Role,
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&User{}).Where("email = ?", invitation.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrEmailRegistered
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		// Guard against the token being accepted twice concurrently, or
+		// revoked, resent or expiring since it was looked up
+		now := time.Now()
+		result := tx.Model(&Invitation{}).
+			Where("id = ? AND token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+				invitation.ID, invitation.TokenHash, now).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvitationInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
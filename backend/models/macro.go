@@ -0,0 +1,371 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Macro applies a reply and ticket field changes in one action. It is
+// scoped like a canned response: personal, shared with a queue or with
+// every agent. Empty fields leave the ticket unchanged.
+type Macro struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	OwnerID         *uint          `json:"owner_id"`
+	QueueID         *uint          `json:"queue_id"`
+	ReplyBody       string         `json:"reply_body" gorm:"type:text"`
+	ReplyVisibility string         `json:"reply_visibility"`
+	ArticleID       *uint          `json:"article_id"` // Used by the article placeholders
+	Article         *Task          `json:"article,omitempty" gorm:"foreignKey:ArticleID"`
+	Status          string         `json:"status"`
+	Priority        string         `json:"priority"`
+	AddTags         pq.StringArray `json:"add_tags" gorm:"type:text[]"`
+	RemoveTags      pq.StringArray `json:"remove_tags" gorm:"type:text[]"`
+	AssigneeID      *uint          `json:"assignee_id"`
+	AssignToSelf    bool           `json:"assign_to_self"` // Assign the ticket to the agent applying the macro
+	UsageCount      int64          `json:"usage_count"`
+	LastUsedAt      *time.Time     `json:"last_used_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// MacroRequest is used for creating/updating macros. Without a queue the
+// macro is personal unless Shared is set.
+type MacroRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Description     string   `json:"description"`
+	QueueID         *uint    `json:"queue_id"`
+	Shared          bool     `json:"shared"` // Shared with every agent, admins only
+	ReplyBody       string   `json:"reply_body"`
+	ReplyVisibility string   `json:"reply_visibility"`
+	ArticleID       *uint    `json:"article_id"`
+	Status          string   `json:"status"`
+	Priority        string   `json:"priority"`
+	AddTags         []string `json:"add_tags"`
+	RemoveTags      []string `json:"remove_tags"`
+	AssigneeID      *uint    `json:"assignee_id"`
+	AssignToSelf    bool     `json:"assign_to_self"`
+}
+
+// MacroUsage records a macro being applied to a ticket
+type MacroUsage struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MacroID   uint      `json:"macro_id"`
+	TicketID  uint      `json:"ticket_id"`
+	UserID    uint      `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MacroUsageStat summarises how often a macro was applied
+type MacroUsageStat struct {
+	MacroID    uint       `json:"macro_id"`
+	Name       string     `json:"name"`
+	Uses       int64      `json:"uses"`
+	Agents     int64      `json:"agents"`
+	Tickets    int64      `json:"tickets"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+var (
+	ErrMacroNotFound = errors.New("macro not found")
+	ErrMacroEmpty    = errors.New("a macro needs a reply or a field change")
+)
+
+// normalizeTags lowercases and trims tags and drops empty and repeated ones
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !containsString(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// validateMacro checks the reply and field changes of a macro request
+func validateMacro(req *MacroRequest) error {
+	req.AddTags = normalizeTags(req.AddTags)
+	req.RemoveTags = normalizeTags(req.RemoveTags)
+	if req.ReplyVisibility == "" {
+		req.ReplyVisibility = VisibilityPublic
+	}
+
+	if strings.TrimSpace(req.ReplyBody) == "" && req.Status == "" && req.Priority == "" &&
+		len(req.AddTags) == 0 && len(req.RemoveTags) == 0 && req.AssigneeID == nil && !req.AssignToSelf {
+		return ErrMacroEmpty
+	}
+	if err := validateTemplate(req.ReplyBody, req.ArticleID); err != nil {
+		return err
+	}
+	if !containsString(ValidVisibilities, req.ReplyVisibility) {
+		return ErrInvalidVisibility
+	}
+	if req.Status != "" && !containsString(ValidTicketStatuses, req.Status) {
+		return ErrInvalidTicketStatus
+	}
+	if req.Priority != "" && !containsString(ValidTicketPriorities, req.Priority) {
+		return ErrInvalidPriority
+	}
+	if req.AssigneeID != nil {
+		assignee, err := GetUserByID(*req.AssigneeID)
+		if err != nil || !assignee.IsAgent() || !assignee.Active {
+			return ErrInvalidAssignee
+		}
+	}
+	return nil
+}
+
+// GetMacros lists the macros the agent may use, optionally only those shared with a queue
+func GetMacros(user *User, queueID uint) ([]Macro, error) {
+	var macros []Macro
+	query := usableBy(DB.Preload("Article"), user)
+	if queueID != 0 {
+		query = query.Where("queue_id = ?", queueID)
+	}
+	err := query.Order("name").Find(&macros).Error
+	return macros, err
+}
+
+// GetMacro retrieves a macro the agent may use
+func GetMacro(id uint, user *User) (*Macro, error) {
+	var macro Macro
+	if err := usableBy(DB.Preload("Article"), user).First(&macro, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMacroNotFound
+		}
+		return nil, err
+	}
+	return &macro, nil
+}
+
+// CreateMacro creates a macro for the agent
+func CreateMacro(req MacroRequest, user *User) (*Macro, error) {
+	if err := validateMacro(&req); err != nil {
+		return nil, err
+	}
+	ownerID, queueID, err := scopeFor(user, req.QueueID, req.Shared)
+	if err != nil {
+		return nil, err
+	}
+
+	macro := Macro{
+		Name:            req.Name,
+		Description:     req.Description,
+		OwnerID:         ownerID,
+		QueueID:         queueID,
+		ReplyBody:       req.ReplyBody,
+		ReplyVisibility: req.ReplyVisibility,
+		ArticleID:       req.ArticleID,
+		Status:          req.Status,
+		Priority:        req.Priority,
+		AddTags:         req.AddTags,
+		RemoveTags:      req.RemoveTags,
+		AssigneeID:      req.AssigneeID,
+		AssignToSelf:    req.AssignToSelf,
+	}
+	if err := DB.Create(&macro).Error; err != nil {
+		return nil, err
+	}
+	return GetMacro(macro.ID, user)
+}
+
+// UpdateMacro updates a macro the agent may manage
+func UpdateMacro(id uint, req MacroRequest, user *User) (*Macro, error) {
+	macro, err := manageableMacro(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMacro(&req); err != nil {
+		return nil, err
+	}
+	ownerID, queueID, err := scopeFor(user, req.QueueID, req.Shared)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DB.Model(macro).Updates(map[string]interface{}{
+		"name":             req.Name,
+		"description":      req.Description,
+		"owner_id":         ownerID,
+		"queue_id":         queueID,
+		"reply_body":       req.ReplyBody,
+		"reply_visibility": req.ReplyVisibility,
+		"article_id":       req.ArticleID,
+		"status":           req.Status,
+		"priority":         req.Priority,
+		"add_tags":         pq.StringArray(req.AddTags),
+		"remove_tags":      pq.StringArray(req.RemoveTags),
+		"assignee_id":      req.AssigneeID,
+		"assign_to_self":   req.AssignToSelf,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetMacro(id, user)
+}
+
+// DeleteMacro deletes a macro the agent may manage. Its usage history goes with it.
+func DeleteMacro(id uint, user *User) error {
+	macro, err := manageableMacro(id, user)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("macro_id = ?", id).Delete(&MacroUsage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(macro).Error
+	})
+}
+
+// manageableMacro loads a macro the agent may change
+func manageableMacro(id uint, user *User) (*Macro, error) {
+	macro, err := GetMacro(id, user)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := canManageScoped(user, macro.OwnerID, macro.QueueID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrSharingNotAllowed
+	}
+	return macro, nil
+}
+
+// ApplyMacro applies a macro to a ticket on behalf of the agent: the field
+// changes first, then the reply and finally the status, so a macro that
+// closes a ticket can still answer it. The reply and the status change run
+// in their own transactions, so the reasons they refuse a ticket (merged,
+// closed, awaiting approval, a disallowed transition) are checked before
+// the ticket is touched. Only a concurrent change to the ticket can still
+// leave the macro partly applied.
+func ApplyMacro(ticketID, macroID uint, agent *User) (*Ticket, error) {
+	macro, err := GetMacro(macroID, agent)
+	if err != nil {
+		return nil, err
+	}
+	ticket, err := GetTicketByID(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	// Requests awaiting sign-off are left alone, like AssignTicket does
+	if ticket.ApprovalStatus == ApprovalPending {
+		return nil, ErrAwaitingApproval
+	}
+	if ticket.MergedIntoID != nil {
+		return nil, ErrTicketMerged
+	}
+
+	changeStatus := macro.Status != "" && macro.Status != ticket.Status
+	if changeStatus && !ticket.CanTransition(macro.Status) {
+		return nil, ErrInvalidTransition
+	}
+	reply := strings.TrimSpace(macro.ReplyBody) != ""
+	if reply && ticket.Status == TicketStatusClosed {
+		return nil, ErrTicketClosed
+	}
+
+	assigneeID := macro.AssigneeID
+	if macro.AssignToSelf {
+		assigneeID = &agent.ID
+	}
+	if assigneeID != nil {
+		assignee, err := GetUserByID(*assigneeID)
+		if err != nil || !assignee.IsAgent() || !assignee.Active {
+			return nil, ErrInvalidAssignee
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if macro.Priority != "" {
+		updates["priority"] = macro.Priority
+	}
+	if len(macro.AddTags) > 0 || len(macro.RemoveTags) > 0 {
+		tags := []string{}
+		for _, tag := range ticket.Tags {
+			if !containsString(macro.RemoveTags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		updates["tags"] = pq.StringArray(normalizeTags(append(tags, macro.AddTags...)))
+	}
+	if assigneeID != nil {
+		updates["assignee_id"] = *assigneeID
+		// Picking up a new ticket opens it
+		if ticket.Status == TicketStatusNew && !changeStatus {
+			updates["status"] = TicketStatusOpen
+		}
+	}
+
+	now := time.Now()
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&MacroUsage{MacroID: macro.ID, TicketID: ticketID, UserID: agent.ID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(macro).UpdateColumns(map[string]interface{}{
+			"usage_count":  gorm.Expr("usage_count + 1"),
+			"last_used_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, ticketID, now)
+	}); err != nil {
+		return nil, err
+	}
+
+	if reply {
+		if _, err := AddTicketMessage(ticketID, agent, TicketMessageInput{
+			Body:       renderTemplate(macro.ReplyBody, ticket, agent, macro.Article),
+			Visibility: macro.ReplyVisibility,
+			Source:     SourceWeb,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if changeStatus {
+		return ChangeTicketStatus(ticketID, TicketStatusChange{Status: macro.Status}, agent)
+	}
+	return GetTicketByID(ticketID)
+}
+
+// SetTicketTags replaces the tags of a ticket
+func SetTicketTags(id uint, tags []string) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := DB.Model(ticket).Update("tags", pq.StringArray(normalizeTags(tags))).Error; err != nil {
+		return nil, err
+	}
+	return GetTicketByID(id)
+}
+
+// GetMacroUsage reports how often each macro was applied since the given
+// time, most used first
+func GetMacroUsage(since time.Time) ([]MacroUsageStat, error) {
+	var stats []MacroUsageStat
+	err := DB.Table("macro_usages u").
+		Select(`u.macro_id, m.name,
+			COUNT(*) AS uses,
+			COUNT(DISTINCT u.user_id) AS agents,
+			COUNT(DISTINCT u.ticket_id) AS tickets,
+			MAX(u.created_at) AS last_used_at`).
+		Joins("JOIN macros m ON m.id = u.macro_id").
+		Where("u.created_at >= ?", since).
+		Group("u.macro_id, m.name").
+		Order("uses DESC, m.name").
+		Scan(&stats).Error
+	return stats, err
+}
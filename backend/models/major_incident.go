@@ -0,0 +1,432 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+)
+
+// IncidentUpdate is an entry on the timeline of a major incident, from its
+// declaration through status updates to its resolution
+type IncidentUpdate struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TicketID   uint      `json:"ticket_id"`
+	AuthorID   uint      `json:"author_id"`
+	Author     User      `json:"author" gorm:"foreignKey:AuthorID"`
+	Kind       string    `json:"kind"`
+	Body       string    `json:"body"`
+	Broadcast  bool      `json:"broadcast"` // Sent to the requesters of the child tickets
+	Recipients int       `json:"recipients"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MajorIncidentRequest declares a ticket a major incident
+type MajorIncidentRequest struct {
+	Summary string `json:"summary" binding:"max=10000"` // Opens the timeline
+}
+
+// IncidentLinkRequest lists the tickets to link as children of a major incident
+type IncidentLinkRequest struct {
+	TicketIDs []uint `json:"ticket_ids" binding:"required,min=1"`
+}
+
+// IncidentUpdateRequest posts an update to the timeline of a major incident
+type IncidentUpdateRequest struct {
+	Body      string `json:"body" binding:"required,max=10000"`
+	Broadcast bool   `json:"broadcast"` // Also tell the requesters of the open child tickets
+}
+
+// IncidentResolveRequest resolves a major incident with its children
+type IncidentResolveRequest struct {
+	Resolution string `json:"resolution" binding:"required,max=10000"` // Shared with every child requester
+}
+
+// Timeline entry kinds
+const (
+	IncidentDeclared = "declared"
+	IncidentLinked   = "linked"
+	IncidentUnlinked = "unlinked"
+	IncidentUpdated  = "update"
+	IncidentResolved = "resolved"
+)
+
+var (
+	ErrNotMajorIncident     = errors.New("ticket is not a major incident")
+	ErrAlreadyMajorIncident = errors.New("ticket is already a major incident")
+	ErrIncidentChild        = errors.New("ticket is linked to a major incident")
+	ErrLinkToSelf           = errors.New("a major incident cannot be its own child")
+	ErrNotIncidentChild     = errors.New("ticket is not a child of this major incident")
+)
+
+// envAddresses returns the comma-separated email addresses of an environment variable
+func envAddresses(name string) []string {
+	var addresses []string
+	for _, address := range strings.Split(os.Getenv(name), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// majorIncident loads a ticket that has been declared a major incident
+func majorIncident(id uint) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ticket.MajorIncident {
+		return nil, ErrNotMajorIncident
+	}
+	return ticket, nil
+}
+
+// addIncidentUpdate adds an entry to the timeline of a major incident
+func addIncidentUpdate(tx *gorm.DB, ticketID uint, author *User, kind, body string) (*IncidentUpdate, error) {
+	update := IncidentUpdate{
+		TicketID: ticketID,
+		AuthorID: author.ID,
+		Kind:     kind,
+		Body:     body,
+	}
+	if err := tx.Create(&update).Error; err != nil {
+		return nil, err
+	}
+	update.Author = *author
+	return &update, nil
+}
+
+// GetMajorIncidents lists the open major incidents, newest first
+func GetMajorIncidents() ([]Ticket, error) {
+	return GetTickets(TicketFilter{
+		MajorIncident: true,
+		Status:        strings.Join([]string{TicketStatusNew, TicketStatusOpen, TicketStatusPending}, ","),
+	})
+}
+
+// GetIncidentChildren lists the tickets linked to a major incident
+func GetIncidentChildren(id uint) ([]Ticket, error) {
+	if _, err := majorIncident(id); err != nil {
+		return nil, err
+	}
+	return GetTickets(TicketFilter{ParentID: id})
+}
+
+// GetIncidentTimeline lists the timeline of a major incident, oldest first
+func GetIncidentTimeline(id uint) ([]IncidentUpdate, error) {
+	if _, err := majorIncident(id); err != nil {
+		return nil, err
+	}
+	var updates []IncidentUpdate
+	err := DB.Preload("Author").Where("ticket_id = ?", id).Order("created_at, id").Find(&updates).Error
+	return updates, err
+}
+
+// DeclareMajorIncident makes an open ticket a major incident at the highest
+// priority and starts its timeline. The addresses in MAJOR_INCIDENT_EMAIL are
+// told about it.
+func DeclareMajorIncident(id uint, req MajorIncidentRequest, actor *User) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ticket.MajorIncident:
+		return nil, ErrAlreadyMajorIncident
+	case ticket.ParentID != nil:
+		return nil, ErrIncidentChild
+	case ticket.MergedIntoID != nil:
+		return nil, ErrTicketMerged
+	case !ticket.IsOpen():
+		return nil, ErrTicketClosed
+	}
+
+	summary := strings.TrimSpace(req.Summary)
+	if summary == "" {
+		summary = fmt.Sprintf("%s declared a major incident.", displayName(actor))
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(ticket).Updates(map[string]interface{}{
+			"major_incident": true,
+			"priority":       TicketPriorityCritical,
+		}).Error; err != nil {
+			return err
+		}
+		if _, err := addIncidentUpdate(tx, id, actor, IncidentDeclared, summary); err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, id, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+
+	subject := fmt.Sprintf("[%s] Major incident declared: %s", ticket.Reference(), ticket.Subject)
+	body := fmt.Sprintf("%s declared %s \"%s\" a major incident.\n\n%s\n\n%s",
+		displayName(actor), ticket.Reference(), ticket.Subject, summary, mailer.Link(fmt.Sprintf("/tickets/%d", id)))
+	for _, to := range envAddresses("MAJOR_INCIDENT_EMAIL") {
+		if err := mailer.Send(to, subject, body); err != nil {
+			log.Printf("Warning: Could not announce major incident %s to %s: %v", ticket.Reference(), to, err)
+		}
+	}
+	return GetTicketByID(id)
+}
+
+// LinkIncidentChildren links open tickets reporting the same outage to a
+// major incident. Tickets already linked to it are left as they are.
+func LinkIncidentChildren(id uint, req IncidentLinkRequest, actor *User) ([]Ticket, error) {
+	parent, err := majorIncident(id)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.IsOpen() {
+		return nil, ErrTicketClosed
+	}
+
+	var children []*Ticket
+	for _, childID := range uniqueIDs(req.TicketIDs) {
+		if childID == id {
+			return nil, ErrLinkToSelf
+		}
+		child, err := GetTicketByID(childID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case child.ParentID != nil && *child.ParentID == id:
+			continue
+		case child.ParentID != nil:
+			return nil, fmt.Errorf("%s: %w", child.Reference(), ErrIncidentChild)
+		case child.MajorIncident:
+			return nil, fmt.Errorf("%s: %w", child.Reference(), ErrAlreadyMajorIncident)
+		case child.MergedIntoID != nil:
+			return nil, fmt.Errorf("%s: %w", child.Reference(), ErrTicketMerged)
+		case !child.IsOpen():
+			return nil, fmt.Errorf("%s: %w", child.Reference(), ErrTicketClosed)
+		}
+		children = append(children, child)
+	}
+
+	if len(children) > 0 {
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			references := make([]string, 0, len(children))
+			for _, child := range children {
+				// A concurrent link to another incident loses
+				result := tx.Model(&Ticket{}).Where("id = ? AND parent_id IS NULL", child.ID).Update("parent_id", id)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return fmt.Errorf("%s: %w", child.Reference(), ErrIncidentChild)
+				}
+				note := TicketMessage{
+					TicketID:   child.ID,
+					AuthorID:   actor.ID,
+					Body:       fmt.Sprintf("%s linked this ticket to major incident %s.", displayName(actor), parent.Reference()),
+					Visibility: VisibilityInternal,
+					Source:     SourceWeb,
+				}
+				if err := tx.Create(&note).Error; err != nil {
+					return err
+				}
+				references = append(references, child.Reference())
+			}
+			_, err := addIncidentUpdate(tx, id, actor, IncidentLinked,
+				fmt.Sprintf("%s linked %s.", displayName(actor), strings.Join(references, ", ")))
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return GetTickets(TicketFilter{ParentID: id})
+}
+
+// UnlinkIncidentChild detaches a ticket from a major incident
+func UnlinkIncidentChild(id, childID uint, actor *User) error {
+	parent, err := majorIncident(id)
+	if err != nil {
+		return err
+	}
+	child, err := GetTicketByID(childID)
+	if err != nil {
+		return err
+	}
+	if child.ParentID == nil || *child.ParentID != id {
+		return ErrNotIncidentChild
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(child).Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+		note := TicketMessage{
+			TicketID:   child.ID,
+			AuthorID:   actor.ID,
+			Body:       fmt.Sprintf("%s unlinked this ticket from major incident %s.", displayName(actor), parent.Reference()),
+			Visibility: VisibilityInternal,
+			Source:     SourceWeb,
+		}
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		_, err := addIncidentUpdate(tx, id, actor, IncidentUnlinked,
+			fmt.Sprintf("%s unlinked %s.", displayName(actor), child.Reference()))
+		return err
+	})
+}
+
+// openChildren returns the open child tickets of a major incident
+func openChildren(id uint) ([]Ticket, error) {
+	return GetTickets(TicketFilter{
+		ParentID: id,
+		Status:   strings.Join([]string{TicketStatusNew, TicketStatusOpen, TicketStatusPending}, ","),
+	})
+}
+
+// broadcastRecipients maps every requester and CC of the child tickets to
+// the first of their tickets, so each person is told once
+func broadcastRecipients(children []Ticket) map[string]*Ticket {
+	recipients := map[string]*Ticket{}
+	for i := range children {
+		child := &children[i]
+		addresses := []string{child.Requester.Email}
+		for _, cc := range child.CCs {
+			addresses = append(addresses, cc.Email)
+		}
+		for _, address := range addresses {
+			if _, ok := recipients[address]; !ok {
+				recipients[address] = child
+			}
+		}
+	}
+	return recipients
+}
+
+// postToChildren adds a public message to each child ticket without the
+// usual per-ticket notification; broadcastUpdate tells the requesters once
+func postToChildren(tx *gorm.DB, children []Ticket, author *User, body string) error {
+	for _, child := range children {
+		message := TicketMessage{
+			TicketID:   child.ID,
+			AuthorID:   author.ID,
+			Body:       body,
+			Visibility: VisibilityPublic,
+			Source:     SourceWeb,
+		}
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcastUpdate mails an update of a major incident to each recipient once,
+// threaded onto one of their own tickets
+func broadcastUpdate(parent *Ticket, recipients map[string]*Ticket, heading, body string) {
+	for to, child := range recipients {
+		subject := fmt.Sprintf("[%s] %s: %s", child.Reference(), heading, parent.Subject)
+		text := fmt.Sprintf("Your ticket %s is part of an ongoing service issue we are working on.\n\n%s\n\nView your ticket: %s",
+			child.Reference(), body, mailer.Link(fmt.Sprintf("/tickets/%d", child.ID)))
+		if err := mailer.Send(to, subject, text); err != nil {
+			log.Printf("Warning: Could not send major incident %s update to %s: %v", parent.Reference(), to, err)
+		}
+	}
+}
+
+// PostIncidentUpdate adds an update to the timeline of a major incident.
+// Broadcast updates are also posted on the open child tickets and mailed
+// once to each of their requesters.
+func PostIncidentUpdate(id uint, req IncidentUpdateRequest, actor *User) (*IncidentUpdate, error) {
+	parent, err := majorIncident(id)
+	if err != nil {
+		return nil, err
+	}
+	if !parent.IsOpen() {
+		return nil, ErrTicketClosed
+	}
+
+	var children []Ticket
+	var recipients map[string]*Ticket
+	if req.Broadcast {
+		if children, err = openChildren(id); err != nil {
+			return nil, err
+		}
+		recipients = broadcastRecipients(children)
+	}
+
+	var update *IncidentUpdate
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if update, err = addIncidentUpdate(tx, id, actor, IncidentUpdated, req.Body); err != nil {
+			return err
+		}
+		if !req.Broadcast {
+			return nil
+		}
+		update.Broadcast = true
+		update.Recipients = len(recipients)
+		if err := tx.Model(update).Updates(map[string]interface{}{
+			"broadcast":  true,
+			"recipients": update.Recipients,
+		}).Error; err != nil {
+			return err
+		}
+		return postToChildren(tx, children, actor, req.Body)
+	}); err != nil {
+		return nil, err
+	}
+
+	if req.Broadcast {
+		broadcastUpdate(parent, recipients, "Service update", req.Body)
+	}
+	return update, nil
+}
+
+// ResolveMajorIncident resolves a major incident and then each of its open
+// children, sharing the resolution note with their requesters. Children
+// that cannot be resolved, such as requests awaiting approval, stay open
+// and are logged.
+func ResolveMajorIncident(id uint, req IncidentResolveRequest, actor *User) (*Ticket, error) {
+	parent, err := majorIncident(id)
+	if err != nil {
+		return nil, err
+	}
+	children, err := openChildren(id)
+	if err != nil {
+		return nil, err
+	}
+	recipients := broadcastRecipients(children)
+
+	if _, err := ChangeTicketStatus(id, TicketStatusChange{Status: TicketStatusResolved}, actor); err != nil {
+		return nil, err
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		update, err := addIncidentUpdate(tx, id, actor, IncidentResolved, req.Resolution)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(update).Updates(map[string]interface{}{
+			"broadcast":  true,
+			"recipients": len(recipients),
+		}).Error; err != nil {
+			return err
+		}
+		return postToChildren(tx, children, actor, req.Resolution)
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, child := range children {
+		if _, err := ChangeTicketStatus(child.ID, TicketStatusChange{Status: TicketStatusResolved}, actor); err != nil {
+			log.Printf("Warning: Could not resolve %s with major incident %s: %v", child.Reference(), parent.Reference(), err)
+		}
+	}
+	broadcastUpdate(parent, recipients, "Resolved", req.Resolution)
+	return GetTicketByID(id)
+}
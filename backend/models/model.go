@@ -35,4 +35,4 @@ func InitDB() {
 	}
 
 	log.Println("Database initialization completed")
-}
\ No newline at end of file
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Problem is the underlying cause of recurring incidents. Once its root
+// cause is known and a workaround documented it is a known error.
+type Problem struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description"`
+	Category      string     `json:"category"`
+	Status        string     `json:"status"`
+	RootCause     string     `json:"root_cause"`
+	Workaround    string     `json:"workaround"`
+	ArticleID     *uint      `json:"article_id"` // Issue article documenting the problem
+	Article       *Task      `json:"article,omitempty" gorm:"foreignKey:ArticleID"`
+	OwnerID       *uint      `json:"owner_id"`
+	Owner         *User      `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
+	KnownErrorAt  *time.Time `json:"known_error_at"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	IncidentCount int64      `json:"incident_count" gorm:"->"`      // Tickets attributed to the problem
+	Similarity    float64    `json:"similarity,omitempty" gorm:"-"` // Set when matched against a ticket
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ProblemRequest is used for creating/updating problem records
+type ProblemRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	Category    string `json:"category" binding:"required"`
+	RootCause   string `json:"root_cause"`
+	Workaround  string `json:"workaround"`
+	ArticleID   *uint  `json:"article_id"`
+	OwnerID     *uint  `json:"owner_id"` // Defaults to the agent recording the problem
+}
+
+// ProblemStatusChange moves a problem to a new status
+type ProblemStatusChange struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// ProblemLinkRequest lists the tickets to attribute to a problem
+type ProblemLinkRequest struct {
+	TicketIDs []uint `json:"ticket_ids" binding:"required,min=1"`
+}
+
+// WorkaroundRequest applies the workaround of a known error to a ticket
+type WorkaroundRequest struct {
+	Visibility string `json:"visibility"` // Defaults to public, a reply to the requester
+}
+
+// Problem statuses
+const (
+	ProblemStatusInvestigation = "investigation"
+	ProblemStatusKnownError    = "known_error"
+	ProblemStatusResolved      = "resolved"
+)
+
+var (
+	ValidProblemStatuses = []string{ProblemStatusInvestigation, ProblemStatusKnownError, ProblemStatusResolved}
+
+	// problemTransitions lists the statuses a problem may move to from each
+	// status. A resolved problem is reopened when it recurs.
+	problemTransitions = map[string][]string{
+		ProblemStatusInvestigation: {ProblemStatusKnownError, ProblemStatusResolved},
+		ProblemStatusKnownError:    {ProblemStatusInvestigation, ProblemStatusResolved},
+		ProblemStatusResolved:      {ProblemStatusInvestigation},
+	}
+)
+
+// maxKnownErrorMatches bounds the known errors suggested for a ticket
+const maxKnownErrorMatches = 5
+
+var (
+	ErrProblemNotFound      = errors.New("problem not found")
+	ErrInvalidProblemStatus = errors.New("invalid problem status")
+	ErrWorkaroundRequired   = errors.New("a known error needs a root cause and a workaround")
+	ErrNotKnownError        = errors.New("problem is not a known error")
+	ErrArticleNotIssue      = errors.New("the documenting article must be of type Issue")
+	ErrInvalidOwner         = errors.New("owner must be an active agent")
+)
+
+// problemQuery selects problems with their incident counts
+func problemQuery() *gorm.DB {
+	return DB.Model(&Problem{}).Preload("Owner").Preload("Article").
+		Select("problems.*, (SELECT COUNT(*) FROM tickets WHERE tickets.problem_id = problems.id AND tickets.deleted_at IS NULL) AS incident_count")
+}
+
+// GetProblems lists problems, most recently changed first, optionally by
+// status and category and matching a search text
+func GetProblems(status, category, search string) ([]Problem, error) {
+	var problems []Problem
+	query := problemQuery().Order("updated_at DESC")
+	if status != "" {
+		query = query.Where("status IN ?", strings.Split(status, ","))
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ? OR root_cause ILIKE ? OR workaround ILIKE ?)",
+			pattern, pattern, pattern, pattern)
+	}
+	err := query.Find(&problems).Error
+	return problems, err
+}
+
+// GetProblemByID retrieves a problem record
+func GetProblemByID(id uint) (*Problem, error) {
+	var problem Problem
+	if err := problemQuery().First(&problem, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProblemNotFound
+		}
+		return nil, err
+	}
+	return &problem, nil
+}
+
+// validateProblem checks the category, documenting article and owner of a problem
+func validateProblem(req *ProblemRequest) error {
+	if !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	if req.ArticleID != nil {
+		var article Task
+		if err := DB.First(&article, *req.ArticleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrArticleNotFound
+			}
+			return err
+		}
+		if article.Type != TaskTypeIssue {
+			return ErrArticleNotIssue
+		}
+	}
+	if req.OwnerID != nil {
+		owner, err := GetUserByID(*req.OwnerID)
+		if err != nil || !owner.IsAgent() || !owner.Active {
+			return ErrInvalidOwner
+		}
+	}
+	req.RootCause = strings.TrimSpace(req.RootCause)
+	req.Workaround = strings.TrimSpace(req.Workaround)
+	return nil
+}
+
+// CreateProblem records a problem under investigation
+func CreateProblem(req ProblemRequest, creator *User) (*Problem, error) {
+	if req.OwnerID == nil {
+		req.OwnerID = &creator.ID
+	}
+	if err := validateProblem(&req); err != nil {
+		return nil, err
+	}
+
+	problem := Problem{
+		Title:       req.Title,
+		Description: req.Description,
+		Category:    req.Category,
+		Status:      ProblemStatusInvestigation,
+		RootCause:   req.RootCause,
+		Workaround:  req.Workaround,
+		ArticleID:   req.ArticleID,
+		OwnerID:     req.OwnerID,
+	}
+	if err := DB.Create(&problem).Error; err != nil {
+		return nil, err
+	}
+	return GetProblemByID(problem.ID)
+}
+
+// UpdateProblem updates the details of a problem. A known error keeps
+// needing its root cause and workaround.
+func UpdateProblem(id uint, req ProblemRequest) (*Problem, error) {
+	problem, err := GetProblemByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProblem(&req); err != nil {
+		return nil, err
+	}
+	if problem.Status == ProblemStatusKnownError && (req.RootCause == "" || req.Workaround == "") {
+		return nil, ErrWorkaroundRequired
+	}
+
+	if err := DB.Model(&Problem{ID: id}).Updates(map[string]interface{}{
+		"title":       req.Title,
+		"description": req.Description,
+		"category":    req.Category,
+		"root_cause":  req.RootCause,
+		"workaround":  req.Workaround,
+		"article_id":  req.ArticleID,
+		"owner_id":    req.OwnerID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return GetProblemByID(id)
+}
+
+// ChangeProblemStatus moves a problem through investigation, known error and
+// resolved. Becoming a known error needs the root cause and workaround.
+func ChangeProblemStatus(id uint, change ProblemStatusChange) (*Problem, error) {
+	if !containsString(ValidProblemStatuses, change.Status) {
+		return nil, ErrInvalidProblemStatus
+	}
+	problem, err := GetProblemByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(problemTransitions[problem.Status], change.Status) {
+		return nil, ErrInvalidTransition
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": change.Status}
+	switch change.Status {
+	case ProblemStatusKnownError:
+		if problem.RootCause == "" || problem.Workaround == "" {
+			return nil, ErrWorkaroundRequired
+		}
+		updates["known_error_at"] = now
+		updates["resolved_at"] = nil
+	case ProblemStatusResolved:
+		updates["resolved_at"] = now
+	case ProblemStatusInvestigation:
+		updates["known_error_at"] = nil
+		updates["resolved_at"] = nil
+	}
+
+	if err := DB.Model(&Problem{ID: id}).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetProblemByID(id)
+}
+
+// DeleteProblem removes a problem record. Its tickets are no longer
+// attributed to it.
+func DeleteProblem(id uint) error {
+	if _, err := GetProblemByID(id); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Ticket{}).Where("problem_id = ?", id).Update("problem_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Problem{}, id).Error
+	})
+}
+
+// GetProblemTickets lists the incidents attributed to a problem
+func GetProblemTickets(id uint) ([]Ticket, error) {
+	if _, err := GetProblemByID(id); err != nil {
+		return nil, err
+	}
+	return GetTickets(TicketFilter{ProblemID: id})
+}
+
+// attributeTicket attributes a ticket to a problem and notes it on the ticket
+func attributeTicket(tx *gorm.DB, ticket *Ticket, problem *Problem, actor *User) error {
+	if ticket.ProblemID != nil && *ticket.ProblemID == problem.ID {
+		return nil
+	}
+	if err := tx.Model(&Ticket{}).Where("id = ?", ticket.ID).Update("problem_id", problem.ID).Error; err != nil {
+		return err
+	}
+	note := TicketMessage{
+		TicketID:   ticket.ID,
+		AuthorID:   actor.ID,
+		Body:       fmt.Sprintf("%s attributed this ticket to problem #%d \"%s\".", displayName(actor), problem.ID, problem.Title),
+		Visibility: VisibilityInternal,
+		Source:     SourceWeb,
+	}
+	return tx.Create(&note).Error
+}
+
+// LinkProblemTickets attributes tickets to a problem. A ticket belongs to
+// one problem at a time; linking it again moves it.
+func LinkProblemTickets(id uint, req ProblemLinkRequest, actor *User) ([]Ticket, error) {
+	problem, err := GetProblemByID(id)
+	if err != nil {
+		return nil, err
+	}
+	tickets := make([]*Ticket, 0, len(req.TicketIDs))
+	for _, ticketID := range uniqueIDs(req.TicketIDs) {
+		ticket, err := GetTicketByID(ticketID)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, ticket := range tickets {
+			if err := attributeTicket(tx, ticket, problem, actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return GetTickets(TicketFilter{ProblemID: id})
+}
+
+// UnlinkProblemTicket stops attributing a ticket to a problem
+func UnlinkProblemTicket(id, ticketID uint) error {
+	result := DB.Model(&Ticket{}).Where("id = ? AND problem_id = ?", ticketID, id).Update("problem_id", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTicketNotFound
+	}
+	return nil
+}
+
+// FindKnownErrors lists the known errors most like a ticket, the one it is
+// attributed to first. Known errors of the ticket's category are compared
+// with its subject and description.
+func FindKnownErrors(ticket *Ticket) ([]Problem, error) {
+	var problems []Problem
+	if err := problemQuery().Where("status = ?", ProblemStatusKnownError).Find(&problems).Error; err != nil {
+		return nil, err
+	}
+
+	matches := []Problem{}
+	for _, problem := range problems {
+		similarity := ticketSimilarity(ticket.Subject, ticket.Description, problem.Title, problem.Description)
+		if problem.Category == ticket.Category {
+			// Same-category known errors win ties and are suggested on a faint match
+			similarity += 0.05
+		}
+		if ticket.ProblemID != nil && *ticket.ProblemID == problem.ID {
+			similarity = 1
+		}
+		if similarity <= 0.05 {
+			continue
+		}
+		if similarity > 1 {
+			similarity = 1
+		}
+		problem.Similarity = float64(int(similarity*100+0.5)) / 100
+		matches = append(matches, problem)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+	if len(matches) > maxKnownErrorMatches {
+		matches = matches[:maxKnownErrorMatches]
+	}
+	return matches, nil
+}
+
+// ApplyWorkaround posts the workaround of a known error on a ticket, public
+// replies reaching the requester as usual, and attributes the ticket to the
+// problem. The problem's Issue article is linked to the ticket as well.
+func ApplyWorkaround(ticketID, problemID uint, req WorkaroundRequest, agent *User) (*TicketMessage, error) {
+	problem, err := GetProblemByID(problemID)
+	if err != nil {
+		return nil, err
+	}
+	if problem.Status != ProblemStatusKnownError {
+		return nil, ErrNotKnownError
+	}
+
+	message, err := AddTicketMessage(ticketID, agent, TicketMessageInput{
+		Body:       problem.Workaround,
+		Visibility: req.Visibility,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := GetTicketByID(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := attributeTicket(tx, ticket, problem, agent); err != nil {
+			return err
+		}
+		if problem.ArticleID == nil {
+			return nil
+		}
+		return linkTicketArticle(tx, ticketID, *problem.ArticleID, agent.ID)
+	}); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,560 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Queue is a named pile of tickets worked by its member agents
+type Queue struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description    string    `json:"description"`
+	Strategy       string    `json:"strategy" gorm:"not null;default:'manual'"`
+	LastAssignedID *uint     `json:"-"` // Round-robin cursor
+	Members        []User    `json:"members,omitempty" gorm:"many2many:queue_members"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// QueueRequest is used for creating/updating queues
+type QueueRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Strategy    string `json:"strategy"`
+	MemberIDs   []uint `json:"member_ids"`
+}
+
+// RoutingRule sends new tickets matching all of its conditions to a queue.
+// Empty conditions match every ticket; rules are tried in position order.
+type RoutingRule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Name          string    `json:"name" gorm:"not null"`
+	Position      int       `json:"position"`
+	QueueID       uint      `json:"queue_id" gorm:"index"`
+	Queue         *Queue    `json:"queue,omitempty" gorm:"foreignKey:QueueID"`
+	Category      string    `json:"category"`
+	Priority      string    `json:"priority"`
+	Keyword       string    `json:"keyword"`        // Matched case-insensitively against subject and description
+	RequiredSkill string    `json:"required_skill"` // Used by skill-based assignment
+	Active        bool      `json:"active" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RoutingRuleRequest is used for creating/updating routing rules
+type RoutingRuleRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Position      int    `json:"position"`
+	QueueID       uint   `json:"queue_id" binding:"required"`
+	Category      string `json:"category"`
+	Priority      string `json:"priority"`
+	Keyword       string `json:"keyword"`
+	RequiredSkill string `json:"required_skill"`
+	Active        *bool  `json:"active"`
+}
+
+// QueueDepth summarises the open tickets waiting in a queue
+type QueueDepth struct {
+	QueueID         *uint      `json:"queue_id"` // Null for tickets outside any queue
+	Name            string     `json:"name"`
+	Open            int64      `json:"open"`
+	Unassigned      int64      `json:"unassigned"`
+	New             int64      `json:"new"`
+	Pending         int64      `json:"pending"`
+	OldestCreatedAt *time.Time `json:"oldest_created_at"`
+	AvailableAgents int        `json:"available_agents"`
+}
+
+// Assignment strategies
+const (
+	QueueStrategyManual      = "manual"
+	QueueStrategyRoundRobin  = "round_robin"
+	QueueStrategyLeastLoaded = "least_loaded"
+	QueueStrategySkillBased  = "skill_based"
+)
+
+var (
+	ValidQueueStrategies = []string{QueueStrategyManual, QueueStrategyRoundRobin, QueueStrategyLeastLoaded, QueueStrategySkillBased}
+
+	// openTicketStatuses count towards an agent's load and a queue's depth
+	openTicketStatuses = []string{TicketStatusNew, TicketStatusOpen, TicketStatusPending}
+)
+
+var (
+	ErrQueueNotFound       = errors.New("queue not found")
+	ErrQueueExists         = errors.New("a queue with this name already exists")
+	ErrInvalidStrategy     = errors.New("invalid assignment strategy")
+	ErrInvalidQueueMember  = errors.New("queue members must be active agents")
+	ErrRoutingRuleNotFound = errors.New("routing rule not found")
+)
+
+// GetQueues lists all queues with their members
+func GetQueues() ([]Queue, error) {
+	var queues []Queue
+	err := DB.Preload("Members").Order("name").Find(&queues).Error
+	return queues, err
+}
+
+// GetQueueByID retrieves a queue with its members
+func GetQueueByID(id uint) (*Queue, error) {
+	var queue Queue
+	if err := DB.Preload("Members").First(&queue, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQueueNotFound
+		}
+		return nil, err
+	}
+	return &queue, nil
+}
+
+// validateQueue checks the strategy and members of a queue request
+func validateQueue(tx *gorm.DB, req *QueueRequest, exceptID uint) ([]User, error) {
+	if req.Strategy == "" {
+		req.Strategy = QueueStrategyManual
+	}
+	if !containsString(ValidQueueStrategies, req.Strategy) {
+		return nil, ErrInvalidStrategy
+	}
+
+	var count int64
+	if err := tx.Model(&Queue{}).Where("LOWER(name) = LOWER(?) AND id <> ?", req.Name, exceptID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrQueueExists
+	}
+
+	members, err := usersByIDs(tx, req.MemberIDs)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidQueueMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if !member.IsAgent() || !member.Active {
+			return nil, ErrInvalidQueueMember
+		}
+	}
+	return members, nil
+}
+
+// CreateQueue creates a queue with its members
+func CreateQueue(req QueueRequest) (*Queue, error) {
+	var queue Queue
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		members, err := validateQueue(tx, &req, 0)
+		if err != nil {
+			return err
+		}
+		queue = Queue{Name: req.Name, Description: req.Description, Strategy: req.Strategy}
+		if err := tx.Create(&queue).Error; err != nil {
+			return err
+		}
+		return tx.Model(&queue).Association("Members").Replace(members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetQueueByID(queue.ID)
+}
+
+// UpdateQueue replaces a queue's settings and members
+func UpdateQueue(id uint, req QueueRequest) (*Queue, error) {
+	queue, err := GetQueueByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		members, err := validateQueue(tx, &req, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(queue).Updates(map[string]interface{}{
+			"name":        req.Name,
+			"description": req.Description,
+			"strategy":    req.Strategy,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(queue).Association("Members").Replace(members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetQueueByID(id)
+}
+
+// DeleteQueue deletes a queue. Its tickets stay with their assignees outside any queue.
+func DeleteQueue(id uint) error {
+	queue, err := GetQueueByID(id)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Ticket{}).Where("queue_id = ?", id).Update("queue_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(queue).Association("Members").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Where("queue_id = ?", id).Delete(&RoutingRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(queue).Error
+	})
+}
+
+// GetRoutingRules lists routing rules in evaluation order
+func GetRoutingRules() ([]RoutingRule, error) {
+	var rules []RoutingRule
+	err := DB.Preload("Queue").Order("position, id").Find(&rules).Error
+	return rules, err
+}
+
+// GetRoutingRuleByID retrieves a single routing rule
+func GetRoutingRuleByID(id uint) (*RoutingRule, error) {
+	var rule RoutingRule
+	if err := DB.Preload("Queue").First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoutingRuleNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// validateRoutingRule checks the queue and conditions of a rule request
+func validateRoutingRule(req RoutingRuleRequest) error {
+	if _, err := GetQueueByID(req.QueueID); err != nil {
+		return err
+	}
+	if req.Category != "" && !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	if req.Priority != "" && !containsString(ValidTicketPriorities, req.Priority) {
+		return ErrInvalidPriority
+	}
+	return nil
+}
+
+// CreateRoutingRule creates a routing rule
+func CreateRoutingRule(req RoutingRuleRequest) (*RoutingRule, error) {
+	if err := validateRoutingRule(req); err != nil {
+		return nil, err
+	}
+
+	rule := RoutingRule{
+		Name:          req.Name,
+		Position:      req.Position,
+		QueueID:       req.QueueID,
+		Category:      req.Category,
+		Priority:      req.Priority,
+		Keyword:       strings.TrimSpace(req.Keyword),
+		RequiredSkill: strings.TrimSpace(req.RequiredSkill),
+		Active:        req.Active == nil || *req.Active,
+	}
+	if err := DB.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return GetRoutingRuleByID(rule.ID)
+}
+
+// UpdateRoutingRule updates a routing rule
+func UpdateRoutingRule(id uint, req RoutingRuleRequest) (*RoutingRule, error) {
+	rule, err := GetRoutingRuleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRoutingRule(req); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":           req.Name,
+		"position":       req.Position,
+		"queue_id":       req.QueueID,
+		"category":       req.Category,
+		"priority":       req.Priority,
+		"keyword":        strings.TrimSpace(req.Keyword),
+		"required_skill": strings.TrimSpace(req.RequiredSkill),
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if err := DB.Model(rule).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetRoutingRuleByID(id)
+}
+
+// DeleteRoutingRule deletes a routing rule
+func DeleteRoutingRule(id uint) error {
+	if _, err := GetRoutingRuleByID(id); err != nil {
+		return err
+	}
+	return DB.Delete(&RoutingRule{}, id).Error
+}
+
+// matches reports whether a ticket meets all conditions of the rule
+func (r *RoutingRule) matches(ticket *Ticket) bool {
+	if r.Category != "" && r.Category != ticket.Category {
+		return false
+	}
+	if r.Priority != "" && r.Priority != ticket.Priority {
+		return false
+	}
+	if r.Keyword != "" {
+		text := strings.ToLower(ticket.Subject + "\n" + ticket.Description)
+		if !strings.Contains(text, strings.ToLower(r.Keyword)) {
+			return false
+		}
+	}
+	return true
+}
+
+// routeTicket puts a new ticket into the queue of the first matching rule
+// and lets the queue's strategy pick an agent. Catalog orders go to their
+// item's fulfilment queue instead, when it has one.
+func routeTicket(tx *gorm.DB, ticket *Ticket) error {
+	if ticket.CatalogItemID != nil {
+		routed, err := routeCatalogOrder(tx, ticket)
+		if err != nil || routed {
+			return err
+		}
+	}
+
+	var rules []RoutingRule
+	if err := tx.Where("active = ?", true).Order("position, id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if !rule.matches(ticket) {
+			continue
+		}
+		ticket.QueueID = &rule.QueueID
+		ticket.RequiredSkill = rule.RequiredSkill
+		if err := tx.Model(ticket).Updates(map[string]interface{}{
+			"queue_id":       ticket.QueueID,
+			"required_skill": ticket.RequiredSkill,
+		}).Error; err != nil {
+			return err
+		}
+		log.Printf("Ticket %s routed to queue %d by rule %q", ticket.Reference(), rule.QueueID, rule.Name)
+		return autoAssignTicket(tx, ticket)
+	}
+	return nil
+}
+
+// availableAgents returns the queue members that can take tickets, ordered by ID
+func availableAgents(queue *Queue) []User {
+	var agents []User
+	for _, member := range queue.Members {
+		if member.IsAgent() && member.Active && !member.Away {
+			agents = append(agents, member)
+		}
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return agents
+}
+
+// hasSkill reports whether the agent has the skill
+func (u *User) hasSkill(skill string) bool {
+	for _, s := range u.Skills {
+		if strings.EqualFold(s, skill) {
+			return true
+		}
+	}
+	return false
+}
+
+// leastLoaded returns the agent with the fewest open tickets, lowest ID first on ties
+func leastLoaded(tx *gorm.DB, agents []User) (*User, error) {
+	ids := make([]uint, len(agents))
+	for i, agent := range agents {
+		ids[i] = agent.ID
+	}
+
+	var loads []struct {
+		AssigneeID uint
+		Count      int64
+	}
+	if err := tx.Model(&Ticket{}).
+		Select("assignee_id, COUNT(*) AS count").
+		Where("assignee_id IN ? AND status IN ?", ids, openTicketStatuses).
+		Group("assignee_id").
+		Scan(&loads).Error; err != nil {
+		return nil, err
+	}
+	loadOf := make(map[uint]int64, len(loads))
+	for _, load := range loads {
+		loadOf[load.AssigneeID] = load.Count
+	}
+
+	best := &agents[0]
+	for i := range agents[1:] {
+		if candidate := &agents[i+1]; loadOf[candidate.ID] < loadOf[best.ID] {
+			best = candidate
+		}
+	}
+	return best, nil
+}
+
+// autoAssignTicket picks an agent for an unassigned ticket using its queue's
+// strategy. Tickets awaiting approval are left for when they are approved.
+func autoAssignTicket(tx *gorm.DB, ticket *Ticket) error {
+	if ticket.AssigneeID != nil || ticket.QueueID == nil || ticket.ApprovalStatus == ApprovalPending {
+		return nil
+	}
+
+	var queue Queue
+	if err := tx.Preload("Members").First(&queue, *ticket.QueueID).Error; err != nil {
+		return err
+	}
+	agents := availableAgents(&queue)
+
+	var picked *User
+	switch queue.Strategy {
+	case QueueStrategyRoundRobin:
+		if len(agents) == 0 {
+			break
+		}
+		picked = &agents[0]
+		for i := range agents {
+			if queue.LastAssignedID == nil || agents[i].ID > *queue.LastAssignedID {
+				picked = &agents[i]
+				break
+			}
+		}
+		if err := tx.Model(&queue).Update("last_assigned_id", picked.ID).Error; err != nil {
+			return err
+		}
+	case QueueStrategySkillBased:
+		if ticket.RequiredSkill != "" {
+			var skilled []User
+			for _, agent := range agents {
+				if agent.hasSkill(ticket.RequiredSkill) {
+					skilled = append(skilled, agent)
+				}
+			}
+			agents = skilled
+		}
+		fallthrough
+	case QueueStrategyLeastLoaded:
+		if len(agents) == 0 {
+			break
+		}
+		var err error
+		if picked, err = leastLoaded(tx, agents); err != nil {
+			return err
+		}
+	}
+
+	if picked == nil {
+		return nil
+	}
+
+	updates := map[string]interface{}{"assignee_id": picked.ID}
+	if ticket.Status == TicketStatusNew {
+		updates["status"] = TicketStatusOpen
+	}
+	if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+		return err
+	}
+	ticket.AssigneeID = &picked.ID
+	log.Printf("Ticket %s assigned to %s by %s strategy of queue %s", ticket.Reference(), picked.Email, queue.Strategy, queue.Name)
+	return nil
+}
+
+// MoveTicketToQueue moves a ticket to a queue, or out of all queues when
+// queueID is nil. Unassigned tickets are then auto-assigned by the queue,
+// or once approved when they are awaiting approval.
+func MoveTicketToQueue(id uint, queueID *uint) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if queueID != nil {
+		if _, err := GetQueueByID(*queueID); err != nil {
+			return nil, err
+		}
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(ticket).Update("queue_id", queueID).Error; err != nil {
+			return err
+		}
+		ticket.QueueID = queueID
+		if err := autoAssignTicket(tx, ticket); err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, id, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTicketByID(id)
+}
+
+// GetQueueDepths reports the open tickets per queue, including tickets outside any queue
+func GetQueueDepths() ([]QueueDepth, error) {
+	queues, err := GetQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		QueueID    *uint
+		Status     string
+		Unassigned int64
+		Count      int64
+		Oldest     *time.Time
+	}
+	if err := DB.Model(&Ticket{}).
+		Select("queue_id, status, COUNT(*) FILTER (WHERE assignee_id IS NULL) AS unassigned, COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where("status IN ?", openTicketStatuses).
+		Group("queue_id, status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	depths := make([]QueueDepth, 0, len(queues)+1)
+	index := make(map[uint]int, len(queues))
+	for _, queue := range queues {
+		id := queue.ID
+		index[id] = len(depths)
+		depths = append(depths, QueueDepth{QueueID: &id, Name: queue.Name, AvailableAgents: len(availableAgents(&queue))})
+	}
+	depths = append(depths, QueueDepth{Name: "Unqueued"})
+
+	for _, row := range rows {
+		depth := &depths[len(depths)-1]
+		if row.QueueID != nil {
+			i, ok := index[*row.QueueID]
+			if !ok {
+				continue
+			}
+			depth = &depths[i]
+		}
+		depth.Open += row.Count
+		depth.Unassigned += row.Unassigned
+		switch row.Status {
+		case TicketStatusNew:
+			depth.New += row.Count
+		case TicketStatusPending:
+			depth.Pending += row.Count
+		}
+		if row.Oldest != nil && (depth.OldestCreatedAt == nil || row.Oldest.Before(*depth.OldestCreatedAt)) {
+			depth.OldestCreatedAt = row.Oldest
+		}
+	}
+	return depths, nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestAutoAssignSkipsTicketsAwaitingApproval(t *testing.T) {
+	queueID := uint(1)
+	ticket := &Ticket{QueueID: &queueID, Status: TicketStatusNew, ApprovalStatus: ApprovalPending}
+
+	// The queue is never loaded, so no database is needed
+	if err := autoAssignTicket(nil, ticket); err != nil {
+		t.Fatalf("autoAssignTicket() error = %v", err)
+	}
+	if ticket.AssigneeID != nil {
+		t.Errorf("ticket awaiting approval was assigned to %d", *ticket.AssigneeID)
+	}
+}
+
+func TestMoveTicketToQueueAwaitingApproval(t *testing.T) {
+	useTestDB(t)
+	agent := createTestUser(t, "agent")
+	queue := Queue{
+		Name:     fmt.Sprintf("Hardware %d", time.Now().UnixNano()),
+		Strategy: QueueStrategyRoundRobin,
+		Members:  []User{*agent},
+	}
+	if err := DB.Create(&queue).Error; err != nil {
+		t.Fatalf("creating queue: %v", err)
+	}
+	ticket := createTestTicket(t, createTestUser(t, "user"), func(ticket *Ticket) {
+		ticket.Status = TicketStatusNew
+		ticket.ApprovalStatus = ApprovalPending
+	})
+
+	moved, err := MoveTicketToQueue(ticket.ID, &queue.ID)
+	if err != nil {
+		t.Fatalf("MoveTicketToQueue() error = %v", err)
+	}
+	if moved.QueueID == nil || *moved.QueueID != queue.ID {
+		t.Errorf("QueueID = %v, want %d", moved.QueueID, queue.ID)
+	}
+	if moved.AssigneeID != nil || moved.Status != TicketStatusNew {
+		t.Fatalf("ticket awaiting approval was assigned to %v and set %s", moved.AssigneeID, moved.Status)
+	}
+
+	// Once approved, the queue it was moved to picks the agent
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		_, err := advanceApprovals(tx, moved, time.Now())
+		return err
+	}); err != nil {
+		t.Fatalf("advanceApprovals() error = %v", err)
+	}
+	approved, err := GetTicketByID(ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicketByID() error = %v", err)
+	}
+	if approved.AssigneeID == nil || *approved.AssigneeID != agent.ID || approved.Status != TicketStatusOpen {
+		t.Errorf("approved ticket has assignee %v and status %s, want %d and open", approved.AssigneeID, approved.Status, agent.ID)
+	}
+}
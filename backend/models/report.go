@@ -0,0 +1,34 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// reportGrouping holds the SQL that identifies and names a report group
+type reportGrouping struct {
+	id, name, join string
+}
+
+// groupedReport selects a row per group and per interval (day, week or
+// month) of timeColumn from table, with the given aggregate columns. The
+// joins come before the grouping's own join, which may rely on them.
+func groupedReport(table, timeColumn, interval string, grouping reportGrouping, aggregates string, joins ...string) *gorm.DB {
+	query := DB.Table(table).
+		Select(fmt.Sprintf(`%s AS group_id, %s AS "group",
+			date_trunc('%s', %s) AS period,
+			%s`, grouping.id, grouping.name, interval, timeColumn, aggregates))
+	for _, join := range joins {
+		query = query.Joins(join)
+	}
+	if grouping.join != "" {
+		query = query.Joins(grouping.join)
+	}
+	return query
+}
+
+// scanGroupedReport runs a grouped report query, ordered by period and group
+func scanGroupedReport(query *gorm.DB, dest interface{}) error {
+	return query.Group("1, 2, 3").Order("period, 2").Scan(dest).Error
+}
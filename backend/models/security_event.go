@@ -0,0 +1,85 @@
+package models
+
+import (
+	"log"
+	"time"
+)
+
+// SecurityEvent records a security-relevant action on an account
+type SecurityEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"index"`
+	Email     string    `json:"email" gorm:"index"` // Kept for failed logins on unknown accounts
+	Type      string    `json:"type" gorm:"index;not null"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// Security event types
+const (
+	SecurityEventLoginSucceeded       = "login_succeeded"
+	SecurityEventLoginFailed          = "login_failed"
+	SecurityEventPasswordChanged      = "password_changed"
+	SecurityEventTokenRevoked         = "token_revoked"
+	SecurityEventImpersonationStarted = "impersonation_started"
+	SecurityEventImpersonationEnded   = "impersonation_ended"
+)
+
+var ValidSecurityEventTypes = []string{
+	SecurityEventLoginSucceeded,
+	SecurityEventLoginFailed,
+	SecurityEventPasswordChanged,
+	SecurityEventTokenRevoked,
+	SecurityEventImpersonationStarted,
+	SecurityEventImpersonationEnded,
+}
+
+// SecurityEventFilter narrows down a security event query
+type SecurityEventFilter struct {
+	UserID *uint
+	Type   string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// RecordSecurityEvent stores a security event. Failures are logged rather than
+// returned so that auditing never blocks the action being audited.
+func RecordSecurityEvent(event SecurityEvent) {
+	if err := DB.Create(&event).Error; err != nil {
+		log.Printf("Warning: Could not record security event %s for %s: %v", event.Type, event.Email, err)
+	}
+}
+
+// GetSecurityEvents retrieves security events matching the filter, newest first
+func GetSecurityEvents(filter SecurityEventFilter) ([]SecurityEvent, int64, error) {
+	query := DB.Model(&SecurityEvent{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+
+	var events []SecurityEvent
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error
+	return events, total, err
+}
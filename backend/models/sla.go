@@ -0,0 +1,634 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"supportdesk/mailer"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// SLAPolicy sets first-response and resolution targets for tickets of a
+// priority, optionally restricted to one category
+type SLAPolicy struct {
+	ID                   uint           `json:"id" gorm:"primaryKey"`
+	Name                 string         `json:"name" gorm:"not null"`
+	Priority             string         `json:"priority" gorm:"index;not null"`
+	Category             string         `json:"category" gorm:"index"` // Empty matches every category
+	FirstResponseMinutes int            `json:"first_response_minutes"`
+	ResolutionMinutes    int            `json:"resolution_minutes"`
+	CalendarID           *uint          `json:"calendar_id"`                       // Business hours the targets count in; nil counts around the clock
+	PauseStatuses        pq.StringArray `json:"pause_statuses" gorm:"type:text[]"` // Ticket statuses that stop the clock
+	Active               bool           `json:"active" gorm:"not null"`
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// SLAPolicyRequest is used for creating/updating SLA policies
+type SLAPolicyRequest struct {
+	Name                 string    `json:"name" binding:"required"`
+	Priority             string    `json:"priority" binding:"required"`
+	Category             string    `json:"category"`
+	FirstResponseMinutes int       `json:"first_response_minutes" binding:"min=0"`
+	ResolutionMinutes    int       `json:"resolution_minutes" binding:"min=0"`
+	CalendarID           *uint     `json:"calendar_id"`
+	PauseStatuses        *[]string `json:"pause_statuses"` // Defaults to pending
+	Active               *bool     `json:"active"`
+}
+
+// SLATimer tracks one SLA target of a ticket
+type SLATimer struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	TicketID         uint       `json:"ticket_id" gorm:"index"`
+	PolicyID         uint       `json:"policy_id"`
+	Policy           *SLAPolicy `json:"policy,omitempty" gorm:"foreignKey:PolicyID"`
+	Metric           string     `json:"metric"`
+	TargetMinutes    int        `json:"target_minutes"`
+	CalendarID       *uint      `json:"calendar_id"`
+	StartedAt        time.Time  `json:"started_at"`
+	DueAt            time.Time  `json:"due_at"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	PausedAt         *time.Time `json:"paused_at"`      // Set while the ticket waits in a pause status
+	PausedSeconds    int64      `json:"paused_seconds"` // Business time spent paused or resolved before a reopen
+	AtRiskAt         *time.Time `json:"at_risk_at"`
+	BreachedAt       *time.Time `json:"breached_at"`
+	Status           string     `json:"status"`
+	ElapsedSeconds   int64      `json:"elapsed_seconds" gorm:"-"`   // Business time used so far
+	RemainingSeconds *int64     `json:"remaining_seconds" gorm:"-"` // Business time left, negative once overdue, null when completed
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// SLAEvent records an SLA state change of a ticket. Together the events of a
+// ticket form the timeline of its clock starts and stops.
+type SLAEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	TicketID       uint      `json:"ticket_id" gorm:"index"`
+	TimerID        uint      `json:"timer_id"`
+	Metric         string    `json:"metric"`
+	Type           string    `json:"type"`
+	TicketStatus   string    `json:"ticket_status,omitempty"`
+	ElapsedSeconds int64     `json:"elapsed_seconds"` // Business time counted against the target at the time of the event
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SLA metrics
+const (
+	SLAMetricFirstResponse = "first_response"
+	SLAMetricResolution    = "resolution"
+)
+
+// SLA timer statuses
+const (
+	SLAStatusRunning   = "running"
+	SLAStatusMet       = "met"
+	SLAStatusBreached  = "breached"
+	SLAStatusCancelled = "cancelled"
+)
+
+// SLA event types
+const (
+	SLAEventStarted   = "started"
+	SLAEventPaused    = "paused"
+	SLAEventResumed   = "resumed"
+	SLAEventReopened  = "reopened"
+	SLAEventAtRisk    = "at_risk"
+	SLAEventBreached  = "breached"
+	SLAEventMet       = "met"
+	SLAEventCancelled = "cancelled"
+)
+
+var (
+	ErrSLAPolicyNotFound  = errors.New("SLA policy not found")
+	ErrInvalidPauseStatus = errors.New("pause statuses must be open ticket statuses")
+)
+
+// defaultPauseStatuses stop the clock while the ticket waits on the requester
+var defaultPauseStatuses = []string{TicketStatusPending}
+
+// slaAtRiskFraction returns the share of the target after which a timer is at risk
+func slaAtRiskFraction() float64 {
+	if percent, err := strconv.Atoi(os.Getenv("SLA_AT_RISK_PERCENT")); err == nil && percent > 0 && percent < 100 {
+		return float64(percent) / 100
+	}
+	return 0.8
+}
+
+// calendarFor returns the business calendar a timer counts in, or nil for wall-clock time
+func (t *SLATimer) calendarFor(calendars map[uint]*BusinessCalendar) *BusinessCalendar {
+	if t.CalendarID == nil {
+		return nil
+	}
+	return calendars[*t.CalendarID]
+}
+
+// elapsed returns how much business time of the target has been used up at
+// the given time, leaving out the time the clock was stopped
+func (t *SLATimer) elapsed(calendar *BusinessCalendar, now time.Time) time.Duration {
+	end := now
+	if t.CompletedAt != nil && t.CompletedAt.Before(end) {
+		end = *t.CompletedAt
+	}
+	if t.PausedAt != nil && t.PausedAt.Before(end) {
+		end = *t.PausedAt
+	}
+	return calendar.BusinessDuration(t.StartedAt, end) - time.Duration(t.PausedSeconds)*time.Second
+}
+
+// dueAt calculates when the target expires in business time. Time the clock
+// was stopped pushes the due date back.
+func (t *SLATimer) dueAt(calendar *BusinessCalendar) time.Time {
+	target := time.Duration(t.TargetMinutes)*time.Minute + time.Duration(t.PausedSeconds)*time.Second
+	return calendar.AddBusinessDuration(t.StartedAt, target)
+}
+
+// fillSLATimes computes the elapsed and remaining business time of timers
+func fillSLATimes(tx *gorm.DB, timers []*SLATimer, now time.Time) error {
+	var calendarIDs []uint
+	for _, timer := range timers {
+		if timer.CalendarID != nil {
+			calendarIDs = append(calendarIDs, *timer.CalendarID)
+		}
+	}
+	calendars, err := loadBusinessCalendars(tx, calendarIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, timer := range timers {
+		calendar := timer.calendarFor(calendars)
+		timer.ElapsedSeconds = int64(timer.elapsed(calendar, now).Seconds())
+		if timer.CompletedAt == nil && timer.Status != SLAStatusCancelled {
+			remaining := int64(time.Duration(timer.TargetMinutes)*time.Minute/time.Second) - timer.ElapsedSeconds
+			timer.RemainingSeconds = &remaining
+		}
+	}
+	return nil
+}
+
+// pauses reports whether tickets in the status stop the policy's clock
+func (p *SLAPolicy) pauses(status string) bool {
+	return containsString(p.PauseStatuses, status)
+}
+
+// targetFor returns the policy target for a metric in minutes
+func (p *SLAPolicy) targetFor(metric string) int {
+	if metric == SLAMetricFirstResponse {
+		return p.FirstResponseMinutes
+	}
+	return p.ResolutionMinutes
+}
+
+// GetSLAPolicies lists all SLA policies
+func GetSLAPolicies() ([]SLAPolicy, error) {
+	var policies []SLAPolicy
+	err := DB.Order("priority, category").Find(&policies).Error
+	return policies, err
+}
+
+// GetSLAPolicyByID retrieves a single SLA policy
+func GetSLAPolicyByID(id uint) (*SLAPolicy, error) {
+	var policy SLAPolicy
+	if err := DB.First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSLAPolicyNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// validateSLAPolicy checks the priority, category and calendar of a policy request
+func validateSLAPolicy(req SLAPolicyRequest) error {
+	if !containsString(ValidTicketPriorities, req.Priority) {
+		return ErrInvalidPriority
+	}
+	if req.Category != "" && !ValidateTicketCategory(req.Category) {
+		return ErrInvalidCategory
+	}
+	if req.CalendarID != nil {
+		if _, err := GetBusinessCalendarByID(*req.CalendarID); err != nil {
+			return err
+		}
+	}
+	if req.PauseStatuses != nil {
+		for _, status := range *req.PauseStatuses {
+			if status != TicketStatusNew && status != TicketStatusOpen && status != TicketStatusPending {
+				return ErrInvalidPauseStatus
+			}
+		}
+	}
+	return nil
+}
+
+// CreateSLAPolicy creates a new SLA policy
+func CreateSLAPolicy(req SLAPolicyRequest) (*SLAPolicy, error) {
+	if err := validateSLAPolicy(req); err != nil {
+		return nil, err
+	}
+
+	pauseStatuses := defaultPauseStatuses
+	if req.PauseStatuses != nil {
+		pauseStatuses = *req.PauseStatuses
+	}
+
+	policy := SLAPolicy{
+		Name:                 req.Name,
+		Priority:             req.Priority,
+		Category:             req.Category,
+		FirstResponseMinutes: req.FirstResponseMinutes,
+		ResolutionMinutes:    req.ResolutionMinutes,
+		CalendarID:           req.CalendarID,
+		PauseStatuses:        pq.StringArray(pauseStatuses),
+		Active:               req.Active == nil || *req.Active,
+	}
+	if err := DB.Create(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdateSLAPolicy updates an SLA policy. Open tickets pick up the change on their next update.
+func UpdateSLAPolicy(id uint, req SLAPolicyRequest) (*SLAPolicy, error) {
+	policy, err := GetSLAPolicyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSLAPolicy(req); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":                   req.Name,
+		"priority":               req.Priority,
+		"category":               req.Category,
+		"first_response_minutes": req.FirstResponseMinutes,
+		"resolution_minutes":     req.ResolutionMinutes,
+		"calendar_id":            req.CalendarID,
+	}
+	if req.PauseStatuses != nil {
+		updates["pause_statuses"] = pq.StringArray(*req.PauseStatuses)
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+	if err := DB.Model(policy).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetSLAPolicyByID(id)
+}
+
+// DeleteSLAPolicy deletes an SLA policy and cancels the timers still running under it
+func DeleteSLAPolicy(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&SLATimer{}).
+			Where("policy_id = ? AND completed_at IS NULL AND status = ?", id, SLAStatusRunning).
+			Update("status", SLAStatusCancelled).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&SLAPolicy{}, id).Error
+	})
+}
+
+// matchSLAPolicy picks the active policy for a ticket. Category-specific
+// policies win over catch-all policies for the same priority.
+func matchSLAPolicy(tx *gorm.DB, ticket *Ticket) (*SLAPolicy, error) {
+	var policy SLAPolicy
+	err := tx.Where("active = ? AND priority = ? AND (category = ? OR category = '')", true, ticket.Priority, ticket.Category).
+		Order("category DESC, id").
+		First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// syncTicketSLA reconciles a ticket's SLA timers with its current state.
+// It is called after every ticket change: it starts timers for the matching
+// policy, retargets running timers when the policy changes, and stops,
+// pauses or restarts the clocks as the ticket moves through its statuses.
+func syncTicketSLA(tx *gorm.DB, ticketID uint, now time.Time) error {
+	var ticket Ticket
+	if err := tx.First(&ticket, ticketID).Error; err != nil {
+		return err
+	}
+	// The clocks of a request needing sign-off only run once it is approved
+	if ticket.ApprovalStatus != "" && ticket.ApprovalStatus != ApprovalApproved {
+		return nil
+	}
+
+	policy, err := matchSLAPolicy(tx, &ticket)
+	if err != nil {
+		return err
+	}
+
+	var calendar *BusinessCalendar
+	if policy != nil && policy.CalendarID != nil {
+		calendars, err := loadBusinessCalendars(tx, []uint{*policy.CalendarID})
+		if err != nil {
+			return err
+		}
+		calendar = calendars[*policy.CalendarID]
+	}
+
+	var timers []SLATimer
+	if err := tx.Where("ticket_id = ? AND status <> ?", ticket.ID, SLAStatusCancelled).Find(&timers).Error; err != nil {
+		return err
+	}
+	byMetric := make(map[string]*SLATimer, len(timers))
+	for i := range timers {
+		byMetric[timers[i].Metric] = &timers[i]
+	}
+
+	for _, metric := range []string{SLAMetricFirstResponse, SLAMetricResolution} {
+		timer := byMetric[metric]
+
+		target := 0
+		if policy != nil {
+			target = policy.targetFor(metric)
+		}
+
+		// No target any more: cancel whatever is still running
+		if target == 0 {
+			if timer != nil && timer.CompletedAt == nil {
+				if err := tx.Model(timer).Update("status", SLAStatusCancelled).Error; err != nil {
+					return err
+				}
+				recordSLAEvent(tx, timer, SLAEventCancelled, ticket.Status, timer.elapsed(calendar, now))
+			}
+			continue
+		}
+
+		if timer == nil {
+			timer = &SLATimer{
+				TicketID:      ticket.ID,
+				PolicyID:      policy.ID,
+				Metric:        metric,
+				TargetMinutes: target,
+				CalendarID:    policy.CalendarID,
+				StartedAt:     ticket.slaStart(),
+				Status:        SLAStatusRunning,
+			}
+			timer.DueAt = timer.dueAt(calendar)
+			if err := tx.Create(timer).Error; err != nil {
+				return err
+			}
+			recordSLAEvent(tx, timer, SLAEventStarted, ticket.Status, 0)
+		} else if timer.CompletedAt == nil {
+			retargeted := *timer
+			retargeted.TargetMinutes = target
+			retargeted.DueAt = retargeted.dueAt(calendar)
+			if timer.PolicyID != policy.ID || timer.TargetMinutes != target || !timer.DueAt.Equal(retargeted.DueAt) {
+				timer.PolicyID = policy.ID
+				timer.TargetMinutes = target
+				timer.CalendarID = policy.CalendarID
+				timer.DueAt = retargeted.DueAt
+				if err := tx.Model(timer).Updates(map[string]interface{}{
+					"policy_id":      timer.PolicyID,
+					"target_minutes": timer.TargetMinutes,
+					"calendar_id":    timer.CalendarID,
+					"due_at":         timer.DueAt,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := syncTimerClock(tx, &ticket, policy, calendar, timer, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slaStart is when the SLA clocks of a ticket start: when it was raised, or
+// when it was approved if it needed sign-off
+func (t *Ticket) slaStart() time.Time {
+	if t.ApprovedAt != nil {
+		return *t.ApprovedAt
+	}
+	return t.CreatedAt
+}
+
+// syncTimerClock makes a timer follow the ticket status: the clock stops in
+// pause statuses, stops for good once the goal is reached and restarts when
+// a resolved ticket is reopened. Stopped time is added to PausedSeconds.
+func syncTimerClock(tx *gorm.DB, ticket *Ticket, policy *SLAPolicy, calendar *BusinessCalendar, timer *SLATimer, now time.Time) error {
+	var doneAt *time.Time
+	switch timer.Metric {
+	case SLAMetricFirstResponse:
+		doneAt = ticket.FirstRespondedAt
+	case SLAMetricResolution:
+		if !ticket.IsOpen() {
+			doneAt = ticket.ResolvedAt
+			if doneAt == nil {
+				doneAt = &now
+			}
+		}
+	}
+
+	// A reopened ticket picks up the resolution clock where it stopped
+	if doneAt == nil && timer.CompletedAt != nil && timer.Metric == SLAMetricResolution {
+		timer.PausedSeconds += int64(calendar.BusinessDuration(*timer.CompletedAt, now).Seconds())
+		timer.CompletedAt = nil
+		timer.DueAt = timer.dueAt(calendar)
+		timer.Status = SLAStatusRunning
+		if timer.BreachedAt != nil {
+			timer.Status = SLAStatusBreached
+		}
+		if err := tx.Model(timer).Updates(map[string]interface{}{
+			"completed_at":   nil,
+			"paused_seconds": timer.PausedSeconds,
+			"due_at":         timer.DueAt,
+			"status":         timer.Status,
+		}).Error; err != nil {
+			return err
+		}
+		recordSLAEvent(tx, timer, SLAEventReopened, ticket.Status, timer.elapsed(calendar, now))
+	}
+
+	if timer.CompletedAt != nil {
+		return nil
+	}
+
+	paused := doneAt == nil && policy.pauses(ticket.Status)
+	if paused && timer.PausedAt == nil {
+		timer.PausedAt = &now
+		if err := tx.Model(timer).Update("paused_at", now).Error; err != nil {
+			return err
+		}
+		recordSLAEvent(tx, timer, SLAEventPaused, ticket.Status, timer.elapsed(calendar, now))
+		return nil
+	}
+
+	if !paused && timer.PausedAt != nil {
+		resumeAt := now
+		if doneAt != nil && doneAt.Before(resumeAt) && doneAt.After(*timer.PausedAt) {
+			resumeAt = *doneAt
+		}
+		timer.PausedSeconds += int64(calendar.BusinessDuration(*timer.PausedAt, resumeAt).Seconds())
+		timer.PausedAt = nil
+		timer.DueAt = timer.dueAt(calendar)
+		if err := tx.Model(timer).Updates(map[string]interface{}{
+			"paused_at":      nil,
+			"paused_seconds": timer.PausedSeconds,
+			"due_at":         timer.DueAt,
+		}).Error; err != nil {
+			return err
+		}
+		recordSLAEvent(tx, timer, SLAEventResumed, ticket.Status, timer.elapsed(calendar, resumeAt))
+	}
+
+	if doneAt == nil {
+		return nil
+	}
+
+	status := SLAStatusMet
+	if doneAt.After(timer.DueAt) {
+		status = SLAStatusBreached
+	}
+	updates := map[string]interface{}{"completed_at": *doneAt, "status": status}
+	breachedNow := status == SLAStatusBreached && timer.BreachedAt == nil
+	if breachedNow {
+		updates["breached_at"] = timer.DueAt
+	}
+	if err := tx.Model(timer).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	elapsed := timer.elapsed(calendar, *doneAt)
+	switch {
+	case status == SLAStatusMet:
+		recordSLAEvent(tx, timer, SLAEventMet, ticket.Status, elapsed)
+	case breachedNow:
+		// Completed late before the monitor caught the breach
+		recordSLAEvent(tx, timer, SLAEventBreached, ticket.Status, elapsed)
+	}
+	return nil
+}
+
+// retargetCalendarTimers recalculates the due dates of running timers that
+// count in a calendar after its hours or holidays changed
+func retargetCalendarTimers(tx *gorm.DB, calendarID uint) error {
+	calendars, err := loadBusinessCalendars(tx, []uint{calendarID})
+	if err != nil {
+		return err
+	}
+
+	var timers []SLATimer
+	if err := tx.Where("calendar_id = ? AND completed_at IS NULL AND status <> ?", calendarID, SLAStatusCancelled).
+		Find(&timers).Error; err != nil {
+		return err
+	}
+	for i := range timers {
+		if err := tx.Model(&timers[i]).Update("due_at", timers[i].dueAt(calendars[calendarID])).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSLAEvent stores an SLA event and logs it
+func recordSLAEvent(tx *gorm.DB, timer *SLATimer, eventType, ticketStatus string, elapsed time.Duration) {
+	event := SLAEvent{
+		TicketID:       timer.TicketID,
+		TimerID:        timer.ID,
+		Metric:         timer.Metric,
+		Type:           eventType,
+		TicketStatus:   ticketStatus,
+		ElapsedSeconds: int64(elapsed.Seconds()),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		log.Printf("Warning: Could not record SLA event %s for ticket %d: %v", eventType, timer.TicketID, err)
+		return
+	}
+	log.Printf("SLA: TCK-%d %s target %s", timer.TicketID, timer.Metric, eventType)
+}
+
+// GetSLAEvents lists the SLA events of a ticket in order
+func GetSLAEvents(ticketID uint) ([]SLAEvent, error) {
+	var events []SLAEvent
+	err := DB.Where("ticket_id = ?", ticketID).Order("created_at, id").Find(&events).Error
+	return events, err
+}
+
+// CheckSLATimers flags running timers that are at risk or breached and
+// notifies the assignee. Each state is only flagged once per timer and
+// paused timers are left alone.
+func CheckSLATimers(now time.Time) error {
+	var timers []SLATimer
+	if err := DB.Where("completed_at IS NULL AND paused_at IS NULL AND status IN ?", []string{SLAStatusRunning, SLAStatusBreached}).
+		Where("breached_at IS NULL").
+		Find(&timers).Error; err != nil {
+		return err
+	}
+
+	var calendarIDs []uint
+	for _, timer := range timers {
+		if timer.CalendarID != nil {
+			calendarIDs = append(calendarIDs, *timer.CalendarID)
+		}
+	}
+	calendars, err := loadBusinessCalendars(DB, calendarIDs)
+	if err != nil {
+		return err
+	}
+
+	fraction := slaAtRiskFraction()
+	for i := range timers {
+		timer := &timers[i]
+		target := time.Duration(timer.TargetMinutes) * time.Minute
+		elapsed := timer.elapsed(timer.calendarFor(calendars), now)
+
+		switch {
+		case now.After(timer.DueAt):
+			result := DB.Model(&SLATimer{}).
+				Where("id = ? AND breached_at IS NULL", timer.ID).
+				Updates(map[string]interface{}{"breached_at": now, "status": SLAStatusBreached})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				recordSLAEvent(DB, timer, SLAEventBreached, "", elapsed)
+				notifySLAAssignee(timer, "breached")
+			}
+		case timer.AtRiskAt == nil && float64(elapsed) >= fraction*float64(target):
+			result := DB.Model(&SLATimer{}).
+				Where("id = ? AND at_risk_at IS NULL", timer.ID).
+				Update("at_risk_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				recordSLAEvent(DB, timer, SLAEventAtRisk, "", elapsed)
+				notifySLAAssignee(timer, "at risk")
+			}
+		}
+	}
+	return nil
+}
+
+// notifySLAAssignee emails the ticket's assignee about an SLA state change
+func notifySLAAssignee(timer *SLATimer, state string) {
+	ticket, err := GetTicketByID(timer.TicketID)
+	if err != nil || ticket.Assignee == nil {
+		return
+	}
+	subject := fmt.Sprintf("[%s] SLA %s: %s", ticket.Reference(), state, ticket.Subject)
+	body := fmt.Sprintf("The %s target of ticket %s (%s) is %s.\nDue: %s\n\n%s",
+		timer.Metric, ticket.Reference(), ticket.Priority, state,
+		timer.DueAt.Format("2006-01-02 15:04 MST"), mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID)))
+	if err := mailer.Send(ticket.Assignee.Email, subject, body); err != nil {
+		log.Printf("Warning: Could not notify %s about SLA of %s: %v", ticket.Assignee.Email, ticket.Reference(), err)
+	}
+}
@@ -12,30 +12,33 @@ import (
 
 // Task represents a support task in the system
 type Task struct {
-	ID          uint           `json:"id" gorm:"primaryKey;autoIncrement:true"`
-	Title       string         `json:"title" binding:"required"`
-	Description string         `json:"description"`
-	Content     string         `json:"content" gorm:"type:text"`
-	Type        string         `json:"type" binding:"required"`
-	Category    string         `json:"category" gorm:"index"`
-	Status      string         `json:"status" gorm:"default:'pending'"`
-	Rating      float64        `json:"rating" gorm:"default:0"`
-	Keywords    pq.StringArray `json:"keywords" gorm:"type:text[]"`
-	UserID      uint           `json:"user_id"`
-	User        User           `json:"user" gorm:"foreignKey:UserID"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID           uint           `json:"id" gorm:"primaryKey;autoIncrement:true"`
+	Title        string         `json:"title" binding:"required"`
+	Description  string         `json:"description"`
+	Content      string         `json:"content" gorm:"type:text"`
+	Type         string         `json:"type" binding:"required"`
+	Category     string         `json:"category" gorm:"index"`
+	Status       string         `json:"status" gorm:"default:'pending'"`
+	Rating       float64        `json:"rating" gorm:"default:0"`
+	Keywords     pq.StringArray `json:"keywords" gorm:"type:text[]"`
+	SolvedCount  int            `json:"solved_count" gorm:"not null;default:0"` // Resolved tickets credited to this article
+	CustomFields JSONMap        `json:"custom_fields" gorm:"type:jsonb"`
+	UserID       uint           `json:"user_id"`
+	User         User           `json:"user" gorm:"foreignKey:UserID"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // TaskRequest is used for creating/updating tasks
 type TaskRequest struct {
-	Title       string   `json:"title" binding:"required"`
-	Description string   `json:"description"`
-	Content     string   `json:"content" binding:"required"`
-	Type        string   `json:"type" binding:"required"`
-	Category    string   `json:"category" binding:"required"`
-	Keywords    []string `json:"keywords"`
+	Title        string   `json:"title" binding:"required"`
+	Description  string   `json:"description"`
+	Content      string   `json:"content" binding:"required"`
+	Type         string   `json:"type" binding:"required"`
+	Category     string   `json:"category" binding:"required"`
+	Keywords     []string `json:"keywords"`
+	CustomFields JSONMap  `json:"custom_fields"`
 }
 
 // Constants for task types and statuses
@@ -88,8 +91,13 @@ func CreateTask(req TaskRequest, userID uint) (*Task, error) {
 	if !task.ValidateType() {
 		return nil, ErrInvalidType
 	}
+	customFields, err := ValidateCustomFields(CustomFieldEntityArticle, req.Category, req.CustomFields, true)
+	if err != nil {
+		return nil, err
+	}
+	task.CustomFields = customFields
 
-	err := DB.Create(&task).Error
+	err = DB.Create(&task).Error
 	return &task, err
 }
 
@@ -104,18 +112,23 @@ func UpdateTask(id uint, req TaskRequest) (*Task, error) {
 	if !ValidateTaskType(req.Type) {
 		return nil, ErrInvalidType
 	}
+	customFields, err := ValidateCustomFields(CustomFieldEntityArticle, req.Category, req.CustomFields, true)
+	if err != nil {
+		return nil, err
+	}
 
 	// Convert []string to pq.StringArray
 	keywords := pq.StringArray(req.Keywords)
 
 	// Update using struct with explicit field mapping
 	updates := Task{
-		Title:       req.Title,
-		Description: req.Description,
-		Content:     req.Content,
-		Type:        req.Type,
-		Category:    req.Category,
-		Keywords:    keywords,
+		Title:        req.Title,
+		Description:  req.Description,
+		Content:      req.Content,
+		Type:         req.Type,
+		Category:     req.Category,
+		Keywords:     keywords,
+		CustomFields: customFields,
 	}
 
 	err = DB.Model(&task).Updates(updates).Error
@@ -238,4 +251,4 @@ func (t *Task) AfterUpdate(tx *gorm.DB) error {
 
 func (t *Task) AfterDelete(tx *gorm.DB) error {
 	return UpdateSeedFile()
-}
\ No newline at end of file
+}
@@ -0,0 +1,587 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"supportdesk/migrations"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Ticket represents a support request raised by a user
+type Ticket struct {
+	ID               uint               `json:"id" gorm:"primaryKey"`
+	Subject          string             `json:"subject" gorm:"not null"`
+	Description      string             `json:"description" gorm:"type:text"`
+	RequesterID      uint               `json:"requester_id" gorm:"index"`
+	Requester        User               `json:"requester" gorm:"foreignKey:RequesterID"`
+	AssigneeID       *uint              `json:"assignee_id" gorm:"index"`
+	Assignee         *User              `json:"assignee,omitempty" gorm:"foreignKey:AssigneeID"`
+	QueueID          *uint              `json:"queue_id" gorm:"index"`
+	Queue            *Queue             `json:"queue,omitempty" gorm:"foreignKey:QueueID"`
+	RequiredSkill    string             `json:"required_skill,omitempty"`
+	Priority         string             `json:"priority" gorm:"not null;default:'P3'"`
+	Category         string             `json:"category" gorm:"index"`
+	Status           string             `json:"status" gorm:"index;not null;default:'new'"`
+	FirstRespondedAt *time.Time         `json:"first_responded_at"`
+	LastAgentReplyAt *time.Time         `json:"last_agent_reply_at"`
+	ResolvedAt       *time.Time         `json:"resolved_at"`
+	ClosedAt         *time.Time         `json:"closed_at"`
+	CloseReason      string             `json:"close_reason,omitempty"`
+	SolvedByTaskID   *uint              `json:"solved_by_task_id" gorm:"index"` // Article credited with solving the ticket
+	Source           string             `json:"source" gorm:"not null;default:'web'"`
+	EmailMessageID   string             `json:"-"` // Message-ID header of the email that raised the ticket
+	Tags             pq.StringArray     `json:"tags" gorm:"type:text[]"`
+	MergedIntoID     *uint              `json:"merged_into_id" gorm:"index"` // Primary ticket this one was merged into
+	CustomFields     JSONMap            `json:"custom_fields" gorm:"type:jsonb"`
+	RequestType      string             `json:"request_type,omitempty" gorm:"index"`
+	ApprovalStatus   string             `json:"approval_status,omitempty" gorm:"index"` // Empty when no approval is needed
+	ApprovedAt       *time.Time         `json:"approved_at,omitempty"`
+	CatalogItemID    *uint              `json:"catalog_item_id,omitempty" gorm:"index"` // Catalog item the ticket fulfils
+	FormAnswers      JSONMap            `json:"form_answers,omitempty" gorm:"type:jsonb"`
+	ExpectedBy       *time.Time         `json:"expected_by,omitempty"` // Promised delivery of a catalog order
+	MajorIncident    bool               `json:"major_incident"`
+	ParentID         *uint              `json:"parent_id" gorm:"index"`  // Major incident the ticket is a child of
+	ProblemID        *uint              `json:"problem_id" gorm:"index"` // Problem the incident is attributed to
+	SLA              []SLATimer         `json:"sla" gorm:"foreignKey:TicketID"`
+	Watchers         []User             `json:"watchers,omitempty" gorm:"many2many:ticket_watchers"`
+	CCs              []User             `json:"ccs,omitempty" gorm:"many2many:ticket_ccs"`        // Copied like the requester
+	Assets           []Asset            `json:"assets,omitempty" gorm:"many2many:ticket_assets"`  // Configuration items the ticket is about
+	Attachments      []TicketAttachment `json:"attachments,omitempty" gorm:"foreignKey:TicketID"` // Attached when the ticket was raised
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt     `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// TicketRequest is used for creating tickets
+type TicketRequest struct {
+	Subject      string  `json:"subject" binding:"required"`
+	Description  string  `json:"description" binding:"required"`
+	Priority     string  `json:"priority"`
+	Category     string  `json:"category" binding:"required"`
+	RequesterID  uint    `json:"requester_id"` // Only honoured for agents raising a ticket on someone's behalf
+	CustomFields JSONMap `json:"custom_fields"`
+	RequestType  string  `json:"request_type"` // Requests of a type with an approval chain wait for sign-off
+	AssetIDs     []uint  `json:"asset_ids"`    // The requester's own or shared assets the ticket is about
+
+	// Set by the email ingestion, never bound from a request body
+	Source         string             `json:"-"`
+	EmailMessageID string             `json:"-"`
+	Attachments    []AttachmentUpload `json:"-"`
+
+	// Set when ordering from the service catalog
+	CatalogItemID *uint   `json:"-"`
+	FormAnswers   JSONMap `json:"-"`
+}
+
+// TicketUpdateRequest is used by agents to update ticket details
+type TicketUpdateRequest struct {
+	Subject      string  `json:"subject" binding:"required"`
+	Description  string  `json:"description"`
+	Priority     string  `json:"priority" binding:"required"`
+	Category     string  `json:"category" binding:"required"`
+	CustomFields JSONMap `json:"custom_fields"` // Left unchanged when omitted and the category stays the same
+}
+
+// TicketStatusChange moves a ticket to a new status. Resolving or closing
+// may give a close reason; "resolved_with_article" needs the article's task ID.
+type TicketStatusChange struct {
+	Status      string `json:"status" binding:"required"`
+	CloseReason string `json:"close_reason"`
+	TaskID      *uint  `json:"task_id"`
+}
+
+// TicketFilter narrows down a ticket listing
+type TicketFilter struct {
+	RequesterID    uint
+	Participant    uint // Requester or CC
+	AssigneeID     uint
+	Unassigned     bool
+	QueueID        uint
+	Status         string
+	Priority       string
+	Category       string
+	Tag            string
+	CustomFields   map[string]string // Custom field key to value
+	RequestType    string
+	ApprovalStatus string
+	MajorIncident  bool
+	ParentID       uint // Children of a major incident
+	ProblemID      uint
+	AssetID        uint
+}
+
+// Ticket priorities, from most to least urgent
+const (
+	TicketPriorityCritical = "P1"
+	TicketPriorityHigh     = "P2"
+	TicketPriorityNormal   = "P3"
+	TicketPriorityLow      = "P4"
+)
+
+// Ticket statuses
+const (
+	TicketStatusNew      = "new"
+	TicketStatusOpen     = "open"
+	TicketStatusPending  = "pending"
+	TicketStatusResolved = "resolved"
+	TicketStatusClosed   = "closed"
+)
+
+var (
+	ValidTicketPriorities = []string{TicketPriorityCritical, TicketPriorityHigh, TicketPriorityNormal, TicketPriorityLow}
+	ValidTicketStatuses   = []string{TicketStatusNew, TicketStatusOpen, TicketStatusPending, TicketStatusResolved, TicketStatusClosed}
+
+	// ticketTransitions lists the statuses a ticket may move to from each status
+	ticketTransitions = map[string][]string{
+		TicketStatusNew:      {TicketStatusOpen, TicketStatusPending, TicketStatusResolved, TicketStatusClosed},
+		TicketStatusOpen:     {TicketStatusPending, TicketStatusResolved, TicketStatusClosed},
+		TicketStatusPending:  {TicketStatusOpen, TicketStatusResolved, TicketStatusClosed},
+		TicketStatusResolved: {TicketStatusOpen, TicketStatusClosed},
+		TicketStatusClosed:   {},
+	}
+)
+
+var (
+	ErrTicketNotFound        = errors.New("ticket not found")
+	ErrInvalidPriority       = errors.New("invalid priority")
+	ErrInvalidCategory       = errors.New("invalid category")
+	ErrInvalidTicketStatus   = errors.New("invalid ticket status")
+	ErrInvalidTransition     = errors.New("status transition not allowed")
+	ErrInvalidAssignee       = errors.New("assignee must be an active agent")
+	ErrTicketAccessForbidden = errors.New("not allowed to access this ticket")
+)
+
+// Reference returns the human-readable ticket number
+func (t *Ticket) Reference() string {
+	return fmt.Sprintf("TCK-%d", t.ID)
+}
+
+// IsOpen reports whether the ticket is still being worked on
+func (t *Ticket) IsOpen() bool {
+	return t.Status != TicketStatusResolved && t.Status != TicketStatusClosed
+}
+
+// IsRequester reports whether the user raised the ticket or is copied on it
+func (t *Ticket) IsRequester(user *User) bool {
+	if t.RequesterID == user.ID {
+		return true
+	}
+	for _, cc := range t.CCs {
+		if cc.ID == user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanView reports whether the user may see the ticket
+func (t *Ticket) CanView(user *User) bool {
+	return user.IsAgent() || t.IsRequester(user)
+}
+
+// ValidateTicketCategory checks the category against the known categories
+func ValidateTicketCategory(category string) bool {
+	return containsString(migrations.ValidCategories, category)
+}
+
+// CanTransition reports whether the ticket may move to the given status
+func (t *Ticket) CanTransition(status string) bool {
+	return containsString(ticketTransitions[t.Status], status)
+}
+
+// GetTickets retrieves tickets matching the filter, newest first
+func GetTickets(filter TicketFilter) ([]Ticket, error) {
+	var tickets []Ticket
+	query := preloadTicket(DB).Order("created_at DESC")
+
+	if filter.RequesterID != 0 {
+		query = query.Where("requester_id = ?", filter.RequesterID)
+	}
+	if filter.Participant != 0 {
+		query = query.Where("requester_id = ? OR id IN (SELECT ticket_id FROM ticket_ccs WHERE user_id = ?)", filter.Participant, filter.Participant)
+	}
+	if filter.AssigneeID != 0 {
+		query = query.Where("assignee_id = ?", filter.AssigneeID)
+	}
+	if filter.Unassigned {
+		query = query.Where("assignee_id IS NULL")
+	}
+	if filter.QueueID != 0 {
+		query = query.Where("queue_id = ?", filter.QueueID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status IN ?", strings.Split(filter.Status, ","))
+	}
+	if filter.Priority != "" {
+		query = query.Where("priority IN ?", strings.Split(filter.Priority, ","))
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Tag != "" {
+		query = query.Where("? = ANY(tags)", strings.ToLower(filter.Tag))
+	}
+	if filter.RequestType != "" {
+		query = query.Where("request_type = ?", filter.RequestType)
+	}
+	if filter.ApprovalStatus != "" {
+		query = query.Where("approval_status = ?", filter.ApprovalStatus)
+	}
+	if filter.MajorIncident {
+		query = query.Where("major_incident = ?", true)
+	}
+	if filter.ParentID != 0 {
+		query = query.Where("parent_id = ?", filter.ParentID)
+	}
+	if filter.ProblemID != 0 {
+		query = query.Where("problem_id = ?", filter.ProblemID)
+	}
+	if filter.AssetID != 0 {
+		query = query.Where("id IN (SELECT ticket_id FROM ticket_assets WHERE asset_id = ?)", filter.AssetID)
+	}
+	query = FilterCustomFields(query, filter.CustomFields)
+
+	if err := query.Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+
+	var timers []*SLATimer
+	for i := range tickets {
+		for j := range tickets[i].SLA {
+			timers = append(timers, &tickets[i].SLA[j])
+		}
+	}
+	if err := fillSLATimes(DB, timers, time.Now()); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// preloadTicket loads the requester, assignee, queue, watchers, CCs,
+// assets, attachments and live SLA timers of tickets
+func preloadTicket(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Requester").Preload("Assignee").Preload("Queue").Preload("Watchers").Preload("CCs").Preload("Assets").
+		Preload("Attachments", "ticket_message_id IS NULL").
+		Preload("SLA", "status <> ?", SLAStatusCancelled, func(db *gorm.DB) *gorm.DB {
+			return db.Order("due_at")
+		})
+}
+
+// GetTicketByID retrieves a single ticket with its requester, assignee and SLA timers
+func GetTicketByID(id uint) (*Ticket, error) {
+	var ticket Ticket
+	if err := preloadTicket(DB).First(&ticket, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTicketNotFound
+		}
+		return nil, err
+	}
+
+	timers := make([]*SLATimer, len(ticket.SLA))
+	for i := range ticket.SLA {
+		timers[i] = &ticket.SLA[i]
+	}
+	if err := fillSLATimes(DB, timers, time.Now()); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+// CreateTicket creates a new ticket for the requester, routes it to a queue
+// and flags it when it looks like a duplicate of an open ticket. Request
+// types with an approval chain start their chain instead of being routed.
+func CreateTicket(req TicketRequest, requesterID uint) (*Ticket, error) {
+	if req.Priority == "" {
+		req.Priority = TicketPriorityNormal
+	}
+	if !containsString(ValidTicketPriorities, req.Priority) {
+		return nil, ErrInvalidPriority
+	}
+	if !ValidateTicketCategory(req.Category) {
+		return nil, ErrInvalidCategory
+	}
+	if req.Source == "" {
+		req.Source = SourceWeb
+	}
+	// Emailed tickets cannot fill in fields, agents complete them later
+	customFields, err := ValidateCustomFields(CustomFieldEntityTicket, req.Category, req.CustomFields, req.Source != SourceEmail)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestType = normalizeRequestType(req.RequestType)
+	chain, err := approvalChainFor(req.RequestType)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequesterAssets(req.AssetIDs, requesterID); err != nil {
+		return nil, err
+	}
+
+	ticket := Ticket{
+		Subject:        req.Subject,
+		Description:    req.Description,
+		Priority:       req.Priority,
+		Category:       req.Category,
+		Status:         TicketStatusNew,
+		RequesterID:    requesterID,
+		Source:         req.Source,
+		EmailMessageID: req.EmailMessageID,
+		CustomFields:   customFields,
+		RequestType:    req.RequestType,
+		CatalogItemID:  req.CatalogItemID,
+		FormAnswers:    req.FormAnswers,
+	}
+	var attachments []TicketAttachment
+	var approvals []TicketApproval
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		var err error
+		if attachments, err = storeAttachments(ticket.ID, req.Attachments); err != nil {
+			return err
+		}
+		if err := createAttachments(tx, attachments); err != nil {
+			return err
+		}
+		if err := linkTicketAssets(tx, ticket.ID, req.AssetIDs); err != nil {
+			return err
+		}
+		// Requests needing sign-off are routed once approved
+		if chain != nil {
+			approvals, err = startApprovals(tx, &ticket, chain)
+			return err
+		}
+		if err := routeTicket(tx, &ticket); err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, ticket.ID, time.Now())
+	}); err != nil {
+		removeAttachmentFiles(attachments)
+		return nil, err
+	}
+
+	if len(approvals) > 0 {
+		var pending []TicketApproval
+		for _, approval := range approvals {
+			if approval.Status == ApprovalPending {
+				pending = append(pending, approval)
+			}
+		}
+		notifyApprovers(&ticket, pending)
+	}
+	flagPossibleDuplicate(&ticket)
+	return GetTicketByID(ticket.ID)
+}
+
+// UpdateTicket updates the details of a ticket
+func UpdateTicket(id uint, req TicketUpdateRequest) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(ValidTicketPriorities, req.Priority) {
+		return nil, ErrInvalidPriority
+	}
+	if !ValidateTicketCategory(req.Category) {
+		return nil, ErrInvalidCategory
+	}
+	customFields := ticket.CustomFields
+	if req.CustomFields != nil || req.Category != ticket.Category {
+		if customFields, err = ValidateCustomFields(CustomFieldEntityTicket, req.Category, req.CustomFields, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(ticket).Updates(map[string]interface{}{
+			"subject":       req.Subject,
+			"description":   req.Description,
+			"priority":      req.Priority,
+			"category":      req.Category,
+			"custom_fields": customFields,
+		}).Error; err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, id, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+	return GetTicketByID(id)
+}
+
+// ChangeTicketStatus moves a ticket through its lifecycle and keeps the
+// response, resolution and close timestamps and the close reason up to date
+func ChangeTicketStatus(id uint, change TicketStatusChange, actor *User) (*Ticket, error) {
+	status := change.Status
+	if !containsString(ValidTicketStatuses, status) {
+		return nil, ErrInvalidTicketStatus
+	}
+
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ticket.CanTransition(status) {
+		return nil, ErrInvalidTransition
+	}
+	// Until approved a request can only be withdrawn
+	if ticket.ApprovalStatus == ApprovalPending && status != TicketStatusClosed {
+		return nil, ErrAwaitingApproval
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": status}
+
+	// The first time an agent acts on a ticket counts as its first response
+	if actor.IsAgent() {
+		updates["last_agent_reply_at"] = now
+		if ticket.FirstRespondedAt == nil {
+			updates["first_responded_at"] = now
+		}
+	}
+
+	switch status {
+	case TicketStatusResolved:
+		updates["resolved_at"] = now
+	case TicketStatusClosed:
+		updates["closed_at"] = now
+		if ticket.ResolvedAt == nil {
+			updates["resolved_at"] = now
+		}
+	case TicketStatusOpen, TicketStatusPending:
+		// Reopening clears the previous resolution
+		updates["resolved_at"] = nil
+		updates["close_reason"] = ""
+		updates["solved_by_task_id"] = nil
+	}
+
+	solvedBy, err := ticket.closeReasonUpdates(change, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if ticket.ApprovalStatus == ApprovalPending {
+			if err := cancelApprovals(tx, id); err != nil {
+				return err
+			}
+		}
+		if solvedBy != nil {
+			if err := linkTicketArticle(tx, id, *solvedBy, actor.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Keep the solved counters of the previous and the new article in step
+		for _, taskID := range uniqueIDs(nonNilIDs(ticket.SolvedByTaskID, solvedBy)) {
+			if err := refreshSolvedCount(tx, taskID); err != nil {
+				return err
+			}
+		}
+		return syncTicketSLA(tx, id, now)
+	}); err != nil {
+		return nil, err
+	}
+
+	updated, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if status == TicketStatusResolved {
+		sendCSATSurvey(updated)
+	}
+	return updated, nil
+}
+
+// closeReasonUpdates validates the close reason of a status change and adds
+// it to the updates. It returns the article credited with solving the ticket.
+func (t *Ticket) closeReasonUpdates(change TicketStatusChange, updates map[string]interface{}) (*uint, error) {
+	if change.Status != TicketStatusResolved && change.Status != TicketStatusClosed {
+		if change.CloseReason != "" {
+			return nil, ErrCloseReasonNotAllowed
+		}
+		return nil, nil
+	}
+
+	reason := change.CloseReason
+	if reason == "" {
+		// Closing a resolved ticket keeps the reason it was resolved with
+		reason = t.CloseReason
+		if reason == "" {
+			reason = CloseReasonResolved
+		}
+	}
+	if !containsString(ValidCloseReasons, reason) {
+		return nil, ErrInvalidCloseReason
+	}
+	updates["close_reason"] = reason
+
+	if reason != CloseReasonResolvedWithArticle {
+		updates["solved_by_task_id"] = nil
+		return nil, nil
+	}
+
+	solvedBy := change.TaskID
+	if solvedBy == nil {
+		solvedBy = t.SolvedByTaskID
+	}
+	if solvedBy == nil {
+		return nil, ErrArticleRequired
+	}
+	updates["solved_by_task_id"] = *solvedBy
+	return solvedBy, nil
+}
+
+// nonNilIDs collects the set IDs among the given optional IDs
+func nonNilIDs(ids ...*uint) []uint {
+	var set []uint
+	for _, id := range ids {
+		if id != nil {
+			set = append(set, *id)
+		}
+	}
+	return set
+}
+
+// AssignTicket assigns a ticket to an agent, or unassigns it when assigneeID is nil
+func AssignTicket(id uint, assigneeID *uint) (*Ticket, error) {
+	ticket, err := GetTicketByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.ApprovalStatus == ApprovalPending {
+		return nil, ErrAwaitingApproval
+	}
+
+	if assigneeID != nil {
+		assignee, err := GetUserByID(*assigneeID)
+		if err != nil || !assignee.IsAgent() || !assignee.Active {
+			return nil, ErrInvalidAssignee
+		}
+	}
+
+	updates := map[string]interface{}{"assignee_id": assigneeID}
+	// Picking up a new ticket opens it
+	if assigneeID != nil && ticket.Status == TicketStatusNew {
+		updates["status"] = TicketStatusOpen
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, id, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetTicketByID(id)
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TicketArticleLink connects a ticket with a knowledge article (task)
+type TicketArticleLink struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TicketID   uint      `json:"ticket_id" gorm:"index"`
+	TaskID     uint      `json:"task_id" gorm:"index"`
+	Task       *Task     `json:"task,omitempty" gorm:"foreignKey:TaskID"`
+	LinkedByID uint      `json:"linked_by_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// KnowledgeGap summarises how well the tickets of a category are covered by articles
+type KnowledgeGap struct {
+	Category         string `json:"category"`
+	Tickets          int64  `json:"tickets"`
+	LinkedTickets    int64  `json:"linked_tickets"`
+	SolvedByArticle  int64  `json:"solved_by_article"`
+	ApprovedArticles int64  `json:"approved_articles"`
+	Gap              bool   `json:"gap"` // No ticket of the category has a linked article
+}
+
+// Close reasons
+const (
+	CloseReasonResolved            = "resolved"
+	CloseReasonResolvedWithArticle = "resolved_with_article"
+	CloseReasonDuplicate           = "duplicate"
+	CloseReasonNoResponse          = "no_response"
+	CloseReasonWontFix             = "wont_fix"
+)
+
+var ValidCloseReasons = []string{CloseReasonResolved, CloseReasonResolvedWithArticle, CloseReasonDuplicate, CloseReasonNoResponse, CloseReasonWontFix}
+
+var (
+	ErrArticleNotFound       = errors.New("article not found")
+	ErrInvalidCloseReason    = errors.New("invalid close reason")
+	ErrArticleRequired       = errors.New("resolving with an article requires the article that solved the ticket")
+	ErrCloseReasonNotAllowed = errors.New("a close reason can only be given when resolving or closing a ticket")
+)
+
+// GetTicketArticles lists the articles linked to a ticket
+func GetTicketArticles(ticketID uint) ([]TicketArticleLink, error) {
+	var links []TicketArticleLink
+	err := DB.Preload("Task").Where("ticket_id = ?", ticketID).Order("created_at").Find(&links).Error
+	return links, err
+}
+
+// linkTicketArticle links an article to a ticket unless it already is
+func linkTicketArticle(tx *gorm.DB, ticketID, taskID, linkedByID uint) error {
+	var task Task
+	if err := tx.First(&task, taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrArticleNotFound
+		}
+		return err
+	}
+	link := TicketArticleLink{TicketID: ticketID, TaskID: taskID, LinkedByID: linkedByID}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error
+}
+
+// LinkTicketArticle links an article to a ticket
+func LinkTicketArticle(ticketID, taskID, linkedByID uint) error {
+	if _, err := GetTicketByID(ticketID); err != nil {
+		return err
+	}
+	return linkTicketArticle(DB, ticketID, taskID, linkedByID)
+}
+
+// UnlinkTicketArticle removes an article from a ticket. If the article was
+// credited with solving the ticket, the credit is withdrawn.
+func UnlinkTicketArticle(ticketID, taskID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_id = ? AND task_id = ?", ticketID, taskID).Delete(&TicketArticleLink{}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&Ticket{}).
+			Where("id = ? AND solved_by_task_id = ?", ticketID, taskID).
+			Updates(map[string]interface{}{"solved_by_task_id": nil, "close_reason": CloseReasonResolved})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return refreshSolvedCount(tx, taskID)
+	})
+}
+
+// refreshSolvedCount recounts the resolved tickets an article is credited with.
+// UpdateColumn skips the task hooks, so the seed file is not rewritten.
+func refreshSolvedCount(tx *gorm.DB, taskID uint) error {
+	var solved int64
+	if err := tx.Model(&Ticket{}).
+		Where("solved_by_task_id = ? AND status IN ?", taskID, []string{TicketStatusResolved, TicketStatusClosed}).
+		Count(&solved).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Task{ID: taskID}).UpdateColumn("solved_count", solved).Error
+}
+
+// GetKnowledgeGaps reports per category how many tickets raised since the
+// given time have articles linked, busiest categories first. Categories with
+// fewer than minTickets tickets are left out.
+func GetKnowledgeGaps(since time.Time, minTickets int64) ([]KnowledgeGap, error) {
+	var gaps []KnowledgeGap
+	err := DB.Model(&Ticket{}).
+		Select(`category,
+			COUNT(*) AS tickets,
+			COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM ticket_article_links l WHERE l.ticket_id = tickets.id)) AS linked_tickets,
+			COUNT(*) FILTER (WHERE solved_by_task_id IS NOT NULL) AS solved_by_article`).
+		Where("created_at >= ?", since).
+		Group("category").
+		Having("COUNT(*) >= ?", minTickets).
+		Order("tickets DESC, category").
+		Scan(&gaps).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []struct {
+		Category string
+		Count    int64
+	}
+	if err := DB.Model(&Task{}).Select("category, COUNT(*) AS count").
+		Where("status = ?", "approved").Group("category").Scan(&articles).Error; err != nil {
+		return nil, err
+	}
+	approved := make(map[string]int64, len(articles))
+	for _, a := range articles {
+		approved[a.Category] = a.Count
+	}
+
+	for i := range gaps {
+		gaps[i].ApprovedArticles = approved[gaps[i].Category]
+		gaps[i].Gap = gaps[i].LinkedTickets == 0
+	}
+	return gaps, nil
+}
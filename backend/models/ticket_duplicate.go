@@ -0,0 +1,158 @@
+package models
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DuplicateCandidate is an open ticket that looks like the same issue
+type DuplicateCandidate struct {
+	TicketID    uint      `json:"ticket_id"`
+	Reference   string    `json:"reference"`
+	Subject     string    `json:"subject"`
+	Status      string    `json:"status"`
+	RequesterID uint      `json:"requester_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Similarity  float64   `json:"similarity"` // Between 0 and 1
+}
+
+// TagPossibleDuplicate marks new tickets that resemble an open ticket
+const TagPossibleDuplicate = "possible-duplicate"
+
+// Bounds of the duplicate search
+const (
+	maxDuplicateCandidates = 500
+	maxDuplicateResults    = 5
+)
+
+// stopWords are left out when comparing tickets
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true,
+	"all": true, "can": true, "has": true, "have": true, "was": true, "were": true, "our": true,
+	"this": true, "that": true, "with": true, "from": true, "they": true, "been": true,
+	"any": true, "its": true, "get": true, "got": true, "cannot": true, "can't": true,
+	"hello": true, "thanks": true, "thank": true, "please": true, "regards": true,
+}
+
+// duplicateWindow returns how far back open tickets are compared, set with DUPLICATE_WINDOW_HOURS
+func duplicateWindow() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("DUPLICATE_WINDOW_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+// duplicateThreshold returns the similarity from which a ticket counts as a
+// likely duplicate, set with DUPLICATE_THRESHOLD
+func duplicateThreshold() float64 {
+	if threshold, err := strconv.ParseFloat(os.Getenv("DUPLICATE_THRESHOLD"), 64); err == nil && threshold > 0 && threshold <= 1 {
+		return threshold
+	}
+	return 0.4
+}
+
+// similarityTerms splits a text into the set of lower-case words worth
+// comparing: at least three characters long and not a stop word
+func similarityTerms(text string) map[string]bool {
+	terms := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if len([]rune(word)) >= 3 && !stopWords[word] {
+			terms[word] = true
+		}
+	}
+	return terms
+}
+
+// jaccard is the share of terms two sets have in common
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for term := range a {
+		if b[term] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// ticketSimilarity compares two tickets by subject and by subject and
+// description together, whichever is closer. Outage reports tend to share
+// a short subject while their descriptions differ in detail.
+func ticketSimilarity(aSubject, aBody, bSubject, bBody string) float64 {
+	subject := jaccard(similarityTerms(aSubject), similarityTerms(bSubject))
+	text := jaccard(similarityTerms(aSubject+" "+aBody), similarityTerms(bSubject+" "+bBody))
+	if subject > text {
+		return subject
+	}
+	return text
+}
+
+// FindDuplicateTickets lists the open, unmerged tickets raised around the
+// same time that are most similar to the ticket
+func FindDuplicateTickets(ticket *Ticket) ([]DuplicateCandidate, error) {
+	var tickets []Ticket
+	window := duplicateWindow()
+	if err := DB.Select("id", "subject", "description", "status", "requester_id", "created_at").
+		Where("id <> ? AND merged_into_id IS NULL AND status NOT IN ?", ticket.ID, []string{TicketStatusResolved, TicketStatusClosed}).
+		Where("created_at BETWEEN ? AND ?", ticket.CreatedAt.Add(-window), ticket.CreatedAt.Add(window)).
+		Order("created_at DESC").Limit(maxDuplicateCandidates).
+		Find(&tickets).Error; err != nil {
+		return nil, err
+	}
+
+	threshold := duplicateThreshold()
+	candidates := []DuplicateCandidate{}
+	for i := range tickets {
+		other := &tickets[i]
+		similarity := ticketSimilarity(ticket.Subject, ticket.Description, other.Subject, other.Description)
+		if similarity < threshold {
+			continue
+		}
+		candidates = append(candidates, DuplicateCandidate{
+			TicketID:    other.ID,
+			Reference:   other.Reference(),
+			Subject:     other.Subject,
+			Status:      other.Status,
+			RequesterID: other.RequesterID,
+			CreatedAt:   other.CreatedAt,
+			Similarity:  float64(int(similarity*100+0.5)) / 100,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Similarity > candidates[j].Similarity
+	})
+	if len(candidates) > maxDuplicateResults {
+		candidates = candidates[:maxDuplicateResults]
+	}
+	return candidates, nil
+}
+
+// flagPossibleDuplicate tags a new ticket when it resembles an open ticket,
+// so agents can find the suggestions with the tag filter
+func flagPossibleDuplicate(ticket *Ticket) {
+	candidates, err := FindDuplicateTickets(ticket)
+	if err != nil {
+		log.Printf("Warning: Could not check %s for duplicates: %v", ticket.Reference(), err)
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	ticket.Tags = append(ticket.Tags, TagPossibleDuplicate)
+	if err := DB.Model(ticket).Update("tags", ticket.Tags).Error; err != nil {
+		log.Printf("Warning: Could not flag %s as a possible duplicate: %v", ticket.Reference(), err)
+	}
+}
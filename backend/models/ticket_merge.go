@@ -0,0 +1,246 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+)
+
+// TicketMergeRequest lists the tickets to merge into a primary ticket
+type TicketMergeRequest struct {
+	TicketIDs []uint `json:"ticket_ids" binding:"required,min=1"`
+}
+
+var (
+	ErrTicketMerged   = errors.New("ticket has been merged into another ticket")
+	ErrMergeIntoSelf  = errors.New("a ticket cannot be merged into itself")
+	ErrMergeCollision = errors.New("ticket was changed by someone else, try again")
+)
+
+// maxMergeHops bounds how far a chain of merged tickets is followed
+const maxMergeHops = 10
+
+// followMerges returns the ticket a merged ticket ended up in
+func followMerges(ticket *Ticket) (*Ticket, error) {
+	for hops := 0; ticket.MergedIntoID != nil && hops < maxMergeHops; hops++ {
+		primary, err := GetTicketByID(*ticket.MergedIntoID)
+		if err != nil {
+			return nil, err
+		}
+		ticket = primary
+	}
+	return ticket, nil
+}
+
+// AcceptsEmailFrom reports whether the user may reply to the ticket by
+// email: anyone who can view it, and the requesters and CCs of the tickets
+// merged into it
+func (t *Ticket) AcceptsEmailFrom(user *User) (bool, error) {
+	if t.CanView(user) {
+		return true, nil
+	}
+	return t.hasMergedParticipant(user)
+}
+
+// hasMergedParticipant reports whether the user raised or is copied on a
+// ticket merged into this one
+func (t *Ticket) hasMergedParticipant(user *User) (bool, error) {
+	var count int64
+	err := DB.Model(&Ticket{}).Where("merged_into_id = ?", t.ID).
+		Where("requester_id = ? OR id IN (SELECT ticket_id FROM ticket_ccs WHERE user_id = ?)", user.ID, user.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// MergeTickets merges secondary tickets into a primary ticket. The
+// description, conversation and attachments of each secondary ticket are
+// copied to the primary as internal notes, and its watchers are copied on
+// the primary. Requesters of different tickets never see each other's
+// messages: the secondary requesters keep their own conversation on the
+// secondary ticket, and they and its CCs are not copied on the primary but
+// mailed its public replies (see notifyRequester). Their email replies
+// become internal notes there (see AddTicketMessage). The secondary tickets
+// are closed as duplicates and point at the primary from then on.
+func MergeTickets(primaryID uint, req TicketMergeRequest, actor *User) (*Ticket, error) {
+	primary, err := GetTicketByID(primaryID)
+	if err != nil {
+		return nil, err
+	}
+	if primary.MergedIntoID != nil {
+		return nil, ErrTicketMerged
+	}
+	if primary.Status == TicketStatusClosed {
+		return nil, ErrTicketClosed
+	}
+
+	secondaries := make([]*Ticket, 0, len(req.TicketIDs))
+	for _, id := range uniqueIDs(req.TicketIDs) {
+		if id == primaryID {
+			return nil, ErrMergeIntoSelf
+		}
+		secondary, err := GetTicketByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if secondary.MergedIntoID != nil {
+			return nil, fmt.Errorf("%s: %w", secondary.Reference(), ErrTicketMerged)
+		}
+		secondaries = append(secondaries, secondary)
+	}
+
+	now := time.Now()
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		references := make([]string, 0, len(secondaries))
+		for _, secondary := range secondaries {
+			if err := mergeTicket(tx, primary, secondary, actor, now); err != nil {
+				return err
+			}
+			references = append(references, secondary.Reference())
+		}
+
+		note := TicketMessage{
+			TicketID:   primary.ID,
+			AuthorID:   actor.ID,
+			Body:       fmt.Sprintf("%s merged %s into this ticket.", displayName(actor), strings.Join(references, ", ")),
+			Visibility: VisibilityInternal,
+			Source:     SourceWeb,
+		}
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		return syncTicketSLA(tx, primary.ID, now)
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, secondary := range secondaries {
+		notifyMerged(secondary, primary)
+	}
+	return GetTicketByID(primaryID)
+}
+
+// mergeTicket moves one secondary ticket into the primary
+func mergeTicket(tx *gorm.DB, primary, secondary *Ticket, actor *User, now time.Time) error {
+	// Claim the secondary first so a concurrent merge of the same ticket fails
+	updates := map[string]interface{}{
+		"merged_into_id":    primary.ID,
+		"status":            TicketStatusClosed,
+		"closed_at":         now,
+		"close_reason":      CloseReasonDuplicate,
+		"solved_by_task_id": nil,
+	}
+	if secondary.ResolvedAt == nil {
+		updates["resolved_at"] = now
+	}
+	result := tx.Model(&Ticket{}).Where("id = ? AND merged_into_id IS NULL", secondary.ID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMergeCollision
+	}
+	// A closed duplicate must not be routed once its approvers decide
+	if secondary.ApprovalStatus == ApprovalPending {
+		if err := cancelApprovals(tx, secondary.ID); err != nil {
+			return err
+		}
+	}
+	if secondary.SolvedByTaskID != nil {
+		if err := refreshSolvedCount(tx, *secondary.SolvedByTaskID); err != nil {
+			return err
+		}
+	}
+
+	// The description opens the secondary's part of the conversation, at the
+	// time it was raised, with the attachments it was raised with. The
+	// conversation is copied; the secondary keeps it for its requester.
+	description := TicketMessage{
+		TicketID:       primary.ID,
+		AuthorID:       secondary.RequesterID,
+		Body:           fmt.Sprintf("Merged from %s: %s\n\n%s", secondary.Reference(), secondary.Subject, secondary.Description),
+		Visibility:     VisibilityInternal,
+		Source:         secondary.Source,
+		EmailMessageID: secondary.EmailMessageID,
+		CreatedAt:      secondary.CreatedAt,
+	}
+	if err := tx.Create(&description).Error; err != nil {
+		return err
+	}
+	var attachments []TicketAttachment
+	if err := tx.Where("ticket_id = ? AND ticket_message_id IS NULL", secondary.ID).Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	if err := copyAttachments(tx, attachments, primary.ID, description.ID); err != nil {
+		return err
+	}
+
+	var messages []TicketMessage
+	if err := tx.Preload("Attachments").Where("ticket_id = ?", secondary.ID).Order("created_at, id").Find(&messages).Error; err != nil {
+		return err
+	}
+	for _, message := range messages {
+		copied := TicketMessage{
+			TicketID:   primary.ID,
+			AuthorID:   message.AuthorID,
+			Body:       message.Body,
+			Visibility: VisibilityInternal,
+			Source:     message.Source,
+			CreatedAt:  message.CreatedAt,
+		}
+		if err := tx.Create(&copied).Error; err != nil {
+			return err
+		}
+		if err := copyAttachments(tx, message.Attachments, primary.ID, copied.ID); err != nil {
+			return err
+		}
+	}
+	for _, watcher := range secondary.Watchers {
+		if _, err := addTicketWatcher(tx, primary.ID, watcher.ID); err != nil {
+			return err
+		}
+	}
+
+	note := TicketMessage{
+		TicketID: secondary.ID,
+		AuthorID: actor.ID,
+		Body: fmt.Sprintf("%s merged this ticket into %s, which covers the same issue. Updates on it will be sent to you by email.",
+			displayName(actor), primary.Reference()),
+		Visibility: VisibilityPublic,
+		Source:     SourceWeb,
+	}
+	if err := tx.Create(&note).Error; err != nil {
+		return err
+	}
+	return syncTicketSLA(tx, secondary.ID, now)
+}
+
+// copyAttachments records attachments again for a message of another
+// ticket. The copies share the stored files.
+func copyAttachments(tx *gorm.DB, attachments []TicketAttachment, ticketID, messageID uint) error {
+	copies := make([]TicketAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		attachment.ID = 0
+		attachment.TicketID = ticketID
+		attachment.TicketMessageID = &messageID
+		copies = append(copies, attachment)
+	}
+	return createAttachments(tx, copies)
+}
+
+// notifyMerged tells the requester of a merged ticket where it went
+func notifyMerged(secondary, primary *Ticket) {
+	subject := fmt.Sprintf("[%s] %s", secondary.Reference(), secondary.Subject)
+	body := fmt.Sprintf(
+		"Your ticket %s has been merged into %s \"%s\", which covers the same issue. Updates on it will be sent to you by email.",
+		secondary.Reference(), primary.Reference(), primary.Subject,
+	)
+	if err := mailer.Send(secondary.Requester.Email, subject, body); err != nil {
+		log.Printf("Warning: Could not notify %s of the merge of %s: %v", secondary.Requester.Email, secondary.Reference(), err)
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestMergeTicketsKeepsConversationsApart(t *testing.T) {
+	useTestDB(t)
+	agent := createTestUser(t, "agent")
+	primaryRequester := createTestUser(t, "user")
+	secondaryRequester := createTestUser(t, "user")
+	primary := createTestTicket(t, primaryRequester, nil)
+	secondary := createTestTicket(t, secondaryRequester, nil)
+
+	reply := TicketMessage{
+		TicketID:   secondary.ID,
+		AuthorID:   secondaryRequester.ID,
+		Body:       "My desk number is 4.12.",
+		Visibility: VisibilityPublic,
+		Source:     SourceWeb,
+	}
+	if err := DB.Create(&reply).Error; err != nil {
+		t.Fatalf("creating reply: %v", err)
+	}
+
+	if _, err := MergeTickets(primary.ID, TicketMergeRequest{TicketIDs: []uint{secondary.ID}}, agent); err != nil {
+		t.Fatalf("MergeTickets() error = %v", err)
+	}
+
+	// The secondary requester still reads their conversation, closed by a public note
+	own, err := GetTicketMessages(secondary.ID, secondaryRequester)
+	if err != nil {
+		t.Fatalf("GetTicketMessages() error = %v", err)
+	}
+	if len(own) != 2 || own[0].ID != reply.ID || own[1].AuthorID != agent.ID {
+		t.Errorf("secondary requester sees %d messages, want their reply and the merge note", len(own))
+	}
+
+	// The primary requester sees none of it, the agents see it all
+	visible, err := GetTicketMessages(primary.ID, primaryRequester)
+	if err != nil {
+		t.Fatalf("GetTicketMessages() error = %v", err)
+	}
+	if len(visible) != 0 {
+		t.Errorf("primary requester sees %d messages of the merged ticket", len(visible))
+	}
+	notes, err := GetTicketMessages(primary.ID, agent)
+	if err != nil {
+		t.Fatalf("GetTicketMessages() error = %v", err)
+	}
+	copied := false
+	for _, note := range notes {
+		if note.Body == reply.Body && note.AuthorID == secondaryRequester.ID && note.IsInternal() {
+			copied = true
+		}
+	}
+	if !copied {
+		t.Error("reply of the merged ticket was not copied to the primary as an internal note")
+	}
+}
@@ -0,0 +1,461 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"supportdesk/mailer"
+
+	"gorm.io/gorm"
+)
+
+// TicketMessage is a reply in the conversation of a ticket
+type TicketMessage struct {
+	ID             uint               `json:"id" gorm:"primaryKey"`
+	TicketID       uint               `json:"ticket_id" gorm:"index"`
+	AuthorID       uint               `json:"author_id"`
+	Author         User               `json:"author" gorm:"foreignKey:AuthorID"`
+	Body           string             `json:"body" gorm:"type:text"`
+	Visibility     string             `json:"visibility"`
+	Source         string             `json:"source"`
+	EmailMessageID string             `json:"-"` // Message-ID header of the email the message came from
+	Attachments    []TicketAttachment `json:"attachments" gorm:"foreignKey:TicketMessageID"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// TicketAttachment is a file attached to a ticket or to one of its messages
+type TicketAttachment struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	TicketID        uint      `json:"ticket_id" gorm:"index"`
+	TicketMessageID *uint     `json:"ticket_message_id" gorm:"index"`
+	Filename        string    `json:"filename"`
+	ContentType     string    `json:"content_type"`
+	Size            int64     `json:"size"`
+	Checksum        string    `json:"checksum"`
+	StoragePath     string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// AttachmentUpload is a file to be stored with a ticket or a message
+type AttachmentUpload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// TicketMessageRequest is used for posting a message to a ticket, as JSON
+// or as a multipart form with the files in "attachments"
+type TicketMessageRequest struct {
+	Body       string `json:"body" form:"body"`
+	Visibility string `json:"visibility" form:"visibility"`
+}
+
+// TicketMessageInput describes a new message on a ticket
+type TicketMessageInput struct {
+	Body           string
+	Visibility     string // Defaults to public
+	Source         string
+	EmailMessageID string
+	Attachments    []AttachmentUpload
+}
+
+// Ticket and message sources
+const (
+	SourceWeb   = "web"
+	SourceEmail = "email"
+)
+
+// Message visibilities. Internal notes are only ever shown to agents.
+const (
+	VisibilityPublic   = "public"
+	VisibilityInternal = "internal"
+)
+
+var ValidVisibilities = []string{VisibilityPublic, VisibilityInternal}
+
+var (
+	ErrTicketMessageEmpty = errors.New("message needs a body or an attachment")
+	ErrInvalidVisibility  = errors.New("invalid visibility")
+	ErrInternalNote       = errors.New("only agents can write internal notes")
+	ErrTicketClosed       = errors.New("ticket is closed")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+)
+
+// subjectReference finds a ticket reference such as "[TCK-42]" in an email subject
+var subjectReference = regexp.MustCompile(`\[TCK-(\d+)\]`)
+
+// MaxAttachmentSize is the largest attachment that is stored, set with MAX_ATTACHMENT_MB
+func MaxAttachmentSize() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("MAX_ATTACHMENT_MB")); err == nil && mb > 0 {
+		return int64(mb) << 20
+	}
+	return 25 << 20
+}
+
+// attachmentsDir is where attachment files are kept, set with ATTACHMENTS_DIR
+func attachmentsDir() string {
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("uploads", "attachments")
+}
+
+// IsInternal reports whether the message is an agent-only note
+func (m *TicketMessage) IsInternal() bool {
+	return m.Visibility == VisibilityInternal
+}
+
+// GetTicketMessages lists the conversation of a ticket, oldest first.
+// Internal notes are only included for agents.
+func GetTicketMessages(ticketID uint, viewer *User) ([]TicketMessage, error) {
+	var messages []TicketMessage
+	query := DB.Preload("Author").Preload("Attachments").Where("ticket_id = ?", ticketID)
+	if !viewer.IsAgent() {
+		query = query.Where("visibility = ?", VisibilityPublic)
+	}
+	err := query.Order("created_at, id").Find(&messages).Error
+	return messages, err
+}
+
+// AddTicketMessage adds a message to the conversation of a ticket. A public
+// agent reply counts as a response and is mailed to the requester; a
+// requester replying to a pending or resolved ticket reopens it. Internal
+// notes change nothing on the ticket. Email replies of the requesters and
+// CCs of tickets merged into it are added as internal notes, which count
+// like a requester reply.
+func AddTicketMessage(ticketID uint, author *User, input TicketMessageInput) (*TicketMessage, error) {
+	ticket, err := GetTicketByID(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	mergedReply := false
+	if !ticket.CanView(author) {
+		if input.Source == SourceEmail {
+			if mergedReply, err = ticket.hasMergedParticipant(author); err != nil {
+				return nil, err
+			}
+		}
+		if !mergedReply {
+			return nil, ErrTicketAccessForbidden
+		}
+	}
+	if ticket.MergedIntoID != nil {
+		return nil, ErrTicketMerged
+	}
+	if ticket.Status == TicketStatusClosed {
+		return nil, ErrTicketClosed
+	}
+	input.Body = strings.TrimSpace(input.Body)
+	if input.Body == "" && len(input.Attachments) == 0 {
+		return nil, ErrTicketMessageEmpty
+	}
+	if input.Source == "" {
+		input.Source = SourceWeb
+	}
+	if input.Visibility == "" {
+		input.Visibility = VisibilityPublic
+	}
+	if !containsString(ValidVisibilities, input.Visibility) {
+		return nil, ErrInvalidVisibility
+	}
+	if input.Visibility == VisibilityInternal && !author.IsAgent() {
+		return nil, ErrInternalNote
+	}
+	if mergedReply {
+		// The ticket's own requester must not see it
+		input.Visibility = VisibilityInternal
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	switch {
+	case input.Visibility == VisibilityInternal && !mergedReply:
+		// Notes are not a response to the requester
+	case author.IsAgent():
+		updates["last_agent_reply_at"] = now
+		if ticket.FirstRespondedAt == nil {
+			updates["first_responded_at"] = now
+		}
+	case (ticket.IsRequester(author) || mergedReply) &&
+		(ticket.Status == TicketStatusPending || ticket.Status == TicketStatusResolved):
+		// Reopening clears the previous resolution
+		updates["status"] = TicketStatusOpen
+		updates["resolved_at"] = nil
+		updates["close_reason"] = ""
+		updates["solved_by_task_id"] = nil
+	}
+
+	attachments, err := storeAttachments(ticketID, input.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	message := TicketMessage{
+		TicketID:       ticketID,
+		AuthorID:       author.ID,
+		Body:           input.Body,
+		Visibility:     input.Visibility,
+		Source:         input.Source,
+		EmailMessageID: input.EmailMessageID,
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		for i := range attachments {
+			attachments[i].TicketMessageID = &message.ID
+		}
+		if err := createAttachments(tx, attachments); err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(ticket).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, reopened := updates["status"]; reopened && ticket.SolvedByTaskID != nil {
+			if err := refreshSolvedCount(tx, *ticket.SolvedByTaskID); err != nil {
+				return err
+			}
+		}
+		return syncTicketSLA(tx, ticketID, now)
+	}); err != nil {
+		removeAttachmentFiles(attachments)
+		return nil, err
+	}
+
+	if err := DB.Preload("Author").Preload("Attachments").First(&message, message.ID).Error; err != nil {
+		return nil, err
+	}
+	if author.IsAgent() && !message.IsInternal() && !ticket.IsRequester(author) {
+		notifyRequester(ticket, &message)
+	}
+	return &message, nil
+}
+
+// notifyRequester mails a public agent reply to the requester and the users
+// copied on the ticket. The ticket reference in the subject threads their
+// answer back onto the ticket.
+func notifyRequester(ticket *Ticket, message *TicketMessage) {
+	subject := fmt.Sprintf("[%s] %s", ticket.Reference(), ticket.Subject)
+	body := fmt.Sprintf("%s replied to your ticket %s:\n\n%s\n", displayName(&message.Author), ticket.Reference(), message.Body)
+	if len(message.Attachments) > 0 {
+		body += fmt.Sprintf("\n%d attachment(s) can be downloaded from the ticket.\n", len(message.Attachments))
+	}
+	body += "\nReply to this email or view the ticket: " + mailer.Link(fmt.Sprintf("/tickets/%d", ticket.ID))
+
+	recipients := []string{ticket.Requester.Email}
+	for _, cc := range ticket.CCs {
+		recipients = append(recipients, cc.Email)
+	}
+	for _, to := range recipients {
+		if err := mailer.Send(to, subject, body); err != nil {
+			log.Printf("Warning: Could not notify %s of a reply on %s: %v", to, ticket.Reference(), err)
+		}
+	}
+	notifyMergedRequesters(ticket, message)
+}
+
+// notifyMergedRequesters mails a public reply to the requesters and CCs of
+// the tickets merged into the ticket, under their own ticket's reference.
+// They cannot open the primary ticket, so only the reply itself is sent.
+func notifyMergedRequesters(ticket *Ticket, message *TicketMessage) {
+	var merged []Ticket
+	if err := DB.Preload("Requester").Preload("CCs").Where("merged_into_id = ?", ticket.ID).Find(&merged).Error; err != nil {
+		log.Printf("Warning: Could not load the tickets merged into %s: %v", ticket.Reference(), err)
+		return
+	}
+
+	notified := map[uint]bool{ticket.RequesterID: true}
+	for _, cc := range ticket.CCs {
+		notified[cc.ID] = true
+	}
+	for _, secondary := range merged {
+		subject := fmt.Sprintf("[%s] %s", secondary.Reference(), secondary.Subject)
+		body := fmt.Sprintf("%s posted an update on the issue your ticket %s was merged into:\n\n%s\n",
+			displayName(&message.Author), secondary.Reference(), message.Body)
+		for _, user := range append([]User{secondary.Requester}, secondary.CCs...) {
+			if notified[user.ID] {
+				continue
+			}
+			notified[user.ID] = true
+			if err := mailer.Send(user.Email, subject, body); err != nil {
+				log.Printf("Warning: Could not notify %s of a reply on %s: %v", user.Email, ticket.Reference(), err)
+			}
+		}
+	}
+}
+
+// displayName is the name a user is shown with in emails
+func displayName(user *User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return user.Email
+}
+
+// GetTicketAttachment retrieves an attachment of a ticket. Attachments of
+// internal notes are only found for agents.
+func GetTicketAttachment(ticketID, attachmentID uint, viewer *User) (*TicketAttachment, error) {
+	var attachment TicketAttachment
+	query := DB.Where("ticket_id = ?", ticketID)
+	if !viewer.IsAgent() {
+		query = query.Where("ticket_message_id IS NULL OR ticket_message_id IN (SELECT id FROM ticket_messages WHERE visibility = ?)", VisibilityPublic)
+	}
+	if err := query.First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// FindTicketForEmail finds the ticket an inbound email belongs to. The
+// Message-IDs the email refers to are tried first, then a ticket reference
+// in the subject. Replies to a merged ticket go to the ticket it was merged into.
+func FindTicketForEmail(references []string, subject string) (*Ticket, error) {
+	ticket, err := findTicketForEmail(references, subject)
+	if err != nil {
+		return nil, err
+	}
+	return followMerges(ticket)
+}
+
+func findTicketForEmail(references []string, subject string) (*Ticket, error) {
+	if len(references) > 0 {
+		var ids []uint
+		if err := DB.Model(&TicketMessage{}).Where("email_message_id IN ?", references).
+			Order("id DESC").Limit(1).Pluck("ticket_id", &ids).Error; err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			if err := DB.Model(&Ticket{}).Where("email_message_id IN ?", references).
+				Order("id DESC").Limit(1).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+		}
+		if len(ids) > 0 {
+			return GetTicketByID(ids[0])
+		}
+	}
+
+	if match := subjectReference.FindStringSubmatch(subject); match != nil {
+		if id, err := strconv.ParseUint(match[1], 10, 32); err == nil {
+			return GetTicketByID(uint(id))
+		}
+	}
+	return nil, ErrTicketNotFound
+}
+
+// StripTicketReferences removes ticket references such as "[TCK-42]" from an email subject
+func StripTicketReferences(subject string) string {
+	return strings.Join(strings.Fields(subjectReference.ReplaceAllString(subject, "")), " ")
+}
+
+// EmailIngested reports whether an email with the Message-ID already became a ticket or message
+func EmailIngested(messageID string) (bool, error) {
+	var count int64
+	if err := DB.Model(&Ticket{}).Where("email_message_id = ?", messageID).Count(&count).Error; err != nil || count > 0 {
+		return count > 0, err
+	}
+	err := DB.Model(&TicketMessage{}).Where("email_message_id = ?", messageID).Count(&count).Error
+	return count > 0, err
+}
+
+// storeAttachments writes the uploaded files to the attachments directory
+// and returns the records describing them, ready to be created. Every
+// upload gets a file of its own, even when the same file was stored before.
+func storeAttachments(ticketID uint, uploads []AttachmentUpload) ([]TicketAttachment, error) {
+	if len(uploads) == 0 {
+		return nil, nil
+	}
+	limit := MaxAttachmentSize()
+	for _, upload := range uploads {
+		if int64(len(upload.Data)) > limit {
+			return nil, ErrAttachmentTooLarge
+		}
+	}
+
+	dir := filepath.Join(attachmentsDir(), strconv.FormatUint(uint64(ticketID), 10))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	attachments := make([]TicketAttachment, 0, len(uploads))
+	for _, upload := range uploads {
+		sum := sha256.Sum256(upload.Data)
+		checksum := hex.EncodeToString(sum[:])
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			removeAttachmentFiles(attachments)
+			return nil, err
+		}
+		filename := safeFilename(upload.Filename)
+		path := filepath.Join(dir, checksum[:16]+"-"+hex.EncodeToString(suffix)+"-"+filename)
+		if err := os.WriteFile(path, upload.Data, 0o640); err != nil {
+			removeAttachmentFiles(attachments)
+			return nil, err
+		}
+
+		contentType := upload.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		attachments = append(attachments, TicketAttachment{
+			TicketID:    ticketID,
+			Filename:    filename,
+			ContentType: contentType,
+			Size:        int64(len(upload.Data)),
+			Checksum:    checksum,
+			StoragePath: path,
+		})
+	}
+	return attachments, nil
+}
+
+// createAttachments records stored attachment files
+func createAttachments(tx *gorm.DB, attachments []TicketAttachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	return tx.Create(&attachments).Error
+}
+
+// removeAttachmentFiles deletes stored files whose records could not be created
+func removeAttachmentFiles(attachments []TicketAttachment) {
+	for _, attachment := range attachments {
+		if err := os.Remove(attachment.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Could not remove attachment file %s: %v", attachment.StoragePath, err)
+		}
+	}
+}
+
+// safeFilename strips directories and control characters from an uploaded file name
+func safeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStoreAttachmentsKeepsFilesApart(t *testing.T) {
+	t.Setenv("ATTACHMENTS_DIR", t.TempDir())
+	upload := AttachmentUpload{Filename: "vpn-client.log", ContentType: "text/plain", Data: []byte("09:23:40 keepalive timeout\n")}
+
+	first, err := storeAttachments(1, []AttachmentUpload{upload})
+	if err != nil {
+		t.Fatalf("storeAttachments() error = %v", err)
+	}
+	second, err := storeAttachments(1, []AttachmentUpload{upload, upload})
+	if err != nil {
+		t.Fatalf("storeAttachments() error = %v", err)
+	}
+	paths := map[string]bool{first[0].StoragePath: true}
+	for _, attachment := range second {
+		if paths[attachment.StoragePath] {
+			t.Fatalf("%s is stored twice", attachment.StoragePath)
+		}
+		paths[attachment.StoragePath] = true
+		if attachment.Checksum != first[0].Checksum || attachment.Filename != "vpn-client.log" {
+			t.Errorf("attachment = %s %s, want the checksum and name of the upload", attachment.Checksum, attachment.Filename)
+		}
+	}
+
+	// A message that could not be saved removes only its own files
+	removeAttachmentFiles(second)
+	if _, err := os.Stat(first[0].StoragePath); err != nil {
+		t.Errorf("file of the first message is gone: %v", err)
+	}
+	for _, attachment := range second {
+		if _, err := os.Stat(attachment.StoragePath); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", attachment.StoragePath)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TimeEntry is time an agent spent on a ticket, logged by hand or by a
+// timer. A running timer has TimerStartedAt set and no minutes yet.
+type TimeEntry struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	TicketID       uint       `json:"ticket_id"`
+	UserID         uint       `json:"user_id"`
+	User           User       `json:"user" gorm:"foreignKey:UserID"`
+	Minutes        int        `json:"minutes"`
+	Billable       bool       `json:"billable"`
+	Note           string     `json:"note"`
+	WorkedAt       time.Time  `json:"worked_at"`
+	TimerStartedAt *time.Time `json:"timer_started_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TimeEntryRequest is used for logging and correcting time by hand
+type TimeEntryRequest struct {
+	Minutes  int        `json:"minutes" binding:"required,min=1,max=1440"`
+	Billable *bool      `json:"billable"` // Defaults to true
+	Note     string     `json:"note" binding:"max=2000"`
+	WorkedAt *time.Time `json:"worked_at"` // Defaults to now
+}
+
+// TimerRequest is used for starting a timer on a ticket
+type TimerRequest struct {
+	Billable *bool  `json:"billable"` // Defaults to true
+	Note     string `json:"note" binding:"max=2000"`
+}
+
+// TicketTime lists the time logged on a ticket with its totals. Running
+// timers are listed but not counted.
+type TicketTime struct {
+	Entries         []TimeEntry `json:"entries"`
+	TotalMinutes    int         `json:"total_minutes"`
+	BillableMinutes int         `json:"billable_minutes"`
+}
+
+// TimeStat totals the time logged by one group in one period
+type TimeStat struct {
+	GroupID         *uint     `json:"group_id"` // Agent ID; null for the other groupings
+	Group           string    `json:"group"`
+	Period          time.Time `json:"period"`
+	Entries         int64     `json:"entries"`
+	Minutes         int64     `json:"minutes"`
+	BillableMinutes int64     `json:"billable_minutes"`
+	Hours           float64   `json:"hours" gorm:"-"`
+	BillableHours   float64   `json:"billable_hours" gorm:"-"`
+}
+
+// Time report groupings
+const (
+	TimeGroupAgent      = "agent"
+	TimeGroupCategory   = "category"
+	TimeGroupDepartment = "department" // Department of the ticket's requester
+	TimeGroupPeriod     = "period"     // Everyone's time per period
+)
+
+// maxEntryMinutes caps a time entry at a day, the limit of TimeEntryRequest
+const maxEntryMinutes = 24 * 60
+
+var (
+	ValidTimeGroups    = []string{TimeGroupAgent, TimeGroupCategory, TimeGroupDepartment, TimeGroupPeriod}
+	ValidTimeIntervals = []string{"day", "week", "month"}
+)
+
+var (
+	ErrTimeEntryNotFound   = errors.New("time entry not found")
+	ErrTimeEntryForbidden  = errors.New("only the agent who logged the time or an admin can change it")
+	ErrTimerRunning        = errors.New("a timer is already running")
+	ErrTimerNotRunning     = errors.New("no timer is running")
+	ErrInvalidTimeGroup    = errors.New("invalid grouping, expected agent, category, department or period")
+	ErrInvalidTimeInterval = errors.New("invalid interval, expected day, week or month")
+)
+
+// GetTicketTime lists the time logged on a ticket, newest first
+func GetTicketTime(ticketID uint) (*TicketTime, error) {
+	var entries []TimeEntry
+	if err := DB.Preload("User").Where("ticket_id = ?", ticketID).
+		Order("worked_at DESC, id DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := &TicketTime{Entries: entries}
+	for _, entry := range entries {
+		result.TotalMinutes += entry.Minutes
+		if entry.Billable {
+			result.BillableMinutes += entry.Minutes
+		}
+	}
+	return result, nil
+}
+
+// LogTime records time an agent spent on a ticket
+func LogTime(ticketID uint, req TimeEntryRequest, agent *User) (*TimeEntry, error) {
+	if _, err := GetTicketByID(ticketID); err != nil {
+		return nil, err
+	}
+
+	entry := TimeEntry{
+		TicketID: ticketID,
+		UserID:   agent.ID,
+		Minutes:  req.Minutes,
+		Billable: req.Billable == nil || *req.Billable,
+		Note:     req.Note,
+		WorkedAt: time.Now(),
+	}
+	if req.WorkedAt != nil {
+		entry.WorkedAt = *req.WorkedAt
+	}
+	if err := DB.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return getTimeEntry(entry.ID)
+}
+
+// getTimeEntry retrieves a time entry with its agent
+func getTimeEntry(id uint) (*TimeEntry, error) {
+	var entry TimeEntry
+	if err := DB.Preload("User").First(&entry, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTimeEntryNotFound
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// editableTimeEntry loads a time entry the user may change
+func editableTimeEntry(id uint, user *User) (*TimeEntry, error) {
+	entry, err := getTimeEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry.UserID != user.ID && user.Role != "admin" {
+		return nil, ErrTimeEntryForbidden
+	}
+	return entry, nil
+}
+
+// UpdateTimeEntry corrects a logged time entry. Running timers have to be
+// stopped first.
+func UpdateTimeEntry(id uint, req TimeEntryRequest, user *User) (*TimeEntry, error) {
+	entry, err := editableTimeEntry(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if entry.TimerStartedAt != nil {
+		return nil, ErrTimerRunning
+	}
+
+	updates := map[string]interface{}{
+		"minutes":  req.Minutes,
+		"billable": req.Billable == nil || *req.Billable,
+		"note":     req.Note,
+	}
+	if req.WorkedAt != nil {
+		updates["worked_at"] = *req.WorkedAt
+	}
+	if err := DB.Model(entry).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return getTimeEntry(id)
+}
+
+// DeleteTimeEntry removes a time entry, discarding it if it is a running timer
+func DeleteTimeEntry(id uint, user *User) error {
+	entry, err := editableTimeEntry(id, user)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(entry).Error
+}
+
+// GetRunningTimer returns the agent's running timer
+func GetRunningTimer(agent *User) (*TimeEntry, error) {
+	var entry TimeEntry
+	if err := DB.Preload("User").Where("user_id = ? AND timer_started_at IS NOT NULL", agent.ID).
+		First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTimerNotRunning
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// StartTimer starts timing the agent's work on a ticket. An agent runs one
+// timer at a time.
+func StartTimer(ticketID uint, req TimerRequest, agent *User) (*TimeEntry, error) {
+	if _, err := GetTicketByID(ticketID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := TimeEntry{
+		TicketID:       ticketID,
+		UserID:         agent.ID,
+		Billable:       req.Billable == nil || *req.Billable,
+		Note:           req.Note,
+		WorkedAt:       now,
+		TimerStartedAt: &now,
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		// Serialises timer starts of the agent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&User{}, agent.ID).Error; err != nil {
+			return err
+		}
+		var running int64
+		if err := tx.Model(&TimeEntry{}).Where("user_id = ? AND timer_started_at IS NOT NULL", agent.ID).
+			Count(&running).Error; err != nil {
+			return err
+		}
+		if running > 0 {
+			return ErrTimerRunning
+		}
+		return tx.Create(&entry).Error
+	}); err != nil {
+		return nil, err
+	}
+	return getTimeEntry(entry.ID)
+}
+
+// StopTimer stops the agent's running timer and logs the time, rounded to
+// the minute, at least one and at most a day. A timer forgotten for longer
+// logs a day, to be corrected by hand.
+func StopTimer(agent *User) (*TimeEntry, error) {
+	entry, err := GetRunningTimer(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := int(math.Round(time.Since(*entry.TimerStartedAt).Minutes()))
+	if minutes < 1 {
+		minutes = 1
+	}
+	if minutes > maxEntryMinutes {
+		minutes = maxEntryMinutes
+	}
+	result := DB.Model(&TimeEntry{}).
+		Where("id = ? AND timer_started_at IS NOT NULL", entry.ID).
+		Updates(map[string]interface{}{"minutes": minutes, "timer_started_at": nil})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTimerNotRunning
+	}
+	return getTimeEntry(entry.ID)
+}
+
+// timeGroupings are the groupings of the time report
+var timeGroupings = map[string]reportGrouping{
+	TimeGroupAgent:      {"e.user_id", "COALESCE(NULLIF(u.name, ''), u.email)", "JOIN users u ON u.id = e.user_id"},
+	TimeGroupCategory:   {"NULL::bigint", "t.category", ""},
+	TimeGroupDepartment: {"NULL::bigint", "COALESCE(NULLIF(r.department, ''), 'No department')", "JOIN users r ON r.id = t.requester_id"},
+	TimeGroupPeriod:     {"NULL::bigint", "'All'", ""},
+}
+
+// GetTimeReport totals the time logged between from and to per group
+// (agent, category or requester department) and per day, week or month.
+// Running timers are left out.
+func GetTimeReport(group, interval string, from, to time.Time, billableOnly bool) ([]TimeStat, error) {
+	grouping, ok := timeGroupings[group]
+	if !ok {
+		return nil, ErrInvalidTimeGroup
+	}
+	if !containsString(ValidTimeIntervals, interval) {
+		return nil, ErrInvalidTimeInterval
+	}
+
+	var stats []TimeStat
+	query := groupedReport("time_entries e", "e.worked_at", interval, grouping,
+		`COUNT(*) AS entries,
+			SUM(e.minutes) AS minutes,
+			COALESCE(SUM(e.minutes) FILTER (WHERE e.billable), 0) AS billable_minutes`,
+		"JOIN tickets t ON t.id = e.ticket_id").
+		Where("e.timer_started_at IS NULL AND e.worked_at >= ? AND e.worked_at < ?", from, to)
+	if billableOnly {
+		query = query.Where("e.billable")
+	}
+	if err := scanGroupedReport(query, &stats); err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		stats[i].Hours = math.Round(float64(stats[i].Minutes)/60*100) / 100
+		stats[i].BillableHours = math.Round(float64(stats[i].BillableMinutes)/60*100) / 100
+	}
+	return stats, nil
+}
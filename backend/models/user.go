@@ -3,21 +3,34 @@ package models
 import (
 	"errors"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string    `json:"-" gorm:"not null"` // "-" means this field won't be included in JSON
-	Role      string    `json:"role" gorm:"not null;default:'user'"`
-	Tasks     []Task    `json:"tasks,omitempty" gorm:"foreignKey:UserID"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Email        string         `json:"email" gorm:"uniqueIndex;not null"`
+	Password     string         `json:"-" gorm:"not null"` // "-" means this field won't be included in JSON
+	Role         string         `json:"role" gorm:"not null;default:'user'"`
+	Name         string         `json:"name"`
+	GivenName    string         `json:"given_name"`
+	FamilyName   string         `json:"family_name"`
+	ExternalID   string         `json:"external_id,omitempty" gorm:"index"`
+	Active       bool           `json:"active" gorm:"not null;default:true"`
+	TokenVersion uint           `json:"-" gorm:"not null;default:0"` // Security stamp, bumped to revoke issued tokens
+	Skills       pq.StringArray `json:"skills" gorm:"type:text[]"`   // Used by skill-based ticket assignment
+	Away         bool           `json:"away" gorm:"not null;default:false"`
+	ManagerID    *uint          `json:"manager_id"` // Approves requests needing the requester's manager
+	Department   string         `json:"department"` // Time reports total support time per department
+	Tasks        []Task         `json:"tasks,omitempty" gorm:"foreignKey:UserID"`
+	Groups       []Group        `json:"groups,omitempty" gorm:"many2many:group_members"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
 }
 
 // UserLogin is used for login requests
@@ -67,7 +80,34 @@ func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
 
-var ErrUserNotFound = errors.New("user not found")
+// ValidRoles lists the roles a user can be assigned, from most to least privileged
+var ValidRoles = []string{"admin", "agent", "user"}
+
+// IsAgentRole reports whether the role may work tickets. Admins are agents too.
+func IsAgentRole(role string) bool {
+	return role == "admin" || role == "agent"
+}
+
+// IsAgent reports whether the user may work tickets
+func (u *User) IsAgent() bool {
+	return IsAgentRole(u.Role)
+}
+
+// ValidateRole checks if the role is valid
+func ValidateRole(role string) bool {
+	for _, validRole := range ValidRoles {
+		if role == validRole {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserInactive = errors.New("user is deactivated")
+	ErrManagerCycle = errors.New("a user cannot report to themselves")
+)
 
 // GetUserByID retrieves a user by their ID
 func GetUserByID(id uint) (*User, error) {
@@ -75,7 +115,7 @@ func GetUserByID(id uint) (*User, error) {
 	err := DB.First(&user, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound 
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -95,7 +135,6 @@ func GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-
 // CreateUser creates a new user in the database
 func CreateUser(email, password, role string) (*User, error) {
 	// Hash the password before creating the user
@@ -127,5 +166,233 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// nextTokenVersion is added to an update to invalidate the user's existing tokens
+func nextTokenVersion() interface{} {
+	return gorm.Expr("token_version + 1")
+}
+
+// RevokeUserTokens invalidates every token issued to a user
+func RevokeUserTokens(id uint) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("token_version", nextTokenVersion()).Error
+}
+
+// SetUserActive activates or deactivates a user. Deactivation revokes the user's tokens.
+func SetUserActive(id uint, active bool) error {
+	updates := map[string]interface{}{"active": active}
+	if !active {
+		updates["token_version"] = nextTokenVersion()
+	}
+	return DB.Model(&User{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// SetUserRole changes a user's role and revokes their tokens
+func SetUserRole(id uint, role string) error {
+	if !ValidateRole(role) {
+		return ErrInvalidRole
+	}
+	return DB.Model(&User{}).Where("id = ? AND role <> ?", id, role).Updates(map[string]interface{}{
+		"role":          role,
+		"token_version": nextTokenVersion(),
+	}).Error
+}
+
+// SetUserPassword hashes and stores a new password for a user and revokes their tokens
+func SetUserPassword(id uint, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password":      hashedPassword,
+		"token_version": nextTokenVersion(),
+	}).Error
+}
+
+// SetUserAway marks an agent as away so auto-assignment skips them
+func SetUserAway(id uint, away bool) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("away", away).Error
+}
+
+// SetUserSkills replaces the skills of an agent
+func SetUserSkills(id uint, skills []string) error {
+	cleaned := make([]string, 0, len(skills))
+	for _, skill := range skills {
+		if skill = strings.TrimSpace(skill); skill != "" && !containsString(cleaned, skill) {
+			cleaned = append(cleaned, skill)
+		}
+	}
+	return DB.Model(&User{}).Where("id = ?", id).Update("skills", pq.StringArray(cleaned)).Error
+}
+
+// SetUserManager sets or clears the manager of a user. A user cannot end up
+// managing themselves, directly or through others.
+func SetUserManager(id uint, managerID *uint) error {
+	if managerID != nil {
+		for next := managerID; next != nil; {
+			if *next == id {
+				return ErrManagerCycle
+			}
+			manager, err := GetUserByID(*next)
+			if err != nil {
+				return err
+			}
+			next = manager.ManagerID
+		}
+	}
+	return DB.Model(&User{}).Where("id = ?", id).Update("manager_id", managerID).Error
+}
+
+// SetUserDepartment sets the department a user's support time is billed to
+func SetUserDepartment(id uint, department string) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("department", strings.TrimSpace(department)).Error
+}
+
+// GetUsers lists users, optionally filtered by role
+func GetUsers(role string) ([]User, error) {
+	var users []User
+	query := DB.Order("email")
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	err := query.Find(&users).Error
+	return users, err
+}
+
+// UserProfile holds the user attributes managed by an external directory
+type UserProfile struct {
+	Email      string
+	Role       string // Left unchanged when empty
+	Name       string
+	GivenName  string
+	FamilyName string
+	ExternalID string
+	Department string
+	Active     bool
+}
+
+// ProfileOf returns the directory-managed attributes of a user
+func ProfileOf(user *User) UserProfile {
+	return UserProfile{
+		Email:      user.Email,
+		Role:       user.Role,
+		Name:       user.Name,
+		GivenName:  user.GivenName,
+		FamilyName: user.FamilyName,
+		ExternalID: user.ExternalID,
+		Department: user.Department,
+		Active:     user.Active,
+	}
+}
+
+// ProvisionUser creates a user from a directory profile
+func ProvisionUser(profile UserProfile, password string) (*User, error) {
+	if profile.Role == "" {
+		profile.Role = "user"
+	}
+	if !ValidateRole(profile.Role) {
+		return nil, ErrInvalidRole
+	}
+	if _, err := GetUserByEmail(profile.Email); err == nil {
+		return nil, ErrEmailRegistered
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Email:      profile.Email,
+		Password:   hashedPassword,
+		Role:       profile.Role,
+		Name:       profile.Name,
+		GivenName:  profile.GivenName,
+		FamilyName: profile.FamilyName,
+		ExternalID: profile.ExternalID,
+		Department: profile.Department,
+	}
+	if err := DB.Create(user).Error; err != nil {
+		return nil, err
+	}
+
+	// "active" defaults to true in the database, so a zero value is not written on create
+	if !profile.Active {
+		if err := SetUserActive(user.ID, false); err != nil {
+			return nil, err
+		}
+	}
+	return GetUserByID(user.ID)
+}
 
+// UpdateUserProfile overwrites the directory-managed attributes of a user
+func UpdateUserProfile(id uint, profile UserProfile) (*User, error) {
+	user, err := GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Role == "" {
+		profile.Role = user.Role
+	}
+	if !ValidateRole(profile.Role) {
+		return nil, ErrInvalidRole
+	}
+	if !strings.EqualFold(profile.Email, user.Email) {
+		if _, err := GetUserByEmail(profile.Email); err == nil {
+			return nil, ErrEmailRegistered
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	updates := map[string]interface{}{
+		"email":       profile.Email,
+		"role":        profile.Role,
+		"name":        profile.Name,
+		"given_name":  profile.GivenName,
+		"family_name": profile.FamilyName,
+		"external_id": profile.ExternalID,
+		"department":  profile.Department,
+		"active":      profile.Active,
+	}
+	if profile.Role != user.Role || (user.Active && !profile.Active) {
+		updates["token_version"] = nextTokenVersion()
+	}
+
+	if err := DB.Model(user).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetUserByID(id)
+}
 
+// DeprovisionUser deactivates a user and removes them from all groups.
+// The account itself is kept so the articles it authored stay intact.
+func DeprovisionUser(id uint) error {
+	user, err := GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var roleGroups int64
+		if err := tx.Model(&Group{}).
+			Joins("JOIN group_members ON group_members.group_id = groups.id").
+			Where("group_members.user_id = ? AND groups.role <> ''", user.ID).
+			Count(&roleGroups).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Association("Groups").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"active":        false,
+			"token_version": nextTokenVersion(),
+		}).Error; err != nil {
+			return err
+		}
+		if roleGroups == 0 {
+			return nil
+		}
+		return syncGroupRoles(tx, []uint{user.ID})
+	})
+}
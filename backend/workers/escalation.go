@@ -0,0 +1,13 @@
+package workers
+
+import (
+	"time"
+
+	"supportdesk/models"
+)
+
+// StartEscalationMonitor periodically evaluates the escalation rules. It
+// blocks, so run it in its own goroutine.
+func StartEscalationMonitor() {
+	runEvery("Escalation monitor", intervalFromEnv("ESCALATION_CHECK_INTERVAL_SECONDS", time.Minute), models.CheckEscalations)
+}
@@ -0,0 +1,29 @@
+package workers
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"supportdesk/mailin"
+)
+
+// StartMailIngestion periodically turns the email in MAILIN_SOURCE into
+// tickets and replies. It does nothing when no source is configured and
+// otherwise blocks, so run it in its own goroutine.
+func StartMailIngestion() {
+	spec := os.Getenv("MAILIN_SOURCE")
+	if spec == "" {
+		log.Println("Mail ingestion disabled, MAILIN_SOURCE not set")
+		return
+	}
+	source, err := mailin.NewSource(spec)
+	if err != nil {
+		log.Printf("Mail ingestion disabled: %v", err)
+		return
+	}
+
+	runEvery("Mail ingestion", intervalFromEnv("MAILIN_INTERVAL_SECONDS", time.Minute), func(time.Time) error {
+		return source.Fetch(mailin.Process)
+	})
+}
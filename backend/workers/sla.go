@@ -0,0 +1,13 @@
+package workers
+
+import (
+	"time"
+
+	"supportdesk/models"
+)
+
+// StartSLAMonitor periodically flags tickets whose SLA targets are at risk or
+// breached. It blocks, so run it in its own goroutine.
+func StartSLAMonitor() {
+	runEvery("SLA monitor", intervalFromEnv("SLA_CHECK_INTERVAL_SECONDS", time.Minute), models.CheckSLATimers)
+}
@@ -0,0 +1,31 @@
+package workers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// intervalFromEnv reads a check interval in seconds from the environment
+func intervalFromEnv(key string, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv(key)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// runEvery calls check on every tick of the interval. It blocks, so run it
+// in its own goroutine.
+func runEvery(name string, interval time.Duration, check func(now time.Time) error) {
+	log.Printf("%s checking every %s", name, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := check(now); err != nil {
+			log.Printf("%s: check failed: %v", name, err)
+		}
+	}
+}